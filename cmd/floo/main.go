@@ -0,0 +1,108 @@
+// Command floo runs a Floo gateway from a configuration file.
+//
+// Usage:
+//
+//	floo serve    --config routes.yaml [--listen :8080] [--tls-cert cert.pem --tls-key key.pem [--tls-client-ca ca.pem]]
+//	floo validate --config routes.yaml
+//	floo routes   --config routes.yaml
+//	floo match    --config routes.yaml METHOD URL [-H "Name: value" ...]
+//	floo replay   --target http://localhost:8080 [--speed 2] [-H "Name: value" ...] traffic.jsonl
+//
+// Every flag can also be set through the environment variable shown in its help text.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a floo subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "run the gateway", runServe},
+	{"validate", "check a configuration file", runValidate},
+	{"routes", "print the compiled route table", runRoutes},
+	{"match", "show which route would handle a request and why", runMatch},
+	{"replay", "send recorded traffic and compare the responses", runReplay},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "floo %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if name != "help" && name != "-h" && name != "--help" {
+		fmt.Fprintf(os.Stderr, "floo: unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: floo <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'floo <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a subcommand with the flags every command shares.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("floo "+name, flag.ExitOnError)
+	configPath := fs.String("config", env("FLOO_CONFIG", "routes.yaml"), "configuration file, YAML or JSON ($FLOO_CONFIG)")
+	return fs, configPath
+}
+
+// env returns the value of the environment variable key, or def if it is unset.
+func env(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// flagSet reports whether the flag name was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// headerFlags collects repeated -H "Name: value" flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(v string) error {
+	if !strings.Contains(v, ":") {
+		return fmt.Errorf("header %q must have the form 'Name: value'", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
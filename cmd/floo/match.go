@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/d0lim/floo/pkg/config"
+)
+
+func runMatch(args []string) error {
+	fs, configPath := newFlagSet("match")
+	var headers headerFlags
+	fs.Var(&headers, "H", "request header 'Name: value', may be repeated")
+	fs.Parse(args)
+
+	// Flags may also follow METHOD and URL
+	rest := fs.Args()
+	if len(rest) < 2 {
+		return errors.New("usage: floo match [flags] METHOD URL [-H 'Name: value' ...]")
+	}
+	method, rawURL := strings.ToUpper(rest[0]), rest[1]
+	fs.Parse(rest[2:])
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	gw, err := cfg.Build(nil)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	e, err := gw.ExplainRequest(req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s\n\n", method, rawURL)
+	for _, re := range e.Routes {
+		spec := cfg.Routes[re.Index]
+		for j, pr := range re.Predicates {
+			fmt.Printf("  route %-3d %-20s %s %s\n", re.Index, re.ID, mark(pr.Matched), spec.Predicates[j])
+		}
+		if len(re.Predicates) == 0 {
+			fmt.Printf("  route %-3d %-20s %s (no predicates)\n", re.Index, re.ID, mark(true))
+		}
+		if re.Disabled {
+			fmt.Printf("  route %-3d %-20s %s disabled\n", re.Index, re.ID, mark(false))
+		}
+		if re.Index == e.RouteIndex {
+			break
+		}
+	}
+
+	fmt.Println()
+	if !e.Matched() {
+		fmt.Println("No matching route found")
+		return nil
+	}
+	fmt.Printf("Matched route %d (%s)\n", e.RouteIndex, e.RouteID)
+	if e.FilterError != "" {
+		fmt.Printf("Rejected by filter: %s\n", e.FilterError)
+		return nil
+	}
+	fmt.Printf("Rewritten path: %s\n", e.RewrittenPath)
+	fmt.Printf("Upstream URL:   %s\n", e.UpstreamURL)
+	return nil
+}
+
+func mark(ok bool) string {
+	if ok {
+		return "[match]   "
+	}
+	return "[no match]"
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/d0lim/floo/pkg/record"
+)
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("floo replay", flag.ExitOnError)
+	target := fs.String("target", env("FLOO_REPLAY_TARGET", ""), "base URL of the gateway or upstream the requests are sent to ($FLOO_REPLAY_TARGET)")
+	speed := fs.Float64("speed", 1, "speed factor of the recorded pace, e.g. 2 for twice as fast; 0 sends requests back to back")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each request")
+	var headers headerFlags
+	fs.Var(&headers, "H", "header 'Name: value' set on every request, may be repeated")
+	var compare []string
+	fs.Func("compare-header", "response header compared besides Content-Type, may be repeated", func(v string) error {
+		compare = append(compare, v)
+		return nil
+	})
+	fs.Parse(args)
+
+	// Flags may also follow FILE
+	rest := fs.Args()
+	if len(rest) < 1 {
+		return errors.New("usage: floo replay --target URL [flags] FILE")
+	}
+	path := rest[0]
+	fs.Parse(rest[1:])
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if *target == "" {
+		return errors.New("--target is required")
+	}
+
+	records, err := record.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	replayer := &record.Replayer{
+		Target:         *target,
+		Speed:          *speed,
+		Client:         &http.Client{Timeout: *timeout},
+		Headers:        http.Header{},
+		CompareHeaders: compare,
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		replayer.Headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	failed := 0
+	for _, result := range replayer.Replay(ctx, records) {
+		req := result.Record.Request
+		switch {
+		case result.Err != nil:
+			fmt.Printf("ERROR %s %s: %v\n", req.Method, req.URL, result.Err)
+		case len(result.Diffs) > 0:
+			fmt.Printf("DIFF  %s %s\n", req.Method, req.URL)
+			for _, d := range result.Diffs {
+				fmt.Printf("      %s\n", d)
+			}
+		default:
+			fmt.Printf("OK    %s %s\n", req.Method, req.URL)
+		}
+		if !result.OK() {
+			failed++
+		}
+	}
+
+	fmt.Printf("\n%d requests replayed, %d differed\n", len(records), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d responses differed", failed, len(records))
+	}
+	return nil
+}
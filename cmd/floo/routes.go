@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/d0lim/floo/pkg/config"
+)
+
+func runValidate(args []string) error {
+	fs, configPath := newFlagSet("validate")
+	fs.Parse(args)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(nil); err != nil {
+		return err
+	}
+	fmt.Printf("%s: OK (%d routes)\n", *configPath, len(cfg.Routes))
+	return nil
+}
+
+func runRoutes(args []string) error {
+	fs, configPath := newFlagSet("routes")
+	fs.Parse(args)
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	routes, err := cfg.BuildRoutes(nil)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tID\tPREDICATES\tFILTERS\tUPSTREAM\tSTATUS")
+	for i, route := range routes {
+		spec := cfg.Routes[i]
+		filters := append(append([]config.Definition{}, cfg.DefaultFilters...), spec.Filters...)
+		status := "enabled"
+		if route.Disabled {
+			status = "disabled"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			i, route.ID, joinDefinitions(spec.Predicates), joinDefinitions(filters), route.Upstream, status)
+	}
+	return w.Flush()
+}
+
+func joinDefinitions(defs []config.Definition) string {
+	if len(defs) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(defs))
+	for i, d := range defs {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, "; ")
+}
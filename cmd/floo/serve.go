@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/d0lim/floo/pkg/accesslog"
+	"github.com/d0lim/floo/pkg/admin"
+	"github.com/d0lim/floo/pkg/config"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/listener"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/d0lim/floo/pkg/metrics"
+	"github.com/d0lim/floo/pkg/record"
+	"github.com/d0lim/floo/pkg/tracing"
+	"github.com/gofiber/fiber/v2"
+)
+
+func runServe(args []string) error {
+	fs, configPath := newFlagSet("serve")
+	listen := fs.String("listen", env("FLOO_LISTEN", ":8080"), "address to serve the gateway on ($FLOO_LISTEN)")
+	tlsCert := fs.String("tls-cert", env("FLOO_TLS_CERT", ""), "TLS certificate file; serves HTTPS when set ($FLOO_TLS_CERT)")
+	tlsKey := fs.String("tls-key", env("FLOO_TLS_KEY", ""), "TLS private key file ($FLOO_TLS_KEY)")
+	tlsClientCA := fs.String("tls-client-ca", env("FLOO_TLS_CLIENT_CA", ""), "PEM file of the CAs client certificates are verified against; enables mutual TLS ($FLOO_TLS_CLIENT_CA)")
+	tlsClientAuth := fs.String("tls-client-auth", env("FLOO_TLS_CLIENT_AUTH", "require"), "require, optional or none: whether clients must present a certificate when --tls-client-ca is set ($FLOO_TLS_CLIENT_AUTH)")
+	logLevel := fs.String("log-level", env("FLOO_LOG_LEVEL", "info"), "debug, info, warn or error, optionally followed by per-component levels such as ,Proxy=debug ($FLOO_LOG_LEVEL)")
+	logFormat := fs.String("log-format", env("FLOO_LOG_FORMAT", "text"), "text, json or logfmt ($FLOO_LOG_FORMAT)")
+	accessLog := fs.String("access-log", env("FLOO_ACCESS_LOG", ""), "file the access log is appended to, - for stdout; disabled when empty ($FLOO_ACCESS_LOG)")
+	accessLogFormat := fs.String("access-log-format", env("FLOO_ACCESS_LOG_FORMAT", "common"), "common, combined, json or a ${variable} template ($FLOO_ACCESS_LOG_FORMAT)")
+	accessLogMaxSize := fs.Int64("access-log-max-size", 100, "size in MB at which the access log file is rotated, 0 to disable")
+	accessLogBackups := fs.Int("access-log-max-backups", 5, "number of rotated access log files to keep")
+	metricsPath := fs.String("metrics-path", env("FLOO_METRICS_PATH", ""), "path serving Prometheus metrics on the gateway listener; disabled when empty ($FLOO_METRICS_PATH)")
+	metricsListen := fs.String("metrics-listen", env("FLOO_METRICS_LISTEN", ""), "separate address serving Prometheus metrics at /metrics ($FLOO_METRICS_LISTEN)")
+	otlpEndpoint := fs.String("otlp-endpoint", env("FLOO_OTLP_ENDPOINT", ""), "OTLP/HTTP endpoint traces are exported to, e.g. localhost:4318; tracing is disabled when empty ($FLOO_OTLP_ENDPOINT)")
+	otlpInsecure := fs.Bool("otlp-insecure", env("FLOO_OTLP_INSECURE", "false") == "true", "export traces over plain HTTP ($FLOO_OTLP_INSECURE)")
+	traceB3 := fs.Bool("trace-b3", env("FLOO_TRACE_B3", "false") == "true", "also accept and send B3 trace headers ($FLOO_TRACE_B3)")
+	recordPath := fs.String("record", env("FLOO_RECORD", ""), "file sampled traffic is recorded to, JSONL or .har; disabled when empty ($FLOO_RECORD)")
+	recordSample := fs.Float64("record-sample", 1, "fraction of requests recorded, between 0 (none) and 1 (all)")
+	errorFormat := fs.String("error-format", env("FLOO_ERROR_FORMAT", "problem"), "format of error responses: problem (RFC 9457 JSON), html or text ($FLOO_ERROR_FORMAT)")
+	errorTemplate := fs.String("error-template", env("FLOO_ERROR_TEMPLATE", ""), "template file rendering error responses, overriding --error-format; its extension sets the content type ($FLOO_ERROR_TEMPLATE)")
+	watch := fs.Bool("watch", env("FLOO_WATCH", "true") == "true", "reload the configuration when the file changes; off by default with --admin-listen ($FLOO_WATCH)")
+	adminListen := fs.String("admin-listen", env("FLOO_ADMIN_LISTEN", ""), "address of the admin API; disabled when empty ($FLOO_ADMIN_LISTEN)")
+	adminToken := fs.String("admin-token", env("FLOO_ADMIN_TOKEN", ""), "bearer token required by the admin API ($FLOO_ADMIN_TOKEN)")
+	adminAudit := fs.String("admin-audit", env("FLOO_ADMIN_AUDIT", "-"), "file the admin audit log is appended to, - for stdout ($FLOO_ADMIN_AUDIT)")
+	fs.Parse(args)
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return errors.New("--tls-cert and --tls-key must be set together")
+	}
+	if *tlsClientCA != "" && *tlsCert == "" {
+		return errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+	}
+	if *recordSample < 0 || *recordSample > 1 {
+		return errors.New("--record-sample must be between 0 and 1")
+	}
+	if *adminListen != "" && *adminToken == "" {
+		return errors.New("--admin-token is required when the admin API is enabled")
+	}
+	if *adminListen != "" && *watch {
+		// Reloading the file would silently undo the changes made through the API
+		if _, ok := os.LookupEnv("FLOO_WATCH"); ok || flagSet(fs, "watch") {
+			return errors.New("--watch cannot be used with the admin API, as reloads would overwrite its changes")
+		}
+		*watch = false
+	}
+
+	levels, err := log.ParseLevels(*logLevel)
+	if err != nil {
+		return err
+	}
+	format, err := log.ParseFormat(*logFormat)
+	if err != nil {
+		return err
+	}
+	logger := log.New(log.WithFlags(log.LogFlags{Date: true, Time: true, Format: format}, "[FLOO] "), log.WithLevels(levels))
+
+	cfg, err := config.LoadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	m, err := config.NewManager(cfg, nil)
+	if err != nil {
+		return err
+	}
+	m.Logger = logger
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *watch {
+		go m.Watch(ctx)
+	} else {
+		// SIGHUP still reloads the file, e.g. with the admin API
+		go m.WatchSignal(ctx)
+	}
+
+	// The proxy and explain settings are fixed from here on; Manager.Apply
+	// warns when a reload changes them
+	gw := *m.Gateway()
+	gw.ReverseProxy = log.NewProxyLogger(gw.ReverseProxy, log.WithLogger(logger))
+	loggingGateway := log.NewGatewayLogger(gw, log.WithLogger(logger))
+
+	renderer, err := errorRenderer(*errorFormat, *errorTemplate)
+	if err != nil {
+		return err
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: gateway.ErrorHandler(renderer)})
+	if verifiesHostClientCerts(cfg.Listeners) {
+		app.Use(listener.CheckSNI(cfg.Listeners))
+	}
+	if *accessLog != "" {
+		var out io.Writer = os.Stdout
+		if *accessLog != "-" {
+			file, err := accesslog.OpenRotatingFile(*accessLog, *accessLogMaxSize<<20, *accessLogBackups)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			out = file
+		}
+		handler, err := accesslog.New(accesslog.Config{Format: *accessLogFormat, Output: out, Logger: logger})
+		if err != nil {
+			return err
+		}
+		app.Use(handler)
+	}
+	if *recordPath != "" {
+		w, err := record.Create(*recordPath)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		recorder := &record.Recorder{Writer: w, Sample: *recordSample, Logger: logger}
+		app.Use(recorder.Middleware())
+	}
+	handler := loggingGateway.Handle
+	if *metricsPath != "" || *metricsListen != "" {
+		metricsSet := metrics.New()
+		handler = metricsSet.Wrap(handler)
+		if *metricsPath != "" {
+			app.Get(*metricsPath, metricsSet.Handler())
+		}
+		if *metricsListen != "" {
+			metricsApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+			metricsApp.Get("/metrics", metricsSet.Handler())
+			go func() {
+				logger.Info(log.GatewayComponent, "Metrics listening on %s", *metricsListen)
+				if err := metricsApp.Listen(*metricsListen); err != nil {
+					logger.Error(log.GatewayComponent, "Metrics listener stopped: %v", err)
+				}
+			}()
+			defer metricsApp.Shutdown()
+		}
+	}
+	if *otlpEndpoint != "" {
+		provider, err := tracing.NewOTLPProvider(ctx, *otlpEndpoint, "floo", *otlpInsecure)
+		if err != nil {
+			return err
+		}
+		defer provider.Shutdown(context.Background())
+		handler = tracing.New(tracing.Config{TracerProvider: provider, B3: *traceB3}).Wrap(handler)
+	}
+	app.All("/*", handler)
+
+	if *adminListen != "" {
+		audit := os.Stdout
+		if *adminAudit != "-" {
+			audit, err = os.OpenFile(*adminAudit, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				return err
+			}
+			defer audit.Close()
+		}
+		srv := admin.New(m, *adminToken, audit)
+		srv.Logger = logger
+		adminApp := srv.App()
+		go func() {
+			logger.Info(log.AdminComponent, "Admin API listening on %s", *adminListen)
+			if err := adminApp.Listen(*adminListen); err != nil {
+				logger.Error(log.AdminComponent, "Admin API stopped: %v", err)
+			}
+		}()
+		defer adminApp.Shutdown()
+	}
+
+	specs := cfg.Listeners
+	if len(specs) == 0 {
+		specs = []listener.Spec{flagListener(*listen, *tlsCert, *tlsKey, *tlsClientCA, *tlsClientAuth)}
+	}
+	listeners, err := listener.Listen(specs, func(err error) {
+		logger.Error(log.GatewayComponent, "Certificate reload failed, keeping the previous one: %v", err)
+	})
+	if err != nil {
+		return err
+	}
+	for i, ln := range listeners {
+		scheme := "http"
+		if specs[i].TLS != nil {
+			scheme = "https"
+		}
+		logger.Info(log.GatewayComponent, "Gateway listening on %s://%s (%d routes)", scheme, ln.Addr(), len(m.Gateway().Snapshot()))
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- listener.Serve(app, listeners)
+	}()
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+		logger.Info(log.GatewayComponent, "Shutting down")
+		return app.Shutdown()
+	}
+}
+
+// flagListener returns the listener configured by the --listen and --tls-*
+// flags, used when the configuration has no listeners. With a client CA,
+// clients are asked for certificates signed by it, which the ClientCert
+// filter forwards upstream.
+func flagListener(address, certFile, keyFile, clientCA, clientAuth string) listener.Spec {
+	spec := listener.Spec{Address: address}
+	if certFile == "" {
+		return spec
+	}
+	spec.TLS = &listener.TLSSpec{Cert: certFile, Key: keyFile}
+	if clientCA != "" {
+		spec.TLS.ClientAuthSpec = listener.ClientAuthSpec{ClientCA: clientCA, ClientAuth: clientAuth}
+	}
+	return spec
+}
+
+// verifiesHostClientCerts reports whether a listener verifies client
+// certificates per host name, which CheckSNI must then enforce.
+func verifiesHostClientCerts(specs []listener.Spec) bool {
+	for _, spec := range specs {
+		if spec.TLS != nil && len(spec.TLS.Hosts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// errorRenderer returns the renderer of error responses for --error-format
+// and --error-template.
+func errorRenderer(format, templatePath string) (gateway.ErrorRenderer, error) {
+	if templatePath != "" {
+		text, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(templatePath))
+		if contentType == "" {
+			contentType = fiber.MIMETextPlainCharsetUTF8
+		}
+		return gateway.NewTemplateRenderer(contentType, string(text))
+	}
+
+	switch format {
+	case "problem":
+		return gateway.ProblemRenderer{}, nil
+	case "html":
+		return gateway.HTMLRenderer(), nil
+	case "text":
+		return gateway.TextRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown error format %q", format)
+	}
+}
@@ -14,9 +14,10 @@ import (
 
 func main() {
 	// Log configuration
-	log.ConfigureLogger(log.LogFlags{Time: true, File: true}, "[FLOO] ")
-	log.SetLogLevel(log.DebugLevel) // Enable debug mode
-	logger := log.GetLogger()
+	logger := log.New(
+		log.WithFlags(log.LogFlags{Time: true, File: true}, "[FLOO] "),
+		log.WithLevel(log.DebugLevel), // Enable debug mode
+	)
 
 	logger.Info(log.GatewayComponent, "Starting full logging example application...")
 
@@ -24,7 +25,7 @@ func main() {
 
 	// Create base proxy and wrap with logging proxy
 	baseProxy := reverseproxy.NewNetHTTPProxy()
-	loggingProxy := log.NewProxyLogger(baseProxy)
+	loggingProxy := log.NewProxyLogger(baseProxy, log.WithLogger(logger))
 
 	// Create base gateway
 	baseGateway := gateway.Gateway{
@@ -66,7 +67,7 @@ func main() {
 	}
 
 	// Wrap with logging gateway
-	loggingGateway := log.NewGatewayLogger(baseGateway)
+	loggingGateway := log.NewGatewayLogger(baseGateway, log.WithLogger(logger))
 
 	// Test ping endpoint
 	app.Get("/api/ping", func(c *fiber.Ctx) error {
@@ -0,0 +1,113 @@
+// Package reload reloads values read from files when the files change. The
+// files are checked when the value is used, at most every check interval,
+// rather than by a goroutine watching them. CheckInBackground then loads them
+// in a goroutine, so that the caller keeps using the previous value meanwhile.
+package reload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is the check interval used when none is set.
+const DefaultInterval = time.Second
+
+// Checker tracks the version of the files behind a value. The zero value is
+// ready to use, and it is safe for concurrent use.
+type Checker struct {
+	mu      sync.Mutex
+	version string
+	checked time.Time
+	// loading is closed when the running load, if any, returns.
+	loading chan struct{}
+}
+
+// Loaded records that the files were loaded at version.
+func (c *Checker) Loaded(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version, c.checked = version, time.Now()
+}
+
+// Check calls load if interval, DefaultInterval when 0, passed since the
+// last check and version returns a new version. Only one load runs at a
+// time; other callers return at once. It returns the error of load, which is
+// reported once per version so that a broken file is not retried until it
+// changes again.
+func (c *Checker) Check(interval time.Duration, version func() (string, error), load func() error) error {
+	if !c.start(interval, version) {
+		return nil
+	}
+	defer c.finish()
+	return load()
+}
+
+// CheckInBackground is like Check, but calls load in a new goroutine and
+// returns at once. The error of load is passed to report when set, before
+// Wait returns.
+func (c *Checker) CheckInBackground(interval time.Duration, version func() (string, error), load func() error, report func(err error)) {
+	if !c.start(interval, version) {
+		return
+	}
+	go func() {
+		defer c.finish()
+		if err := load(); err != nil && report != nil {
+			report(err)
+		}
+	}()
+}
+
+// Wait returns when the running load, if any, returned.
+func (c *Checker) Wait() {
+	c.mu.Lock()
+	loading := c.loading
+	c.mu.Unlock()
+	if loading != nil {
+		<-loading
+	}
+}
+
+// start reports whether a load should start, and records it as running.
+func (c *Checker) start(interval time.Duration, version func() (string, error)) bool {
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.loading != nil || now.Sub(c.checked) < interval {
+		return false
+	}
+	c.checked = now
+	v, err := version()
+	if err != nil || v == c.version {
+		return false
+	}
+	c.version, c.loading = v, make(chan struct{})
+	return true
+}
+
+// finish records that the running load returned.
+func (c *Checker) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.loading)
+	c.loading = nil
+}
+
+// FileVersion returns a string that changes whenever the size or
+// modification time of one of the files does.
+func FileVersion(paths ...string) (string, error) {
+	var version strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&version, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return version.String(), nil
+}
@@ -0,0 +1,94 @@
+package reload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	var c Checker
+	version, loads := "v1", 0
+	var loadErr error
+	check := func(interval time.Duration) error {
+		return c.Check(interval, func() (string, error) { return version, nil }, func() error {
+			loads++
+			if loadErr == nil {
+				c.Loaded(version)
+			}
+			return loadErr
+		})
+	}
+	c.Loaded("v1")
+
+	// Unchanged versions are not loaded
+	if err := check(time.Nanosecond); err != nil || loads != 0 {
+		t.Errorf("Expected no load, but got %d loads, %v", loads, err)
+	}
+
+	// Changes are picked up once the interval passed
+	version = "v2"
+	if check(time.Hour); loads != 0 {
+		t.Errorf("Expected no load within the interval, but got %d", loads)
+	}
+	c.checked = time.Time{}
+	if check(time.Hour); loads != 1 {
+		t.Errorf("Expected 1 load, but got %d", loads)
+	}
+
+	// A failed load is reported once per version
+	version, loadErr = "v3", errors.New("broken")
+	if err := check(time.Nanosecond); err != loadErr {
+		t.Errorf("Expected the load error, but got %v", err)
+	}
+	if err := check(time.Nanosecond); err != nil || loads != 2 {
+		t.Errorf("Expected no retry of the same version, but got %d loads, %v", loads, err)
+	}
+}
+
+func TestCheckInBackground(t *testing.T) {
+	var c Checker
+	c.Loaded("v1")
+	version := func() (string, error) { return "v2", nil }
+	release, loads := make(chan struct{}), make(chan struct{}, 2)
+	load := func() error {
+		loads <- struct{}{}
+		<-release
+		return errors.New("broken")
+	}
+	var reported error
+	report := func(err error) { reported = err }
+
+	// The caller does not wait for the load, and no second load starts
+	c.CheckInBackground(time.Nanosecond, version, load, report)
+	<-loads
+	c.checked = time.Time{}
+	c.CheckInBackground(time.Nanosecond, version, load, report)
+	if len(loads) != 0 {
+		t.Error("Expected no load while one is running")
+	}
+
+	close(release)
+	c.Wait()
+	if reported == nil || reported.Error() != "broken" {
+		t.Errorf("Expected the load error to be reported, but got %v", reported)
+	}
+}
+
+func TestFileVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, []byte("a"), 0o600)
+	before, err := FileVersion(path)
+	if err != nil {
+		t.Fatalf("Failed to read version: %v", err)
+	}
+	os.WriteFile(path, []byte("ab"), 0o600)
+	if after, _ := FileVersion(path); after == before {
+		t.Error("Version should change with the file")
+	}
+	if _, err := FileVersion(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
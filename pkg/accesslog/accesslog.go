@@ -0,0 +1,209 @@
+// Package accesslog writes one line per request handled by the gateway.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Predefined formats. Common and Combined follow the Apache formats of the
+// same name, followed by the gateway fields:
+//
+//	"route_id" "upstream" upstream_latency_ms latency_ms bytes_in
+const (
+	CommonFormat   = `${remote_addr} - - [${time}] "${method} ${uri} ${protocol}" ${status} ${bytes_out}` + gatewayFields
+	CombinedFormat = `${remote_addr} - - [${time}] "${method} ${uri} ${protocol}" ${status} ${bytes_out} "${referer}" "${user_agent}"` + gatewayFields
+	// JSONFormat writes every field as a JSON object per line.
+	JSONFormat = "json"
+
+	gatewayFields = ` "${route_id}" "${upstream}" ${upstream_latency_ms} ${latency_ms} ${bytes_in}`
+)
+
+// Entry holds the fields of an access log line.
+type Entry struct {
+	Time              time.Time `json:"time"`
+	RemoteAddr        string    `json:"remote_addr"`
+	Method            string    `json:"method"`
+	URI               string    `json:"uri"`
+	Protocol          string    `json:"protocol"`
+	Status            int       `json:"status"`
+	BytesIn           int       `json:"bytes_in"`
+	BytesOut          int       `json:"bytes_out"`
+	Referer           string    `json:"referer,omitempty"`
+	UserAgent         string    `json:"user_agent,omitempty"`
+	RouteID           string    `json:"route_id,omitempty"`
+	Upstream          string    `json:"upstream,omitempty"`
+	UpstreamLatencyMs float64   `json:"upstream_latency_ms"`
+	LatencyMs         float64   `json:"latency_ms"`
+	RequestID         string    `json:"request_id,omitempty"`
+}
+
+// fields maps the template variables to their values.
+var fields = map[string]func(e *Entry) string{
+	"time":                func(e *Entry) string { return e.Time.Format("02/Jan/2006:15:04:05 -0700") },
+	"time_iso8601":        func(e *Entry) string { return e.Time.Format(time.RFC3339) },
+	"remote_addr":         func(e *Entry) string { return e.RemoteAddr },
+	"method":              func(e *Entry) string { return e.Method },
+	"uri":                 func(e *Entry) string { return e.URI },
+	"protocol":            func(e *Entry) string { return e.Protocol },
+	"status":              func(e *Entry) string { return strconv.Itoa(e.Status) },
+	"bytes_in":            func(e *Entry) string { return strconv.Itoa(e.BytesIn) },
+	"bytes_out":           func(e *Entry) string { return strconv.Itoa(e.BytesOut) },
+	"referer":             func(e *Entry) string { return orDash(e.Referer) },
+	"user_agent":          func(e *Entry) string { return orDash(e.UserAgent) },
+	"route_id":            func(e *Entry) string { return orDash(e.RouteID) },
+	"upstream":            func(e *Entry) string { return orDash(e.Upstream) },
+	"upstream_latency_ms": func(e *Entry) string { return formatMs(e.UpstreamLatencyMs) },
+	"latency_ms":          func(e *Entry) string { return formatMs(e.LatencyMs) },
+	"request_id":          func(e *Entry) string { return orDash(e.RequestID) },
+}
+
+// Config configures the access log middleware.
+type Config struct {
+	// Format is CommonFormat, CombinedFormat, JSONFormat or a template with
+	// ${name} variables, e.g. "${method} ${uri} ${status} ${route_id}".
+	// The names "common" and "combined" select the predefined formats,
+	// and CommonFormat is used when empty.
+	Format string
+	// Output receives the lines, os.Stdout when nil. See RotatingFile.
+	Output io.Writer
+	// Redactor masks sensitive query parameters of the logged URI,
+	// log.DefaultRedactor() when nil.
+	Redactor *log.Redactor
+	// Logger receives write errors, which never fail the request.
+	Logger log.Logger
+}
+
+// New creates a middleware that writes a line after the rest of the chain,
+// usually the gateway, has handled the request.
+// Errors returned by the chain are passed to the app's ErrorHandler first,
+// so that the logged status is the one sent to the client.
+func New(cfg Config) (fiber.Handler, error) {
+	switch cfg.Format {
+	case "", "common":
+		cfg.Format = CommonFormat
+	case "combined":
+		cfg.Format = CombinedFormat
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	if cfg.Redactor == nil {
+		cfg.Redactor = log.DefaultRedactor()
+	}
+
+	var format func(e *Entry, b []byte) []byte
+	if cfg.Format == JSONFormat {
+		format = func(e *Entry, b []byte) []byte {
+			line, _ := json.Marshal(e)
+			return append(b, line...)
+		}
+	} else {
+		t, err := parseTemplate(cfg.Format)
+		if err != nil {
+			return nil, err
+		}
+		format = t.append
+	}
+
+	var mu sync.Mutex
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		exchange := gateway.ExchangeOf(c)
+
+		if chainErr := c.Next(); chainErr != nil {
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+
+		e := &Entry{
+			Time:              start,
+			RemoteAddr:        c.IP(),
+			Method:            c.Method(),
+			URI:               cfg.Redactor.URL(string(c.Request().RequestURI())),
+			Protocol:          string(c.Request().Header.Protocol()),
+			Status:            c.Response().StatusCode(),
+			BytesIn:           len(c.Request().Body()),
+			BytesOut:          len(c.Response().Body()),
+			Referer:           c.Get(fiber.HeaderReferer),
+			UserAgent:         c.Get(fiber.HeaderUserAgent),
+			RouteID:           exchange.RouteID,
+			Upstream:          exchange.Upstream,
+			UpstreamLatencyMs: milliseconds(exchange.UpstreamLatency),
+			LatencyMs:         milliseconds(time.Since(start)),
+			RequestID:         exchange.RequestID,
+		}
+
+		line := append(format(e, make([]byte, 0, 256)), '\n')
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := cfg.Output.Write(line); err != nil && cfg.Logger != nil {
+			cfg.Logger.Error(log.AccessLogComponent, "Writing access log failed: %v", err)
+		}
+		return nil
+	}, nil
+}
+
+// template is a parsed format with ${name} variables.
+type template struct {
+	literals []string
+	fields   []func(e *Entry) string
+}
+
+func parseTemplate(format string) (*template, error) {
+	t := &template{}
+	rest := format
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			t.literals = append(t.literals, rest)
+			return t, nil
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("access log format: unterminated variable at %q", rest[start:])
+		}
+		name := rest[start+2 : start+end]
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("access log format: unknown variable %q", name)
+		}
+		t.literals = append(t.literals, rest[:start])
+		t.fields = append(t.fields, field)
+		rest = rest[start+end+1:]
+	}
+}
+
+func (t *template) append(e *Entry, b []byte) []byte {
+	for i, field := range t.fields {
+		b = append(b, t.literals[i]...)
+		b = append(b, field(e)...)
+	}
+	return append(b, t.literals[len(t.literals)-1]...)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatMs(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,188 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// echoProxy responds with the upstream it was asked to proxy to.
+type echoProxy struct{}
+
+func (echoProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	return c.SendString(upstream)
+}
+
+// newApp creates a fiber app serving a gateway behind the access log.
+func newApp(t *testing.T, format string, out *bytes.Buffer) *fiber.App {
+	t.Helper()
+	handler, err := New(Config{Format: format, Output: out})
+	if err != nil {
+		t.Fatalf("Failed to create access log: %v", err)
+	}
+
+	gw := &gateway.Gateway{
+		ReverseProxy: echoProxy{},
+		Routes: []gateway.Route{
+			{
+				ID:         "todos",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/todos"}},
+				Upstream:   "http://todos",
+			},
+		},
+	}
+
+	app := fiber.New()
+	app.Use(handler)
+	app.All("/*", gw.Handle)
+	return app
+}
+
+func TestCommonFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	app := newApp(t, CommonFormat, out)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/todos/1?x=1", strings.NewReader("hello")))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+
+	line := out.String()
+	if !strings.Contains(line, `"POST /todos/1?x=1 HTTP/1.1" 200 12 "todos" "http://todos" `) {
+		t.Errorf("Unexpected access log line: %s", line)
+	}
+	if !strings.HasSuffix(line, " 5\n") {
+		t.Errorf("Expected bytes in at the end: %s", line)
+	}
+
+	// Unmatched requests are logged with the status sent by the error handler
+	out.Reset()
+	app.Test(httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if !strings.Contains(out.String(), `"GET /missing HTTP/1.1" 404 `) || !strings.Contains(out.String(), `"-" "-"`) {
+		t.Errorf("Unexpected access log line: %s", out.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	app := newApp(t, JSONFormat, out)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.Header.Set("User-Agent", "test")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+
+	var e Entry
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatalf("Access log line is not JSON: %s", out.String())
+	}
+	if e.RouteID != "todos" || e.Upstream != "http://todos" || e.Status != 200 || e.UserAgent != "test" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if e.UpstreamLatencyMs > e.LatencyMs {
+		t.Errorf("Upstream latency %f should not exceed total latency %f", e.UpstreamLatencyMs, e.LatencyMs)
+	}
+}
+
+func TestTemplateFormat(t *testing.T) {
+	out := &bytes.Buffer{}
+	app := newApp(t, "${method} ${uri} ${route_id} ${status}", out)
+	app.Test(httptest.NewRequest(http.MethodGet, "/todos/2", nil))
+
+	if out.String() != "GET /todos/2 todos 200\n" {
+		t.Errorf("Unexpected access log line: %q", out.String())
+	}
+
+	// Tokens in the query are masked
+	out.Reset()
+	app.Test(httptest.NewRequest(http.MethodGet, "/todos/2?access_token=secret&page=2", nil))
+	if out.String() != "GET /todos/2?access_token="+log.Mask+"&page=2 todos 200\n" {
+		t.Errorf("Unexpected access log line: %q", out.String())
+	}
+
+	if _, err := New(Config{Format: "${nope}"}); err == nil {
+		t.Error("Expected an error for an unknown variable")
+	}
+	if _, err := New(Config{Format: "${status"}); err == nil {
+		t.Error("Expected an error for an unterminated variable")
+	}
+}
+
+// fullDisk fails every write.
+type fullDisk struct{}
+
+func (fullDisk) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+func TestWriteErrorDoesNotFailRequest(t *testing.T) {
+	logs := &bytes.Buffer{}
+	handler, err := New(Config{Output: fullDisk{}, Logger: log.New(log.WithOutput(logs))})
+	if err != nil {
+		t.Fatalf("Failed to create access log: %v", err)
+	}
+	app := fiber.New()
+	app.Use(handler)
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/todos", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+	if !strings.Contains(logs.String(), "no space left on device") {
+		t.Errorf("Write error should be logged, got %q", logs.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %s to contain %q, got %q", name, content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected at most 2 backups")
+	}
+}
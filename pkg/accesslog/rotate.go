@@ -0,0 +1,118 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an io.Writer appending to a file that is rotated once it
+// reaches MaxSize bytes. Rotated files are renamed to Path.1, Path.2, ...
+// with Path.1 the most recent, and at most MaxBackups of them are kept.
+type RotatingFile struct {
+	Path string
+	// MaxSize is the size in bytes at which the file is rotated; 0 disables rotation.
+	MaxSize int64
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending, creating it if needed.
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first if p would exceed MaxSize.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file regardless of its size, e.g. on SIGHUP.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+
+	if f.MaxBackups <= 0 {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+
+	// Shift Path.N-1 to Path.N, dropping the oldest
+	os.Remove(backupName(f.Path, f.MaxBackups))
+	for i := f.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupName(f.Path, i), backupName(f.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.Path, backupName(f.Path, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
@@ -0,0 +1,350 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/pkg/config"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Server is an admin API for managing the routes of a live Gateway.
+// It is meant to run on its own listener, separate from proxied traffic.
+// Every change is validated and applied through config.Manager, so the
+// Gateway's route table is swapped atomically.
+//
+// Note that changes made through the API are lost when the Manager reloads
+// its configuration file, so the file should not be watched meanwhile.
+type Server struct {
+	// Manager owns the configuration being edited.
+	Manager *config.Manager
+	// Token must be sent by clients as "Authorization: Bearer <Token>".
+	Token string
+	// Audit receives one JSON line per change attempt. Nothing is written when nil.
+	Audit io.Writer
+	// Logger receives a line per change attempt.
+	Logger log.Logger
+
+	// mu serializes changes so that concurrent edits are not lost
+	mu sync.Mutex
+}
+
+// New creates an admin Server for m, protected by token.
+func New(m *config.Manager, token string, audit io.Writer) *Server {
+	return &Server{
+		Manager: m,
+		Token:   token,
+		Audit:   audit,
+		Logger:  log.New(),
+	}
+}
+
+// App builds the Fiber app serving the admin API.
+func (s *Server) App() *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(s.authenticate)
+
+	app.Get("/routes", s.listRoutes)
+	app.Post("/routes", s.createRoute)
+	app.Get("/routes/:id", s.getRoute)
+	app.Put("/routes/:id", s.updateRoute)
+	app.Delete("/routes/:id", s.deleteRoute)
+	app.Post("/routes/:id/enable", s.setEnabled(true))
+	app.Post("/routes/:id/disable", s.setEnabled(false))
+	app.Get("/routes/:id/filters", s.filterChain)
+	app.Post("/explain", s.explain)
+	return app
+}
+
+// Listen serves the admin API on addr.
+func (s *Server) Listen(addr string) error {
+	if s.Token == "" {
+		return errors.New("admin: refusing to listen without a token")
+	}
+	return s.App().Listen(addr)
+}
+
+// authenticate rejects requests without the expected bearer token.
+func (s *Server) authenticate(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="floo-admin"`)
+		return fiber.NewError(http.StatusUnauthorized, "invalid or missing admin token")
+	}
+	return c.Next()
+}
+
+// RouteView is the JSON representation of a route returned by the API.
+type RouteView struct {
+	config.RouteSpec
+	// Index is the position of the route in the table.
+	Index int `json:"index"`
+}
+
+func (s *Server) listRoutes(c *fiber.Ctx) error {
+	cfg := s.Manager.Config()
+	views := make([]RouteView, len(cfg.Routes))
+	for i, spec := range cfg.Routes {
+		views[i] = view(spec, i)
+	}
+	return c.JSON(views)
+}
+
+func (s *Server) getRoute(c *fiber.Ctx) error {
+	cfg := s.Manager.Config()
+	i := indexOf(cfg, c.Params("id"))
+	if i < 0 {
+		return fiber.NewError(http.StatusNotFound, "route not found")
+	}
+	return c.JSON(view(cfg.Routes[i], i))
+}
+
+func (s *Server) createRoute(c *fiber.Ctx) error {
+	spec, err := decodeRoute(c.Body())
+	if err != nil {
+		return err
+	}
+	if spec.ID == "" {
+		return fiber.NewError(http.StatusBadRequest, "route id is required")
+	}
+	return s.change(c, "create", spec.ID, func(routes []config.RouteSpec) ([]config.RouteSpec, error) {
+		if indexOfRoutes(routes, spec.ID) >= 0 {
+			return nil, fiber.NewError(http.StatusConflict, "route already exists")
+		}
+		// Insert at the requested position, or append
+		pos := c.QueryInt("index", len(routes))
+		if pos < 0 || pos > len(routes) {
+			return nil, fiber.NewError(http.StatusBadRequest, "index out of range")
+		}
+		routes = append(routes[:pos], append([]config.RouteSpec{spec}, routes[pos:]...)...)
+		return routes, nil
+	}, http.StatusCreated)
+}
+
+func (s *Server) updateRoute(c *fiber.Ctx) error {
+	id := c.Params("id")
+	spec, err := decodeRoute(c.Body())
+	if err != nil {
+		return err
+	}
+	if spec.ID != "" && spec.ID != id {
+		return fiber.NewError(http.StatusBadRequest, "route id cannot be changed")
+	}
+	spec.ID = id
+	return s.change(c, "update", id, func(routes []config.RouteSpec) ([]config.RouteSpec, error) {
+		i := indexOfRoutes(routes, id)
+		if i < 0 {
+			return nil, fiber.NewError(http.StatusNotFound, "route not found")
+		}
+		routes[i] = spec
+		return routes, nil
+	}, http.StatusOK)
+}
+
+func (s *Server) deleteRoute(c *fiber.Ctx) error {
+	id := c.Params("id")
+	return s.change(c, "delete", id, func(routes []config.RouteSpec) ([]config.RouteSpec, error) {
+		i := indexOfRoutes(routes, id)
+		if i < 0 {
+			return nil, fiber.NewError(http.StatusNotFound, "route not found")
+		}
+		return append(routes[:i], routes[i+1:]...), nil
+	}, http.StatusNoContent)
+}
+
+func (s *Server) setEnabled(enabled bool) fiber.Handler {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		return s.change(c, action, id, func(routes []config.RouteSpec) ([]config.RouteSpec, error) {
+			i := indexOfRoutes(routes, id)
+			if i < 0 {
+				return nil, fiber.NewError(http.StatusNotFound, "route not found")
+			}
+			routes[i].Disabled = !enabled
+			return routes, nil
+		}, http.StatusOK)
+	}
+}
+
+// FilterView describes one filter of a route's effective filter chain.
+type FilterView struct {
+	Definition config.Definition `json:"definition"`
+	// Type is the Go type implementing the filter.
+	Type string `json:"type"`
+	// Phases lists "request" and/or "response".
+	Phases []string `json:"phases"`
+	// Default is set for filters coming from the default filters.
+	Default bool `json:"default,omitempty"`
+}
+
+// filterChain describes the filters of the live route, without building them again.
+func (s *Server) filterChain(c *fiber.Ctx) error {
+	chain, ok := s.Manager.FilterChain(c.Params("id"))
+	if !ok {
+		return fiber.NewError(http.StatusNotFound, "route not found")
+	}
+
+	views := []FilterView{}
+	for _, f := range chain {
+		views = append(views, FilterView{
+			Definition: f.Definition,
+			Type:       fmt.Sprintf("%T", f.Filter),
+			Phases:     config.FilterPhases(f.Filter),
+			Default:    f.Default,
+		})
+	}
+	return c.JSON(views)
+}
+
+// ExplainRequest is the body of POST /explain.
+type ExplainRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// explain reports how the live Gateway would route a request, without proxying it.
+func (s *Server) explain(c *fiber.Ctx) error {
+	var body ExplainRequest
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid body: "+err.Error())
+	}
+	if body.Method == "" {
+		body.Method = http.MethodGet
+	}
+	req, err := http.NewRequest(strings.ToUpper(body.Method), body.URL, nil)
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	for k, v := range body.Headers {
+		req.Header.Set(k, v)
+	}
+
+	e, err := s.Manager.Gateway().ExplainRequest(req)
+	if err != nil {
+		return err
+	}
+	return c.JSON(e)
+}
+
+// change applies edit to a copy of the current routes and makes the result live.
+func (s *Server) change(c *fiber.Ctx, action, id string, edit func([]config.RouteSpec) ([]config.RouteSpec, error), status int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur := s.Manager.Config()
+	before := findRoute(cur, id)
+
+	// Pin generated IDs so that they do not shift when routes move
+	routes := make([]config.RouteSpec, len(cur.Routes))
+	for i, spec := range cur.Routes {
+		spec.ID = config.RouteID(spec, i)
+		routes[i] = spec
+	}
+
+	routes, err := edit(routes)
+	if err == nil {
+		next := *cur
+		next.Routes = routes
+		_, err = s.Manager.Apply(&next)
+		if err != nil {
+			err = fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	var after *config.RouteSpec
+	if err == nil {
+		after = findRoute(s.Manager.Config(), id)
+	}
+	s.audit(c, action, id, before, after, err)
+	if err != nil {
+		return err
+	}
+
+	if after == nil {
+		return c.SendStatus(status)
+	}
+	return c.Status(status).JSON(view(*after, indexOf(s.Manager.Config(), id)))
+}
+
+// AuditEntry is written to Server.Audit for every change attempt.
+type AuditEntry struct {
+	Time   time.Time         `json:"time"`
+	Remote string            `json:"remote"`
+	Action string            `json:"action"`
+	Route  string            `json:"route"`
+	Before *config.RouteSpec `json:"before,omitempty"`
+	After  *config.RouteSpec `json:"after,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+func (s *Server) audit(c *fiber.Ctx, action, id string, before, after *config.RouteSpec, err error) {
+	entry := AuditEntry{
+		Time:   time.Now().UTC(),
+		Remote: c.IP(),
+		Action: action,
+		Route:  id,
+		Before: before,
+		After:  after,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		s.Logger.Warn(log.AdminComponent, "Route change rejected: action=%s, route=%s, remote=%s, error=%v", action, id, entry.Remote, err)
+	} else {
+		s.Logger.Info(log.AdminComponent, "Route changed: action=%s, route=%s, remote=%s", action, id, entry.Remote)
+	}
+
+	if s.Audit != nil {
+		line, _ := json.Marshal(entry)
+		s.Audit.Write(append(line, '\n'))
+	}
+}
+
+func decodeRoute(body []byte) (config.RouteSpec, error) {
+	var spec config.RouteSpec
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return spec, fiber.NewError(http.StatusBadRequest, "invalid route: "+err.Error())
+	}
+	return spec, nil
+}
+
+func view(spec config.RouteSpec, index int) RouteView {
+	spec.ID = config.RouteID(spec, index)
+	return RouteView{RouteSpec: spec, Index: index}
+}
+
+func indexOf(cfg *config.Config, id string) int {
+	return indexOfRoutes(cfg.Routes, id)
+}
+
+func indexOfRoutes(routes []config.RouteSpec, id string) int {
+	for i, r := range routes {
+		if config.RouteID(r, i) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func findRoute(cfg *config.Config, id string) *config.RouteSpec {
+	if i := indexOf(cfg, id); i >= 0 {
+		spec := cfg.Routes[i]
+		return &spec
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testConfig = `
+default_filters:
+  - AddRequestHeader=X-Proxy, Floo
+routes:
+  - id: todos
+    predicates:
+      - Path=/todos/**
+    filters:
+      - AddResponseHeader=X-Route, todos
+    upstream: http://localhost:9000
+`
+
+// setupAdmin creates an admin app for a Manager built from testConfig.
+func setupAdmin(t *testing.T) (*fiber.App, *config.Manager, *bytes.Buffer) {
+	t.Helper()
+	cfg, err := config.Parse([]byte(testConfig), config.FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	m, err := config.NewManager(cfg, config.NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	audit := &bytes.Buffer{}
+	return New(m, "secret", audit).App(), m, audit
+}
+
+// call sends an authenticated request to the admin app.
+func call(t *testing.T, app *fiber.App, method, path, body string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	app, _, _ := setupAdmin(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 401 {
+		t.Errorf("Status code should be 401, but got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("WWW-Authenticate") == "" {
+		t.Error("Expected WWW-Authenticate header")
+	}
+}
+
+func TestAdminRouteLifecycle(t *testing.T) {
+	app, m, audit := setupAdmin(t)
+
+	// Create
+	resp, body := call(t, app, http.MethodPost, "/routes?index=0",
+		`{"id":"posts","predicates":["PathPrefix=/posts"],"upstream":"http://localhost:9001"}`)
+	if resp.StatusCode != 201 {
+		t.Fatalf("Status code should be 201, but got %d: %s", resp.StatusCode, body)
+	}
+	routes := m.Gateway().Snapshot()
+	if len(routes) != 2 || routes[0].ID != "posts" {
+		t.Fatalf("Expected posts to be the first live route, got %#v", routes)
+	}
+
+	// Duplicate
+	resp, _ = call(t, app, http.MethodPost, "/routes", `{"id":"posts","upstream":"http://localhost:9001"}`)
+	if resp.StatusCode != 409 {
+		t.Errorf("Status code should be 409, but got %d", resp.StatusCode)
+	}
+
+	// Invalid update leaves the route untouched
+	resp, body = call(t, app, http.MethodPut, "/routes/posts", `{"predicates":["Nope=/x"],"upstream":"http://localhost:9001"}`)
+	if resp.StatusCode != 400 || !strings.Contains(body, `unknown predicate "Nope"`) {
+		t.Errorf("Expected 400 for an unknown predicate, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Disable
+	resp, _ = call(t, app, http.MethodPost, "/routes/posts/disable", "")
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+	if !m.Gateway().Snapshot()[0].Disabled {
+		t.Error("Expected live route to be disabled")
+	}
+
+	// List
+	resp, body = call(t, app, http.MethodGet, "/routes", "")
+	var views []RouteView
+	if err := json.Unmarshal([]byte(body), &views); err != nil {
+		t.Fatalf("Failed to parse route list: %v", err)
+	}
+	if len(views) != 2 || views[0].ID != "posts" || !views[0].Disabled || views[1].Index != 1 {
+		t.Errorf("Unexpected route list: %s", body)
+	}
+
+	// Delete
+	resp, _ = call(t, app, http.MethodDelete, "/routes/posts", "")
+	if resp.StatusCode != 204 {
+		t.Errorf("Status code should be 204, but got %d", resp.StatusCode)
+	}
+	resp, _ = call(t, app, http.MethodGet, "/routes/posts", "")
+	if resp.StatusCode != 404 {
+		t.Errorf("Status code should be 404, but got %d", resp.StatusCode)
+	}
+
+	// Every change attempt is audited
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 audit entries, got %d:\n%s", len(lines), audit.String())
+	}
+	var entry AuditEntry
+	json.Unmarshal([]byte(lines[2]), &entry)
+	if entry.Action != "update" || entry.Route != "posts" || entry.Error == "" || entry.Before == nil {
+		t.Errorf("Unexpected audit entry: %s", lines[2])
+	}
+}
+
+func TestAdminFilterChain(t *testing.T) {
+	app, m, _ := setupAdmin(t)
+
+	// Viewing the chain must not build the filters again
+	built := 0
+	m.Registry().RegisterFilter("AddResponseHeader", config.FilterFactory{
+		Shortcut: []string{"name", "value"},
+		New: func(args config.Args) (interface{}, error) {
+			built++
+			return nil, nil
+		},
+	})
+
+	resp, body := call(t, app, http.MethodGet, "/routes/todos/filters", "")
+	if resp.StatusCode != 200 {
+		t.Fatalf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+	var chain []FilterView
+	if err := json.Unmarshal([]byte(body), &chain); err != nil {
+		t.Fatalf("Failed to parse filter chain: %v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("Expected 2 filters, got %s", body)
+	}
+	if !chain[0].Default || chain[0].Type != "filter.AddHeaderRequestFilter" || chain[0].Phases[0] != "request" {
+		t.Errorf("Unexpected default filter: %+v", chain[0])
+	}
+	if chain[1].Default || chain[1].Phases[0] != "response" {
+		t.Errorf("Unexpected route filter: %+v", chain[1])
+	}
+	if built != 0 {
+		t.Errorf("Filters should not be built, but got %d", built)
+	}
+
+	if resp, _ := call(t, app, http.MethodGet, "/routes/missing/filters", ""); resp.StatusCode != 404 {
+		t.Errorf("Status code should be 404, but got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminExplain(t *testing.T) {
+	app, _, _ := setupAdmin(t)
+
+	resp, body := call(t, app, http.MethodPost, "/explain", `{"method":"GET","url":"/todos/1"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Status code should be 200, but got %d: %s", resp.StatusCode, body)
+	}
+	var e struct {
+		RouteID     string `json:"route_id"`
+		UpstreamURL string `json:"upstream_url"`
+	}
+	if err := json.Unmarshal([]byte(body), &e); err != nil {
+		t.Fatalf("Failed to parse explanation: %v", err)
+	}
+	if e.RouteID != "todos" || e.UpstreamURL != "http://localhost:9000/todos/1" {
+		t.Errorf("Unexpected explanation: %s", body)
+	}
+}
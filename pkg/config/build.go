@@ -0,0 +1,249 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/reverseproxy"
+	"github.com/d0lim/floo/pkg/tlsutil"
+)
+
+// Build compiles the configuration into a Gateway, looking up predicates and
+// filters in reg. DefaultRegistry is used when reg is nil.
+// All problems found are reported together as Errors.
+func (c *Config) Build(reg *Registry) (*gateway.Gateway, error) {
+	gw, _, err := c.build(reg, newResources())
+	return gw, err
+}
+
+// build is Build, also returning the filter chains of the routes, see buildRoutes.
+func (c *Config) build(reg *Registry, res *resources) (*gateway.Gateway, map[string][]ChainFilter, error) {
+	routes, chains, err := c.buildRoutes(reg, res)
+	if err != nil {
+		return nil, nil, err
+	}
+	proxy, err := c.buildProxy(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.ExplainHeader != "" && c.ExplainToken == "" {
+		return nil, nil, Errors{{File: c.File, Msg: "explain_header requires explain_token"}}
+	}
+	return &gateway.Gateway{Routes: routes, ReverseProxy: proxy, ExplainHeader: c.ExplainHeader, ExplainToken: c.ExplainToken}, chains, nil
+}
+
+// Validate checks that the configuration can be built, without keeping the result.
+func (c *Config) Validate(reg *Registry) error {
+	_, err := c.Build(reg)
+	return err
+}
+
+// BuildProxy creates the ReverseProxy described by the proxy settings and
+// the TLS settings of the upstreams.
+func (c *Config) BuildProxy() (gateway.ReverseProxy, error) {
+	return c.buildProxy(newResources())
+}
+
+// buildProxy is BuildProxy, reporting failed reloads of client certificates to res.
+func (c *Config) buildProxy(res *resources) (gateway.ReverseProxy, error) {
+	tlsConfigs, err := c.buildUpstreamTLS(res)
+	if err != nil {
+		return nil, err
+	}
+	switch c.Proxy.Client {
+	case "", "net_http":
+		client := &reverseproxy.NetHTTPClient{Client: &http.Client{Timeout: c.Proxy.Timeout}}
+		for origin, cfg := range tlsConfigs {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = cfg
+			if client.Upstreams == nil {
+				client.Upstreams = map[string]*http.Client{}
+			}
+			client.Upstreams[origin] = &http.Client{Timeout: c.Proxy.Timeout, Transport: transport}
+		}
+		return &reverseproxy.NetHTTPProxy{Client: client}, nil
+	case "fiber":
+		client := reverseproxy.NewFiberHTTPClient()
+		client.Timeout = c.Proxy.Timeout
+		client.TLS = tlsConfigs
+		return &reverseproxy.FiberProxy{Client: client}, nil
+	default:
+		return nil, Errors{{File: c.File, Msg: fmt.Sprintf("unknown proxy client %q", c.Proxy.Client)}}
+	}
+}
+
+// BuildUpstreamTLS loads the TLS settings of the upstreams, by upstream
+// origin (see reverseproxy.Origin).
+func (c *Config) BuildUpstreamTLS() (map[string]*tls.Config, error) {
+	return c.buildUpstreamTLS(newResources())
+}
+
+func (c *Config) buildUpstreamTLS(res *resources) (map[string]*tls.Config, error) {
+	errs := &errorList{file: c.File}
+	configs := map[string]*tls.Config{}
+	for _, name := range c.upstreamNames() {
+		u := c.Upstreams[name]
+		if u.TLS == nil {
+			continue
+		}
+		cfg, err := tlsutil.ClientConfig{
+			CAFile:             u.TLS.CA,
+			CertFile:           u.TLS.Cert,
+			KeyFile:            u.TLS.Key,
+			ServerName:         u.TLS.ServerName,
+			MinVersion:         u.TLS.MinVersion,
+			MaxVersion:         u.TLS.MaxVersion,
+			InsecureSkipVerify: u.TLS.InsecureSkipVerify,
+			OnReloadError:      res.upstreamReloadFailed,
+		}.Build()
+		if err != nil {
+			errs.add(u.Line, u.Column, "upstream %q: tls: %v", name, err)
+			continue
+		}
+		origin := reverseproxy.Origin(u.URL)
+		if _, ok := configs[origin]; ok {
+			errs.add(u.Line, u.Column, "upstream %q: tls: another upstream with TLS settings has the origin %s", name, origin)
+			continue
+		}
+		configs[origin] = cfg
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// upstreamNames returns the names of the upstreams, sorted so that errors are
+// reported in the same order every time.
+func (c *Config) upstreamNames() []string {
+	names := make([]string, 0, len(c.Upstreams))
+	for name := range c.Upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuildRoutes compiles the route specs into gateway Routes, in order.
+func (c *Config) BuildRoutes(reg *Registry) ([]gateway.Route, error) {
+	routes, _, err := c.buildRoutes(reg, newResources())
+	return routes, err
+}
+
+// ChainFilter is a filter of a built route, with the definition it was built from.
+type ChainFilter struct {
+	Definition Definition
+	Filter     interface{}
+	// Default is set for filters coming from the default filters.
+	Default bool
+}
+
+// buildRoutes is BuildRoutes, also returning the filters of every route by
+// route ID, in the order of their definitions. Filters share the key sets
+// and other files they load through res.
+func (c *Config) buildRoutes(reg *Registry, res *resources) ([]gateway.Route, map[string][]ChainFilter, error) {
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	errs := &errorList{file: c.File}
+
+	for _, name := range c.upstreamNames() {
+		u := c.Upstreams[name]
+		if err := checkUpstreamURL(u.URL); err != nil {
+			errs.add(u.Line, u.Column, "upstream %q: %v", name, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	routes := make([]gateway.Route, 0, len(c.Routes))
+	chains := map[string][]ChainFilter{}
+	for i, spec := range c.Routes {
+		id := RouteID(spec, i)
+		if seen[id] {
+			errs.add(spec.Line, spec.Column, "duplicate route id %q", id)
+		}
+		seen[id] = true
+
+		route := gateway.Route{ID: id, Disabled: spec.Disabled}
+		chains[id] = nil
+		for _, d := range spec.Predicates {
+			p, err := reg.NewPredicate(d)
+			if err != nil {
+				errs.add(d.Line, d.Column, "route %q: %v", id, err)
+				continue
+			}
+			route.Predicates = append(route.Predicates, p)
+		}
+		for j, d := range append(append([]Definition{}, c.DefaultFilters...), spec.Filters...) {
+			f, err := reg.newFilter(d, res)
+			if err != nil {
+				errs.add(d.Line, d.Column, "route %q: %v", id, err)
+				continue
+			}
+			chains[id] = append(chains[id], ChainFilter{Definition: d, Filter: f, Default: j < len(c.DefaultFilters)})
+			if rf, ok := f.(gateway.RequestFilter); ok {
+				route.RequestFilters = append(route.RequestFilters, rf)
+			}
+			if rf, ok := f.(gateway.ResponseFilter); ok {
+				route.ResponseFilters = append(route.ResponseFilters, rf)
+			}
+		}
+
+		upstream, err := c.ResolveUpstream(spec.Upstream)
+		if err != nil {
+			errs.add(spec.Line, spec.Column, "route %q: %v", id, err)
+		}
+		route.Upstream = upstream
+
+		routes = append(routes, route)
+	}
+
+	if err := errs.err(); err != nil {
+		return nil, nil, err
+	}
+	return routes, chains, nil
+}
+
+// RouteID returns the ID of the route spec at index i, generating one if it has none.
+func RouteID(spec RouteSpec, i int) string {
+	if spec.ID != "" {
+		return spec.ID
+	}
+	return fmt.Sprintf("route-%d", i)
+}
+
+// ResolveUpstream returns the URL of a named upstream, or ref itself if it is a URL.
+func (c *Config) ResolveUpstream(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("no upstream")
+	}
+	if u, ok := c.Upstreams[ref]; ok {
+		return strings.TrimSuffix(u.URL, "/"), nil
+	}
+	if !strings.Contains(ref, "://") {
+		return "", fmt.Errorf("unknown upstream %q", ref)
+	}
+	if err := checkUpstreamURL(ref); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(ref, "/"), nil
+}
+
+func checkUpstreamURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("upstream URL %q must use http or https", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("upstream URL %q has no host", raw)
+	}
+	return nil
+}
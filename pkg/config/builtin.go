@@ -0,0 +1,633 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/geoip"
+	"github.com/d0lim/floo/pkg/mirror"
+	"github.com/d0lim/floo/pkg/oidc"
+	"github.com/d0lim/floo/pkg/predicate"
+)
+
+// registerBuiltins registers the predicates and filters shipped with Floo.
+func registerBuiltins(r *Registry) {
+	// Path=/api/** matches a glob pattern, or the exact path if it has no wildcards
+	r.RegisterPredicate("Path", PredicateFactory{
+		Shortcut: []string{"pattern"},
+		New: func(args Args) (gateway.Predicate, error) {
+			pattern, err := args.String("pattern")
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(pattern, "/") {
+				return nil, fmt.Errorf("pattern %q must start with /", pattern)
+			}
+			if strings.ContainsAny(pattern, "*?[") {
+				return predicate.PathPatternPredicate{Pattern: pattern}, nil
+			}
+			return predicate.PathPredicate{Path: pattern}, nil
+		},
+	})
+
+	// PathPrefix=/api
+	r.RegisterPredicate("PathPrefix", PredicateFactory{
+		Shortcut: []string{"prefix"},
+		New: func(args Args) (gateway.Predicate, error) {
+			prefix, err := args.String("prefix")
+			if err != nil {
+				return nil, err
+			}
+			return predicate.PathPrefixPredicate{Prefix: prefix}, nil
+		},
+	})
+
+	// Method=GET
+	r.RegisterPredicate("Method", PredicateFactory{
+		Shortcut: []string{"method"},
+		New: func(args Args) (gateway.Predicate, error) {
+			method, err := args.String("method")
+			if err != nil {
+				return nil, err
+			}
+			return predicate.MethodPredicate{Method: strings.ToUpper(method)}, nil
+		},
+	})
+
+	// AddRequestHeader=X-Proxy, Floo
+	r.RegisterFilter("AddRequestHeader", FilterFactory{
+		Shortcut: []string{"name", "value"},
+		New: func(args Args) (interface{}, error) {
+			name, value, err := headerArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			return filter.AddHeaderRequestFilter{Key: name, Value: value}, nil
+		},
+	})
+
+	// AddResponseHeader=X-Served-By, Floo
+	r.RegisterFilter("AddResponseHeader", FilterFactory{
+		Shortcut: []string{"name", "value"},
+		New: func(args Args) (interface{}, error) {
+			name, value, err := headerArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			return filter.AddHeaderResponseFilter{Key: name, Value: value}, nil
+		},
+	})
+
+	// RewritePath=^/api/(.*), /$1
+	r.RegisterFilter("RewritePath", FilterFactory{
+		Shortcut: []string{"regexp", "replacement"},
+		New: func(args Args) (interface{}, error) {
+			expr, err := args.String("regexp")
+			if err != nil {
+				return nil, err
+			}
+			replacement, err := args.String("replacement")
+			if err != nil {
+				return nil, err
+			}
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, err
+			}
+			return filter.RewritePathRequestFilter{Pattern: pattern, Replacement: replacement}, nil
+		},
+	})
+
+	// RequestID=X-Request-ID, uuidv7 reuses the client's ID unless trust is false
+	r.RegisterFilter("RequestID", FilterFactory{
+		Shortcut: []string{"header", "format"},
+		New: func(args Args) (interface{}, error) {
+			header, err := args.StringOr("header", filter.DefaultRequestIDHeader)
+			if err != nil {
+				return nil, err
+			}
+			format, err := args.StringOr("format", "uuidv4")
+			if err != nil {
+				return nil, err
+			}
+			trust, err := args.Bool("trust", true)
+			if err != nil {
+				return nil, err
+			}
+			generate, err := filter.RequestIDGenerator(format)
+			if err != nil {
+				return nil, err
+			}
+			return filter.RequestIDFilter{Header: header, Generate: generate, Trust: trust}, nil
+		},
+	})
+
+	// AuthJWT=https://issuer/.well-known/jwks.json requires a bearer JWT signed by a key of the JWKS
+	r.RegisterFilter("AuthJWT", FilterFactory{
+		Shortcut: []string{"jwks"},
+		newShared: func(args Args, res *resources) (interface{}, error) {
+			source, err := args.String("jwks")
+			if err != nil {
+				return nil, err
+			}
+			f := filter.AuthJWTFilter{Keys: sharedJWKS(res, source)}
+			if f.Issuer, err = args.StringOr("issuer", ""); err != nil {
+				return nil, err
+			}
+			if f.Audience, err = args.Strings("audience"); err != nil {
+				return nil, err
+			}
+			if f.Algorithms, err = args.Strings("algorithms"); err != nil {
+				return nil, err
+			}
+			for _, alg := range f.Algorithms {
+				if !slices.Contains(filter.JWTAlgorithms, alg) {
+					return nil, fmt.Errorf("unsupported algorithm %q", alg)
+				}
+			}
+			skew, err := args.StringOr("clock_skew", "30s")
+			if err != nil {
+				return nil, err
+			}
+			if f.ClockSkew, err = time.ParseDuration(skew); err != nil {
+				return nil, fmt.Errorf("clock_skew %q: %v", skew, err)
+			}
+			if f.AllowNoExpiry, err = args.Bool("allow_no_expiry", false); err != nil {
+				return nil, err
+			}
+			if f.RequiredClaims, err = args.StringMap("claims"); err != nil {
+				return nil, err
+			}
+			if f.Scopes, err = args.Strings("scopes"); err != nil {
+				return nil, err
+			}
+			if f.ForwardClaims, err = args.StringMap("forward"); err != nil {
+				return nil, err
+			}
+			if f.Realm, err = args.StringOr("realm", ""); err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	})
+
+	// AuthAPIKey=keys.yaml requires an API key listed in the file
+	r.RegisterFilter("AuthAPIKey", FilterFactory{
+		Shortcut: []string{"keys"},
+		newShared: func(args Args, res *resources) (interface{}, error) {
+			path, err := args.String("keys")
+			if err != nil {
+				return nil, err
+			}
+			store, err := sharedKeyStore(res, path)
+			if err != nil {
+				return nil, err
+			}
+			f := filter.AuthAPIKeyFilter{Store: store}
+			if f.Header, err = args.StringOr("header", ""); err != nil {
+				return nil, err
+			}
+			if f.Query, err = args.StringOr("query", ""); err != nil {
+				return nil, err
+			}
+			if f.Cookie, err = args.StringOr("cookie", ""); err != nil {
+				return nil, err
+			}
+			if f.ForwardKey, err = args.Bool("forward_key", false); err != nil {
+				return nil, err
+			}
+			if f.ConsumerHeader, err = args.StringOr("consumer_header", ""); err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	})
+
+	// AuthIntrospect=https://idp/oauth2/introspect requires a bearer token the endpoint reports active
+	r.RegisterFilter("AuthIntrospect", FilterFactory{
+		Shortcut: []string{"endpoint"},
+		New: func(args Args) (interface{}, error) {
+			endpoint, err := args.String("endpoint")
+			if err != nil {
+				return nil, err
+			}
+			if u, err := url.Parse(endpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("endpoint %q must be an http or https URL", endpoint)
+			}
+			f := filter.NewAuthIntrospectionFilter(endpoint)
+			if f.ClientID, err = args.StringOr("client_id", ""); err != nil {
+				return nil, err
+			}
+			if f.ClientSecret, err = args.StringOr("client_secret", ""); err != nil {
+				return nil, err
+			}
+			if f.Scopes, err = args.Strings("scopes"); err != nil {
+				return nil, err
+			}
+			if f.Audience, err = args.Strings("audience"); err != nil {
+				return nil, err
+			}
+			for name, target := range map[string]*time.Duration{"cache_ttl": &f.CacheTTL, "negative_ttl": &f.NegativeTTL, "timeout": &f.Timeout} {
+				value, err := args.StringOr(name, target.String())
+				if err != nil {
+					return nil, err
+				}
+				if *target, err = time.ParseDuration(value); err != nil {
+					return nil, fmt.Errorf("%s %q: %v", name, value, err)
+				}
+			}
+			if f.ForwardClaims, err = args.StringMap("forward"); err != nil {
+				return nil, err
+			}
+			if f.Realm, err = args.StringOr("realm", ""); err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	})
+
+	// OIDC requires a login at an OpenID Connect provider, e.g. for internal dashboards
+	r.RegisterFilter("OIDC", FilterFactory{
+		Shortcut: []string{"issuer", "client_id"},
+		New: func(args Args) (interface{}, error) {
+			issuer, err := args.String("issuer")
+			if err != nil {
+				return nil, err
+			}
+			clientID, err := args.String("client_id")
+			if err != nil {
+				return nil, err
+			}
+			clientSecret, err := args.StringOr("client_secret", "")
+			if err != nil {
+				return nil, err
+			}
+			secret, err := args.String("cookie_secret")
+			if err != nil {
+				return nil, err
+			}
+			f, err := oidc.New(issuer, clientID, clientSecret, []byte(secret))
+			if err != nil {
+				return nil, err
+			}
+			for name, target := range map[string]*string{
+				"redirect_url":     &f.RedirectURL,
+				"logout_path":      &f.LogoutPath,
+				"post_logout_url":  &f.PostLogoutRedirectURL,
+				"cookie_name":      &f.CookieName,
+				"forward_id_token": &f.IDTokenHeader,
+			} {
+				if *target, err = args.StringOr(name, *target); err != nil {
+					return nil, err
+				}
+			}
+			if f.Scopes, err = args.Strings("scopes"); err != nil {
+				return nil, err
+			}
+			if f.ForwardClaims, err = args.StringMap("forward"); err != nil {
+				return nil, err
+			}
+			if f.InsecureCookie, err = args.Bool("insecure_cookie", false); err != nil {
+				return nil, err
+			}
+			lifetime, err := args.StringOr("session_lifetime", f.SessionLifetime.String())
+			if err != nil {
+				return nil, err
+			}
+			if f.SessionLifetime, err = time.ParseDuration(lifetime); err != nil {
+				return nil, fmt.Errorf("session_lifetime %q: %v", lifetime, err)
+			}
+			return f, nil
+		},
+	})
+
+	// HMACSign signs requests sent upstream with the key named by key_id
+	r.RegisterFilter("HMACSign", FilterFactory{
+		New: func(args Args) (interface{}, error) {
+			keys, err := hmacKeys(args)
+			if err != nil {
+				return nil, err
+			}
+			return filter.HMACSignRequestFilter{Keys: keys}, nil
+		},
+	})
+
+	// HMACVerify rejects requests not signed with one of the keys, e.g. webhooks
+	r.RegisterFilter("HMACVerify", FilterFactory{
+		New: func(args Args) (interface{}, error) {
+			keys, err := hmacKeys(args)
+			if err != nil {
+				return nil, err
+			}
+			f := filter.HMACVerifyRequestFilter{Keys: keys}
+			skew, err := args.StringOr("max_skew", filter.DefaultHMACMaxSkew.String())
+			if err != nil {
+				return nil, err
+			}
+			if f.MaxSkew, err = time.ParseDuration(skew); err != nil {
+				return nil, fmt.Errorf("max_skew %q: %v", skew, err)
+			}
+			return f, nil
+		},
+	})
+
+	// ClientCert=X-Forwarded-Client-Cert forwards the verified TLS client certificate
+	r.RegisterFilter("ClientCert", FilterFactory{
+		Shortcut: []string{"header"},
+		New: func(args Args) (interface{}, error) {
+			var f filter.ClientCertRequestFilter
+			var err error
+			if f.Header, err = args.StringOr("header", filter.DefaultClientCertHeader); err != nil {
+				return nil, err
+			}
+			if f.Required, err = args.Bool("required", false); err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	})
+
+	// CORS=https://app.example.com lets browsers on that origin call the route
+	r.RegisterFilter("CORS", FilterFactory{
+		Shortcut: []string{"origins"},
+		New: func(args Args) (interface{}, error) {
+			origins, err := args.Strings("origins")
+			if err != nil {
+				return nil, err
+			}
+			if len(origins) == 0 {
+				return nil, fmt.Errorf("missing argument %q", "origins")
+			}
+			credentials, err := args.Bool("credentials", false)
+			if err != nil {
+				return nil, err
+			}
+			f, err := filter.NewCORSFilter(origins, credentials)
+			if err != nil {
+				return nil, err
+			}
+			if f.Methods, err = args.Strings("methods"); err != nil {
+				return nil, err
+			}
+			if f.Headers, err = args.Strings("headers"); err != nil {
+				return nil, err
+			}
+			if f.ExposedHeaders, err = args.Strings("exposed_headers"); err != nil {
+				return nil, err
+			}
+			maxAge, err := args.StringOr("max_age", "0s")
+			if err != nil {
+				return nil, err
+			}
+			if f.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+				return nil, fmt.Errorf("max_age %q: %v", maxAge, err)
+			}
+			return f, nil
+		},
+	})
+
+	// SecureHeaders sets security headers and hides the upstream's server software
+	r.RegisterFilter("SecureHeaders", FilterFactory{
+		New: func(args Args) (interface{}, error) {
+			f := filter.NewSecureHeadersResponseFilter()
+			var err error
+			for name, value := range map[string]*string{
+				"hsts":                 &f.StrictTransportSecurity,
+				"content_type_options": &f.ContentTypeOptions,
+				"frame_options":        &f.FrameOptions,
+				"csp":                  &f.ContentSecurityPolicy,
+				"referrer_policy":      &f.ReferrerPolicy,
+				"permissions_policy":   &f.PermissionsPolicy,
+			} {
+				if *value, err = args.StringOr(name, *value); err != nil {
+					return nil, err
+				}
+			}
+			// A list, even empty, replaces the default headers removed
+			if _, ok := args["remove"]; ok {
+				if f.Remove, err = args.Strings("remove"); err != nil {
+					return nil, err
+				}
+			}
+			if f.Override, err = args.Bool("override", false); err != nil {
+				return nil, err
+			}
+			return f, nil
+		},
+	})
+
+	// IPAccess allows or denies clients by address and country
+	r.RegisterFilter("IPAccess", FilterFactory{
+		newShared: func(args Args, res *resources) (interface{}, error) {
+			var f filter.IPAccessRequestFilter
+			var err error
+			if f.Allow, err = ipList(args, "allow", res); err != nil {
+				return nil, err
+			}
+			if f.Deny, err = ipList(args, "deny", res); err != nil {
+				return nil, err
+			}
+			if f.TrustedProxies, err = ipList(args, "trusted_proxies", res); err != nil {
+				return nil, err
+			}
+			if f.Header, err = args.StringOr("header", filter.DefaultClientIPHeader); err != nil {
+				return nil, err
+			}
+			if f.Status, err = args.Int("status", 403); err != nil {
+				return nil, err
+			}
+			if f.Status < 400 || f.Status > 599 {
+				return nil, fmt.Errorf("status %d must be between 400 and 599", f.Status)
+			}
+
+			if f.AllowCountries, err = args.Strings("allow_countries"); err != nil {
+				return nil, err
+			}
+			if f.DenyCountries, err = args.Strings("deny_countries"); err != nil {
+				return nil, err
+			}
+			for _, country := range append(slices.Clone(f.AllowCountries), f.DenyCountries...) {
+				if len(country) != 2 {
+					return nil, fmt.Errorf("country %q must be an ISO 3166-1 alpha-2 code such as DE", country)
+				}
+			}
+			path, err := args.StringOr("geoip", "")
+			if err != nil {
+				return nil, err
+			}
+			if path == "" && (len(f.AllowCountries) > 0 || len(f.DenyCountries) > 0) {
+				return nil, fmt.Errorf("missing argument %q, required with countries", "geoip")
+			}
+			if path != "" {
+				if f.Countries, err = sharedGeoIP(res, path); err != nil {
+					return nil, err
+				}
+			}
+			return f, nil
+		},
+	})
+
+	// Mirror=http://shadow:8080, 10 copies 10% of the requests to a shadow upstream
+	r.RegisterFilter("Mirror", FilterFactory{
+		Shortcut: []string{"shadow", "percent"},
+		newShared: func(args Args, res *resources) (interface{}, error) {
+			shadow, err := args.String("shadow")
+			if err != nil {
+				return nil, err
+			}
+			if u, err := url.Parse(shadow); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, fmt.Errorf("shadow %q must be an http or https URL", shadow)
+			}
+			percent, err := args.Float("percent", 100)
+			if err != nil {
+				return nil, err
+			}
+			if percent < 0 || percent > 100 {
+				return nil, fmt.Errorf("percent %v must be between 0 and 100", percent)
+			}
+			queue, err := args.Int("queue", mirror.DefaultQueueSize)
+			if err != nil {
+				return nil, err
+			}
+			workers, err := args.Int("workers", mirror.DefaultWorkers)
+			if err != nil {
+				return nil, err
+			}
+			compare, err := args.Bool("compare", false)
+			if err != nil {
+				return nil, err
+			}
+			timeout, err := args.StringOr("timeout", mirror.DefaultTimeout.String())
+			if err != nil {
+				return nil, err
+			}
+			m := mirror.New(shadow, percent, queue, workers)
+			m.Compare = compare
+			if res.logger != nil {
+				m.Logger = managerLogger{res: res}
+			}
+			if m.Timeout, err = time.ParseDuration(timeout); err != nil {
+				return nil, fmt.Errorf("timeout %q: %v", timeout, err)
+			}
+			return m, nil
+		},
+	})
+}
+
+// sharedJWKS returns the JWKS of source in res, so that keys are not fetched
+// again on every reload.
+func sharedJWKS(res *resources, source string) *filter.JWKS {
+	keys, _ := res.get("jwks:"+source, func() (interface{}, error) {
+		return filter.NewJWKS(source), nil
+	})
+	return keys.(*filter.JWKS)
+}
+
+// sharedKeyStore returns the FileKeyStore of path in res.
+func sharedKeyStore(res *resources, path string) (*filter.FileKeyStore, error) {
+	store, err := res.get("keystore:"+path, func() (interface{}, error) {
+		store, err := filter.NewFileKeyStore(path)
+		if err != nil {
+			return nil, err
+		}
+		store.OnReloadError = res.reloadFailed
+		return store, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.(*filter.FileKeyStore), nil
+}
+
+// sharedGeoIP returns the geoip.DB of path in res, so that it is not read
+// again on every reload.
+func sharedGeoIP(res *resources, path string) (*geoip.DB, error) {
+	db, err := res.get("geoip:"+path, func() (interface{}, error) {
+		db, err := geoip.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		db.OnReloadError = res.reloadFailed
+		return db, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.(*geoip.DB), nil
+}
+
+// ipList reads the IP ranges of the named argument and of the file named by
+// name_file, or returns nil if both are missing.
+func ipList(args Args, name string, res *resources) (*filter.IPList, error) {
+	entries, err := args.Strings(name)
+	if err != nil {
+		return nil, err
+	}
+	path, err := args.StringOr(name+"_file", "")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 && path == "" {
+		return nil, nil
+	}
+	l, err := filter.NewIPList(entries, path)
+	if err != nil {
+		return nil, err
+	}
+	l.OnReloadError = res.reloadFailed
+	return l, nil
+}
+
+// hmacKeys reads the keys argument, a map of key IDs to secrets. The key
+// named by key_id signs requests; it can be omitted when there is one key.
+func hmacKeys(args Args) (*filter.HMACKeys, error) {
+	secrets, err := args.StringMap("keys")
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("missing argument %q", "keys")
+	}
+	ids := make([]string, 0, len(secrets))
+	for id := range secrets {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	signing, err := args.StringOr("key_id", "")
+	if err != nil {
+		return nil, err
+	}
+	if signing == "" && len(ids) > 1 {
+		return nil, fmt.Errorf("missing argument %q, required with several keys", "key_id")
+	}
+	if signing == "" {
+		signing = ids[0]
+	}
+	if _, ok := secrets[signing]; !ok {
+		return nil, fmt.Errorf("key_id %q is not one of the keys", signing)
+	}
+
+	keys := []filter.HMACKey{{ID: signing, Secret: []byte(secrets[signing])}}
+	for _, id := range ids {
+		if id != signing {
+			keys = append(keys, filter.HMACKey{ID: id, Secret: []byte(secrets[id])})
+		}
+	}
+	return filter.NewHMACKeys(keys...), nil
+}
+
+func headerArgs(args Args) (name, value string, err error) {
+	if name, err = args.String("name"); err != nil {
+		return "", "", err
+	}
+	if value, err = args.String("value"); err != nil {
+		return "", "", err
+	}
+	return name, value, nil
+}
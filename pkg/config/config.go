@@ -0,0 +1,376 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d0lim/floo/pkg/listener"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a configuration file.
+type Format int
+
+const (
+	// FormatYAML parses the configuration as YAML.
+	FormatYAML Format = iota
+	// FormatJSON parses the configuration as JSON.
+	FormatJSON
+)
+
+// FormatOf guesses the Format from a file name, defaulting to YAML.
+func FormatOf(filename string) Format {
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Config is the declarative description of a Gateway.
+type Config struct {
+	// Proxy selects and tunes the ReverseProxy shared by all routes.
+	Proxy ProxySpec `yaml:"proxy" json:"proxy"`
+	// Upstreams names upstream services that routes can refer to.
+	Upstreams map[string]UpstreamSpec `yaml:"upstreams" json:"upstreams,omitempty"`
+	// DefaultFilters are applied to every route, before the route's own filters.
+	DefaultFilters []Definition `yaml:"default_filters" json:"default_filters,omitempty"`
+	// Routes are matched in order.
+	Routes []RouteSpec `yaml:"routes" json:"routes"`
+	// ExplainHeader enables match explanations for requests carrying this
+	// header with ExplainToken as its value. See gateway.Gateway.ExplainHeader.
+	ExplainHeader string `yaml:"explain_header" json:"explain_header,omitempty"`
+	ExplainToken  string `yaml:"explain_token" json:"explain_token,omitempty"`
+	// Listeners are the addresses the gateway is served on, with their TLS
+	// settings. When empty, floo serve uses its --listen and --tls-* flags.
+	Listeners []listener.Spec `yaml:"listeners" json:"listeners,omitempty"`
+
+	// File is the name the configuration was read from, used in error messages.
+	File string `yaml:"-" json:"-"`
+}
+
+// ProxySpec configures the ReverseProxy.
+type ProxySpec struct {
+	// Client is the HTTP client implementation: "net_http" (default) or "fiber".
+	Client string `yaml:"client" json:"client,omitempty"`
+	// Timeout bounds each upstream call. Zero means no timeout.
+	Timeout time.Duration `yaml:"timeout" json:"timeout,omitempty"`
+}
+
+// UpstreamSpec describes a named upstream service.
+// In YAML and JSON it can also be written as a plain URL string.
+type UpstreamSpec struct {
+	URL string `yaml:"url" json:"url"`
+	// TLS configures HTTPS connections to the upstream.
+	TLS *TLSSpec `yaml:"tls" json:"tls,omitempty"`
+
+	Line   int `yaml:"-" json:"-"`
+	Column int `yaml:"-" json:"-"`
+}
+
+// TLSSpec configures TLS connections to an upstream. Certificate files are
+// reloaded when they change.
+type TLSSpec struct {
+	// CA is a PEM file of the certificates trusted to sign the upstream's
+	// certificate, instead of the system roots.
+	CA string `yaml:"ca" json:"ca,omitempty"`
+	// Cert and Key are the client certificate sent for mutual TLS.
+	Cert string `yaml:"cert" json:"cert,omitempty"`
+	Key  string `yaml:"key" json:"key,omitempty"`
+	// ServerName overrides the name sent with SNI and checked in the
+	// upstream's certificate.
+	ServerName string `yaml:"server_name" json:"server_name,omitempty"`
+	// MinVersion and MaxVersion bound the TLS version, e.g. "1.2".
+	MinVersion string `yaml:"min_version" json:"min_version,omitempty"`
+	MaxVersion string `yaml:"max_version" json:"max_version,omitempty"`
+	// InsecureSkipVerify accepts any upstream certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
+}
+
+// RouteSpec describes a single route.
+type RouteSpec struct {
+	// ID identifies the route. It defaults to "route-<index>".
+	ID         string       `yaml:"id" json:"id"`
+	Predicates []Definition `yaml:"predicates" json:"predicates,omitempty"`
+	Filters    []Definition `yaml:"filters" json:"filters,omitempty"`
+	// Upstream is either the name of an entry in Config.Upstreams or a URL.
+	Upstream string `yaml:"upstream" json:"upstream"`
+	// Disabled routes are kept in the table but never match.
+	Disabled bool `yaml:"disabled" json:"disabled,omitempty"`
+
+	Line   int `yaml:"-" json:"-"`
+	Column int `yaml:"-" json:"-"`
+}
+
+// Definition refers to a registered predicate or filter by name.
+// It is written either in shortcut form, "Name=arg1, arg2", or as a mapping
+// with a name and named arguments:
+//
+//	filters:
+//	  - AddRequestHeader=X-Proxy, Floo
+//	  - name: AddRequestHeader
+//	    args:
+//	      name: X-Proxy
+//	      value: Floo
+type Definition struct {
+	Name string
+	// Shortcut holds the positional arguments of the shortcut form.
+	Shortcut []string
+	// Args holds the named arguments of the mapping form.
+	Args map[string]interface{}
+
+	Line   int
+	Column int
+}
+
+// String returns the shortcut form of the definition when it has no named arguments.
+func (d Definition) String() string {
+	if d.Args == nil {
+		if len(d.Shortcut) == 0 {
+			return d.Name
+		}
+		return d.Name + "=" + strings.Join(d.Shortcut, ", ")
+	}
+	args, _ := json.Marshal(d.Args)
+	return d.Name + string(args)
+}
+
+// ParseDefinition parses the shortcut form "Name=arg1, arg2".
+func ParseDefinition(s string) Definition {
+	name, args, found := strings.Cut(s, "=")
+	d := Definition{Name: strings.TrimSpace(name)}
+	if found {
+		for _, arg := range strings.Split(args, ",") {
+			d.Shortcut = append(d.Shortcut, strings.TrimSpace(arg))
+		}
+	}
+	return d
+}
+
+// UnmarshalYAML accepts both the shortcut and the mapping form.
+func (d *Definition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*d = ParseDefinition(node.Value)
+	case yaml.MappingNode:
+		if err := checkKeys(node, "name", "args"); err != nil {
+			return err
+		}
+		var raw struct {
+			Name string    `yaml:"name"`
+			Args yaml.Node `yaml:"args"`
+		}
+		if err := node.Decode(&raw); err != nil {
+			return err
+		}
+		*d = Definition{Name: raw.Name}
+		switch raw.Args.Kind {
+		case 0:
+			d.Args = map[string]interface{}{}
+		case yaml.MappingNode:
+			if err := raw.Args.Decode(&d.Args); err != nil {
+				return err
+			}
+		case yaml.SequenceNode:
+			if err := raw.Args.Decode(&d.Shortcut); err != nil {
+				return err
+			}
+		default:
+			return nodeError(&raw.Args, "args must be a mapping or a list")
+		}
+	default:
+		return nodeError(node, "expected a definition string or mapping")
+	}
+	d.Line, d.Column = node.Line, node.Column
+	if d.Name == "" {
+		return nodeError(node, "definition has no name")
+	}
+	return nil
+}
+
+// MarshalYAML writes the shortcut form when possible.
+func (d Definition) MarshalYAML() (interface{}, error) {
+	if d.Args == nil {
+		return d.String(), nil
+	}
+	return struct {
+		Name string                 `yaml:"name"`
+		Args map[string]interface{} `yaml:"args,omitempty"`
+	}{d.Name, d.Args}, nil
+}
+
+// MarshalJSON writes the shortcut form when possible.
+func (d Definition) MarshalJSON() ([]byte, error) {
+	v, _ := d.MarshalYAML()
+	if s, ok := v.(string); ok {
+		return json.Marshal(s)
+	}
+	return json.Marshal(struct {
+		Name string                 `json:"name"`
+		Args map[string]interface{} `json:"args,omitempty"`
+	}{d.Name, d.Args})
+}
+
+// UnmarshalJSON accepts the same forms as UnmarshalYAML.
+func (d *Definition) UnmarshalJSON(data []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if len(node.Content) == 0 {
+		return errors.New("empty definition")
+	}
+	return d.UnmarshalYAML(node.Content[0])
+}
+
+// UnmarshalYAML accepts either a URL string or a mapping.
+func (u *UpstreamSpec) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		u.URL = node.Value
+	case yaml.MappingNode:
+		if err := checkKeys(node, "url", "tls"); err != nil {
+			return err
+		}
+		type plain UpstreamSpec
+		if err := node.Decode((*plain)(u)); err != nil {
+			return err
+		}
+	default:
+		return nodeError(node, "upstream must be a URL or a mapping")
+	}
+	u.Line, u.Column = node.Line, node.Column
+	return nil
+}
+
+// UnmarshalYAML rejects unknown keys.
+func (t *TLSSpec) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKeys(node, "ca", "cert", "key", "server_name", "min_version", "max_version", "insecure_skip_verify"); err != nil {
+		return err
+	}
+	type plain TLSSpec
+	return node.Decode((*plain)(t))
+}
+
+// UnmarshalYAML records the position of the route and rejects unknown keys.
+func (r *RouteSpec) UnmarshalYAML(node *yaml.Node) error {
+	if err := checkKeys(node, "id", "predicates", "filters", "upstream", "disabled"); err != nil {
+		return err
+	}
+	type plain RouteSpec
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.Line, r.Column = node.Line, node.Column
+	return nil
+}
+
+// LoadFile reads and parses the configuration file at path.
+// The format is chosen by the file extension.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, FormatOf(path), path)
+}
+
+// Parse parses a configuration document. filename is only used in error messages.
+func Parse(data []byte, format Format, filename string) (*Config, error) {
+	if format == FormatJSON {
+		// JSON is a subset of YAML, so only check the syntax here to get
+		// precise positions, then decode through the YAML parser.
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line, column := position(data, syntaxErr.Offset)
+				return nil, Errors{{File: filename, Line: line, Column: column, Msg: syntaxErr.Error()}}
+			}
+			return nil, Errors{{File: filename, Msg: err.Error()}}
+		}
+	}
+
+	cfg := &Config{File: filename}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, convertYAMLError(err, filename)
+	}
+	cfg.File = filename
+	return cfg, nil
+}
+
+// checkKeys reports the first key of a mapping node that is not allowed.
+func checkKeys(node *yaml.Node, allowed ...string) error {
+	if node.Kind != yaml.MappingNode {
+		return nodeError(node, "expected a mapping")
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		known := false
+		for _, a := range allowed {
+			if key.Value == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nodeError(key, "unknown field %q", key.Value)
+		}
+	}
+	return nil
+}
+
+func nodeError(node *yaml.Node, format string, v ...interface{}) *Error {
+	return &Error{Line: node.Line, Column: node.Column, Msg: fmt.Sprintf(format, v...)}
+}
+
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// convertYAMLError turns errors of the YAML decoder into Errors with positions.
+func convertYAMLError(err error, filename string) error {
+	var cfgErr *Error
+	if errors.As(err, &cfgErr) {
+		cfgErr.File = filename
+		return Errors{cfgErr}
+	}
+
+	var msgs []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	var errs Errors
+	for _, msg := range msgs {
+		e := &Error{File: filename, Msg: msg}
+		if m := yamlLinePattern.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Msg = m[2]
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
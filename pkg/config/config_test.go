@@ -0,0 +1,347 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testYAML = `
+proxy:
+  timeout: 5s
+upstreams:
+  placeholder: https://jsonplaceholder.typicode.com
+  echo:
+    url: https://postman-echo.com/
+default_filters:
+  - AddRequestHeader=X-Proxy, Floo
+routes:
+  - id: todos
+    predicates:
+      - Path=/todos/**
+      - Method=get
+    upstream: placeholder
+  - predicates:
+      - PathPrefix=/echo
+    filters:
+      - name: RewritePath
+        args:
+          regexp: ^/echo/(.*)
+          replacement: /$1
+      - AddResponseHeader=X-Served-By, Floo
+    upstream: echo
+`
+
+func TestParseAndBuildYAML(t *testing.T) {
+	cfg, err := Parse([]byte(testYAML), FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	gw, err := cfg.Build(NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	if len(gw.Routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(gw.Routes))
+	}
+
+	todos := gw.Routes[0]
+	if todos.ID != "todos" {
+		t.Errorf("Expected route id 'todos', got '%s'", todos.ID)
+	}
+	if _, ok := todos.Predicates[0].(predicate.PathPatternPredicate); !ok {
+		t.Errorf("Expected PathPatternPredicate, got %T", todos.Predicates[0])
+	}
+	if m, ok := todos.Predicates[1].(predicate.MethodPredicate); !ok || m.Method != "GET" {
+		t.Errorf("Expected MethodPredicate for GET, got %#v", todos.Predicates[1])
+	}
+	if todos.Upstream != "https://jsonplaceholder.typicode.com" {
+		t.Errorf("Unexpected upstream %s", todos.Upstream)
+	}
+	if h, ok := todos.RequestFilters[0].(filter.AddHeaderRequestFilter); !ok || h.Key != "X-Proxy" || h.Value != "Floo" {
+		t.Errorf("Expected default AddRequestHeader filter, got %#v", todos.RequestFilters[0])
+	}
+
+	echo := gw.Routes[1]
+	if echo.ID != "route-1" {
+		t.Errorf("Expected generated route id 'route-1', got '%s'", echo.ID)
+	}
+	if len(echo.RequestFilters) != 2 || len(echo.ResponseFilters) != 1 {
+		t.Errorf("Expected 2 request and 1 response filters, got %d and %d",
+			len(echo.RequestFilters), len(echo.ResponseFilters))
+	}
+	if echo.Upstream != "https://postman-echo.com" {
+		t.Errorf("Unexpected upstream %s", echo.Upstream)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{
+	"routes": [
+		{
+			"id": "api",
+			"predicates": ["Path=/api/*/items", {"name": "Method", "args": {"method": "POST"}}],
+			"upstream": "http://localhost:9000"
+		}
+	]
+}`
+	cfg, err := Parse([]byte(data), FormatJSON, "routes.json")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	routes, err := cfg.BuildRoutes(nil)
+	if err != nil {
+		t.Fatalf("Failed to build routes: %v", err)
+	}
+	if len(routes) != 1 || len(routes[0].Predicates) != 2 {
+		t.Fatalf("Unexpected routes: %#v", routes)
+	}
+}
+
+func TestErrorsHaveLineNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   []string
+	}{
+		{
+			name:   "unknown predicate",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    predicates:\n      - Pth=/a\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": unknown predicate "Pth"`},
+		},
+		{
+			name:   "unknown upstream and bad filter args",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - AddRequestHeader=X-Only\n    upstream: missing\n",
+			want: []string{
+				`routes.yaml:4:9: route "a": filter AddRequestHeader: missing argument "value"`,
+				`routes.yaml:2:5: route "a": unknown upstream "missing"`,
+			},
+		},
+		{
+			name:   "bad mirror percent",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - Mirror=http://shadow, 150\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter Mirror: percent 150 must be between 0 and 100`},
+		},
+		{
+			name:   "short OIDC cookie secret",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: OIDC\n        args: { issuer: https://idp, client_id: dash, cookie_secret: short }\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter OIDC: cookie secret must be at least 32 bytes`},
+		},
+		{
+			name:   "ambiguous HMAC signing key",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: HMACSign\n        args: { keys: { k1: one, k2: two } }\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter HMACSign: missing argument "key_id", required with several keys`},
+		},
+		{
+			name:   "bad CORS origin pattern",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - CORS=regex:(app\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter CORS: origin "regex:(app": error parsing regexp`},
+		},
+		{
+			name:   "CORS any origin with credentials",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: CORS\n        args:\n          origins: \"*\"\n          credentials: true\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter CORS: origin "*" cannot be used with credentials`},
+		},
+		{
+			name:   "bad SecureHeaders value",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: SecureHeaders\n        args: { csp: [default-src, self] }\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter SecureHeaders: argument "csp" must be a string`},
+		},
+		{
+			name:   "IP access countries without database",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: IPAccess\n        args: { deny: [10.0.0.0/8], deny_countries: [RU] }\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter IPAccess: missing argument "geoip", required with countries`},
+		},
+		{
+			name:   "invalid IP range",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    filters:\n      - name: IPAccess\n        args: { allow: 10.0.0.0/33 }\n    upstream: http://a\n",
+			want:   []string{`routes.yaml:4:9: route "a": filter IPAccess: invalid IP range "10.0.0.0/33"`},
+		},
+		{
+			name:   "unknown upstream TLS field",
+			format: FormatYAML,
+			data:   "upstreams:\n  a:\n    url: https://a\n    tls:\n      ca_file: ca.pem\n",
+			want:   []string{`routes.yaml:5:7: unknown field "ca_file"`},
+		},
+		{
+			name:   "bad upstream URLs in name order",
+			format: FormatYAML,
+			data:   "upstreams:\n  zeta: ftp://z\n  alpha: ftp://a\n  mid: ftp://m\n",
+			want: []string{"routes.yaml:3:10: upstream \"alpha\": upstream URL \"ftp://a\" must use http or https\n" +
+				"routes.yaml:4:8: upstream \"mid\": upstream URL \"ftp://m\" must use http or https\n" +
+				"routes.yaml:2:9: upstream \"zeta\""},
+		},
+		{
+			name:   "explain header without token",
+			format: FormatYAML,
+			data:   "explain_header: X-Floo-Explain\nroutes:\n  - id: a\n    upstream: http://a\n",
+			want:   []string{`routes.yaml: explain_header requires explain_token`},
+		},
+		{
+			name:   "missing upstream CA",
+			format: FormatYAML,
+			data:   "upstreams:\n  a:\n    url: https://a\n    tls:\n      ca: /nonexistent/ca.pem\nroutes:\n  - id: a\n    upstream: a\n",
+			want:   []string{`routes.yaml:3:5: upstream "a": tls: open /nonexistent/ca.pem`},
+		},
+		{
+			name:   "unknown listener TLS field",
+			format: FormatYAML,
+			data:   "listeners:\n  - address: :8443\n    tls:\n      cert_dir: certs\n      client_auth: require\n      certdir: certs\n",
+			want:   []string{`routes.yaml:6: field certdir not found`},
+		},
+		{
+			name:   "unknown field",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n    upstrem: http://a\n",
+			want:   []string{`routes.yaml:3:5: unknown field "upstrem"`},
+		},
+		{
+			name:   "yaml syntax",
+			format: FormatYAML,
+			data:   "routes:\n  - id: a\n   bad: [\n",
+			want:   []string{"routes.yaml:"},
+		},
+		{
+			name:   "json syntax",
+			format: FormatJSON,
+			data:   "{\n  \"routes\": [\n    {\"id\": \"a\",}\n  ]\n}",
+			want:   []string{"routes.yaml:3:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data), tt.format, "routes.yaml")
+			if err == nil {
+				err = cfg.Validate(NewRegistry())
+			}
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected Errors, got %T: %v", err, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+// headerPredicate is a custom predicate used to test registration.
+type headerPredicate struct {
+	name, value string
+}
+
+func (p headerPredicate) Match(c *fiber.Ctx) bool {
+	return c.Get(p.name) == p.value
+}
+
+func TestCustomPredicateAndRouting(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterPredicate("Header", PredicateFactory{
+		Shortcut: []string{"name", "value"},
+		New: func(args Args) (gateway.Predicate, error) {
+			var p struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			}
+			if err := args.Decode(&p); err != nil {
+				return nil, err
+			}
+			return headerPredicate{name: p.Name, value: p.Value}, nil
+		},
+	})
+
+	// Upstream echoing the forwarded header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path+" "+r.Header.Get("X-Proxy"))
+	}))
+	defer upstream.Close()
+
+	data := `
+routes:
+  - id: beta
+    predicates:
+      - Header=X-Beta, yes
+    filters:
+      - AddRequestHeader=X-Proxy, Floo
+      - AddResponseHeader=X-Route, beta
+    upstream: ` + upstream.URL + `
+`
+	cfg, err := Parse([]byte(data), FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	gw, err := cfg.Build(reg)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	app := fiber.New()
+	app.All("/*", gw.Handle)
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("X-Beta", "yes")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "/hello Floo" {
+		t.Errorf("Expected body '/hello Floo', got '%s'", body)
+	}
+	if resp.Header.Get("X-Route") != "beta" {
+		t.Errorf("Expected response filter to set X-Route, got '%s'", resp.Header.Get("X-Route"))
+	}
+
+	// Requests without the header do not match
+	req = httptest.NewRequest(http.MethodGet, "/hello", nil)
+	resp, _ = app.Test(req)
+	if resp.StatusCode != 404 {
+		t.Errorf("Status code should be 404, but got %d", resp.StatusCode)
+	}
+}
+
+func TestDefinitionRoundTrip(t *testing.T) {
+	d := ParseDefinition("AddRequestHeader=X-Proxy, Floo")
+	data, err := d.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal definition: %v", err)
+	}
+	if string(data) != `"AddRequestHeader=X-Proxy, Floo"` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+
+	var back Definition
+	if err := back.UnmarshalJSON([]byte(`{"name":"Method","args":{"method":"GET"}}`)); err != nil {
+		t.Fatalf("Failed to unmarshal definition: %v", err)
+	}
+	if back.Name != "Method" || back.Args["method"] != "GET" {
+		t.Errorf("Unexpected definition %#v", back)
+	}
+}
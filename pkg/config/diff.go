@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Diff summarizes how the routes of two configurations differ, by route ID.
+type Diff struct {
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged int
+	// Reordered is set when routes present in both configurations changed their relative order.
+	Reordered bool
+}
+
+// Empty reports whether the configurations have the same routes.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.Reordered
+}
+
+// String formats the diff for logging, e.g. "added=[b] removed=[] changed=[a] unchanged=2".
+func (d Diff) String() string {
+	s := fmt.Sprintf("added=[%s] removed=[%s] changed=[%s] unchanged=%d",
+		strings.Join(d.Added, ","), strings.Join(d.Removed, ","), strings.Join(d.Changed, ","), d.Unchanged)
+	if d.Reordered {
+		s += " reordered"
+	}
+	return s
+}
+
+// DiffConfigs compares the effective routes of two configurations.
+// A route counts as changed when its predicates, filters (including the default
+// filters) or resolved upstream differ.
+func DiffConfigs(old, new *Config) Diff {
+	var d Diff
+	oldRoutes := effectiveRoutes(old)
+	newRoutes := effectiveRoutes(new)
+
+	oldIndex := map[string]string{}
+	for _, r := range oldRoutes {
+		oldIndex[r.id] = r.key
+	}
+	newIndex := map[string]bool{}
+	var common []string
+	for _, r := range newRoutes {
+		newIndex[r.id] = true
+		key, ok := oldIndex[r.id]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, r.id)
+		case key != r.key:
+			d.Changed = append(d.Changed, r.id)
+			common = append(common, r.id)
+		default:
+			d.Unchanged++
+			common = append(common, r.id)
+		}
+	}
+
+	i := 0
+	for _, r := range oldRoutes {
+		if !newIndex[r.id] {
+			d.Removed = append(d.Removed, r.id)
+			continue
+		}
+		if i < len(common) && common[i] != r.id {
+			d.Reordered = true
+		}
+		i++
+	}
+	return d
+}
+
+type effectiveRoute struct {
+	id  string
+	key string
+}
+
+// effectiveRoutes returns each route's ID and a comparable encoding of its definition.
+func effectiveRoutes(c *Config) []effectiveRoute {
+	if c == nil {
+		return nil
+	}
+	routes := make([]effectiveRoute, len(c.Routes))
+	for i, spec := range c.Routes {
+		id := RouteID(spec, i)
+		upstream, _ := c.ResolveUpstream(spec.Upstream)
+		key, _ := json.Marshal(struct {
+			Predicates []Definition
+			Filters    []Definition
+			Upstream   string
+			Disabled   bool
+		}{spec.Predicates, append(append([]Definition{}, c.DefaultFilters...), spec.Filters...), upstream, spec.Disabled})
+		routes[i] = effectiveRoute{id: id, key: string(key)}
+	}
+	return routes
+}
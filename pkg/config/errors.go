@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a problem at a specific position of a configuration file.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+// Error formats the error as "file:line:column: message".
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, "%d:", e.Column)
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Errors is a list of configuration errors reported together.
+type Errors []*Error
+
+// Error joins all errors, one per line.
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// errorList collects errors while a configuration is being checked.
+type errorList struct {
+	file string
+	errs Errors
+}
+
+func (l *errorList) add(line, column int, format string, v ...interface{}) {
+	l.errs = append(l.errs, &Error{File: l.file, Line: line, Column: column, Msg: fmt.Sprintf(format, v...)})
+}
+
+// err returns the collected errors, or nil if there are none.
+func (l *errorList) err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return l.errs
+}
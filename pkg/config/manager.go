@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+)
+
+// Manager owns the live configuration of a Gateway.
+// New configurations are validated before they are applied, and applying one
+// swaps the Gateway's RouteTable so that requests in flight finish on the
+// routes they started with. A configuration that fails validation leaves the
+// current one running.
+type Manager struct {
+	// Path is the configuration file read by Reload and watched by Watch.
+	Path string
+	// Interval is how often Watch checks Path for changes. Defaults to 2 seconds.
+	Interval time.Duration
+	// Logger receives a line for every applied or rejected configuration.
+	Logger log.Logger
+
+	registry *Registry
+	gateway  *gateway.Gateway
+	// resources are shared by the filters of successive configurations
+	resources *resources
+
+	mu      sync.Mutex
+	current *Config
+	chains  map[string][]ChainFilter
+	// loaded identifies the content of Path that was last read
+	loaded version
+}
+
+// NewManager builds cfg into a Gateway backed by a RouteTable.
+// DefaultRegistry is used when reg is nil.
+func NewManager(cfg *Config, reg *Registry) (*Manager, error) {
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	m := &Manager{
+		Path:      cfg.File,
+		Interval:  2 * time.Second,
+		Logger:    log.New(),
+		registry:  reg,
+		resources: newResources(),
+		current:   cfg,
+		loaded:    fileVersion(cfg.File),
+	}
+	m.resources.logger = func() log.Logger { return m.Logger }
+
+	gw, chains, err := cfg.build(reg, m.resources)
+	if err != nil {
+		return nil, err
+	}
+	m.resources.prune()
+	gw.Table = gateway.NewRouteTable(gw.Routes)
+	gw.Routes = nil
+	m.gateway, m.chains = gw, chains
+	return m, nil
+}
+
+// Gateway returns the managed Gateway.
+func (m *Manager) Gateway() *gateway.Gateway {
+	return m.gateway
+}
+
+// Registry returns the Registry used to build routes.
+func (m *Manager) Registry() *Registry {
+	return m.registry
+}
+
+// Config returns the configuration currently applied. It must not be modified.
+func (m *Manager) Config() *Config {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// FilterChain returns the filters of the live route id, default filters
+// first, as they were built from the definitions of Config. It returns false
+// if there is no such route.
+func (m *Manager) FilterChain(id string) ([]ChainFilter, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chain, ok := m.chains[id]
+	return chain, ok
+}
+
+// Apply validates cfg and, if it is valid, makes its routes live.
+// Proxy, upstream TLS, explain and listener settings are only read at startup,
+// so changes to them are reported but not applied; certificate files are
+// reloaded when they change.
+func (m *Manager) Apply(cfg *Config) (Diff, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routes, chains, err := cfg.buildRoutes(m.registry, m.resources)
+	if err != nil {
+		m.Logger.Error(log.ConfigComponent, "Configuration rejected, keeping the current one: %v", err)
+		return Diff{}, err
+	}
+
+	if !reflect.DeepEqual(m.current.Proxy, cfg.Proxy) {
+		m.Logger.Warn(log.ConfigComponent, "Proxy settings changed: restart required to apply them")
+	}
+	if !reflect.DeepEqual(upstreamTLS(m.current), upstreamTLS(cfg)) {
+		m.Logger.Warn(log.ConfigComponent, "Upstream TLS settings changed: restart required to apply them")
+	}
+	if m.current.ExplainHeader != cfg.ExplainHeader || m.current.ExplainToken != cfg.ExplainToken {
+		m.Logger.Warn(log.ConfigComponent, "Explain settings changed: restart required to apply them")
+	}
+	if !reflect.DeepEqual(m.current.Listeners, cfg.Listeners) {
+		m.Logger.Warn(log.ConfigComponent, "Listeners changed: restart required to apply them")
+	}
+
+	diff := DiffConfigs(m.current, cfg)
+	m.gateway.Table.Swap(routes)
+	m.resources.prune()
+	m.current = cfg
+	m.chains = chains
+	m.Logger.Info(log.ConfigComponent, "Configuration applied: %d routes, %s", len(routes), diff)
+	return diff, nil
+}
+
+// upstreamTLS returns the TLS settings of the upstreams by URL.
+func upstreamTLS(cfg *Config) map[string]TLSSpec {
+	settings := map[string]TLSSpec{}
+	for _, u := range cfg.Upstreams {
+		if u.TLS != nil {
+			settings[u.URL] = *u.TLS
+		}
+	}
+	return settings
+}
+
+// Reload reads Path again and applies it.
+func (m *Manager) Reload() (Diff, error) {
+	m.mu.Lock()
+	m.loaded = fileVersion(m.Path)
+	m.mu.Unlock()
+
+	cfg, err := LoadFile(m.Path)
+	if err != nil {
+		m.Logger.Error(log.ConfigComponent, "Configuration rejected, keeping the current one: %v", err)
+		return Diff{}, err
+	}
+	return m.Apply(cfg)
+}
+
+// Watch reloads the configuration whenever Path changes or the process
+// receives SIGHUP, until ctx is done.
+func (m *Manager) Watch(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	m.watch(ctx, ticker.C)
+}
+
+// WatchSignal reloads the configuration whenever the process receives
+// SIGHUP, until ctx is done. Unlike Watch, changes to Path are left alone
+// until then. Do not call both.
+func (m *Manager) WatchSignal(ctx context.Context) {
+	m.watch(ctx, nil)
+}
+
+// watch reloads the configuration on SIGHUP, and on ticks if Path changed.
+func (m *Manager) watch(ctx context.Context, ticks <-chan time.Time) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			m.Logger.Info(log.ConfigComponent, "SIGHUP received: reloading %s", m.Path)
+			m.Reload()
+		case <-ticks:
+			m.mu.Lock()
+			changed := fileVersion(m.Path) != m.loaded
+			m.mu.Unlock()
+			if changed {
+				m.Logger.Info(log.ConfigComponent, "Configuration file changed: reloading %s", m.Path)
+				m.Reload()
+			}
+		}
+	}
+}
+
+type version struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileVersion identifies the current content of a file well enough to notice edits.
+func fileVersion(path string) version {
+	info, err := os.Stat(path)
+	if err != nil {
+		return version{}
+	}
+	return version{modTime: info.ModTime(), size: info.Size()}
+}
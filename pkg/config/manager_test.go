@@ -0,0 +1,364 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+	"github.com/d0lim/floo/internal/testcert"
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/listener"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/d0lim/floo/pkg/mirror"
+)
+
+// recordingLogger is a log.Logger that keeps every line in memory.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(level string, component log.ComponentType, format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf("[%s][%s] ", component, level)+fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Debug(c log.ComponentType, f string, v ...interface{}) {
+	l.record("DEBUG", c, f, v...)
+}
+func (l *recordingLogger) Info(c log.ComponentType, f string, v ...interface{}) {
+	l.record("INFO", c, f, v...)
+}
+func (l *recordingLogger) Warn(c log.ComponentType, f string, v ...interface{}) {
+	l.record("WARN", c, f, v...)
+}
+func (l *recordingLogger) Error(c log.ComponentType, f string, v ...interface{}) {
+	l.record("ERROR", c, f, v...)
+}
+func (l *recordingLogger) Timed(c log.ComponentType, f string, v ...interface{}) func(string) {
+	return func(string) {}
+}
+func (l *recordingLogger) TimedWith(c log.ComponentType, f string, v ...interface{}) func(string, ...interface{}) {
+	return func(string, ...interface{}) {}
+}
+func (l *recordingLogger) Enabled(c log.ComponentType, level log.LogLevel) bool {
+	return true
+}
+func (l *recordingLogger) With(args ...interface{}) log.Logger {
+	return l
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+func writeConfig(t *testing.T, path, routes string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("routes:\n"+routes), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func routeIDs(m *Manager) string {
+	var ids []string
+	for _, r := range m.Gateway().Snapshot() {
+		ids = append(ids, r.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestManagerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeConfig(t, path, `
+  - {id: a, predicates: [Path=/a], upstream: "http://a"}
+  - {id: b, predicates: [Path=/b], upstream: "http://b"}
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	logger := &recordingLogger{}
+	m.Logger = logger
+
+	// A request that started before the reload keeps its snapshot
+	inFlight := m.Gateway().Snapshot()
+
+	// Valid change: a removed, b changed, c added
+	writeConfig(t, path, `
+  - {id: b, predicates: [Path=/b2], upstream: "http://b"}
+  - {id: c, predicates: [Path=/c], upstream: "http://c"}
+`)
+	diff, err := m.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := diff.String(); got != "added=[c] removed=[a] changed=[b] unchanged=0" {
+		t.Errorf("Unexpected diff %s", got)
+	}
+	if ids := routeIDs(m); ids != "b,c" {
+		t.Errorf("Expected routes b,c, got %s", ids)
+	}
+	if len(inFlight) != 2 || inFlight[0].ID != "a" {
+		t.Errorf("In-flight snapshot was modified: %#v", inFlight)
+	}
+
+	// Invalid change keeps the current routes
+	writeConfig(t, path, `
+  - {id: d, predicates: [Nope=/d], upstream: "http://d"}
+`)
+	if _, err := m.Reload(); err == nil {
+		t.Fatal("Expected reload of an invalid config to fail")
+	}
+	if ids := routeIDs(m); ids != "b,c" {
+		t.Errorf("Expected routes b,c to be kept, got %s", ids)
+	}
+
+	logs := logger.String()
+	for _, item := range []string{
+		"[Config][INFO] Configuration applied: 2 routes, added=[c] removed=[a] changed=[b]",
+		`[Config][ERROR] Configuration rejected, keeping the current one: ` + path + `:3:26: route "d": unknown predicate "Nope"`,
+	} {
+		if !strings.Contains(logs, item) {
+			t.Errorf("Log does not contain '%s' item:\n%s", item, logs)
+		}
+	}
+}
+
+func TestManagerWarnsAboutRestartSettings(t *testing.T) {
+	cfg, err := Parse([]byte("routes:\n  - {id: a, upstream: \"http://a\"}\n"), FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	logger := &recordingLogger{}
+	m.Logger = logger
+
+	changed := *cfg
+	changed.Proxy.Timeout = time.Second
+	changed.ExplainHeader, changed.ExplainToken = "X-Floo-Explain", "secret"
+	changed.Listeners = []listener.Spec{{Address: ":8081"}}
+	if _, err := m.Apply(&changed); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	logs := logger.String()
+	for _, item := range []string{
+		"[Config][WARN] Proxy settings changed: restart required to apply them",
+		"[Config][WARN] Explain settings changed: restart required to apply them",
+		"[Config][WARN] Listeners changed: restart required to apply them",
+	} {
+		if !strings.Contains(logs, item) {
+			t.Errorf("Log does not contain '%s' item:\n%s", item, logs)
+		}
+	}
+}
+
+func TestManagerWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeConfig(t, path, `
+  - {id: a, upstream: "http://a"}
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	m.Logger = &recordingLogger{}
+	m.Interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx)
+
+	writeConfig(t, path, `
+  - {id: a, upstream: "http://a"}
+  - {id: watched, upstream: "http://b"}
+`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for routeIDs(m) != "a,watched" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Watch did not apply the change, routes are %s", routeIDs(m))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerWatchSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeConfig(t, path, `
+  - {id: a, upstream: "http://a"}
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	m.Logger = &recordingLogger{}
+
+	// Keep SIGHUP from terminating the test before WatchSignal handles it
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.WatchSignal(ctx)
+
+	writeConfig(t, path, `
+  - {id: a, upstream: "http://a"}
+  - {id: signaled, upstream: "http://b"}
+`)
+
+	self, _ := os.FindProcess(os.Getpid())
+	deadline := time.Now().Add(2 * time.Second)
+	for routeIDs(m) != "a,signaled" {
+		if time.Now().After(deadline) {
+			t.Fatalf("SIGHUP did not apply the change, routes are %s", routeIDs(m))
+		}
+		self.Signal(syscall.SIGHUP)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerSharesResources(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.yaml")
+	jwks := filepath.Join(dir, "jwks.json")
+	withJWT := `
+  - {id: a, predicates: [Path=/a], filters: ["AuthJWT=` + jwks + `"], upstream: "http://a"}
+`
+	writeConfig(t, path, withJWT)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	m.Logger = &recordingLogger{}
+	keys := func(m *Manager) interface{} {
+		chain, _ := m.FilterChain("a")
+		if len(chain) == 0 {
+			return nil
+		}
+		return chain[0].Filter.(filter.AuthJWTFilter).Keys
+	}
+	first := keys(m)
+
+	// Reloads keep the key set
+	if _, err := m.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if keys(m) != first {
+		t.Error("The key set should be shared across reloads")
+	}
+
+	// Other managers have their own
+	other, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if keys(other) == first {
+		t.Error("Managers should not share key sets")
+	}
+
+	// Key sets no longer used are dropped
+	writeConfig(t, path, `
+  - {id: a, predicates: [Path=/a], upstream: "http://a"}
+`)
+	if _, err := m.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if n := len(m.resources.entries); n != 0 {
+		t.Errorf("Expected unused resources to be dropped, but %d remain", n)
+	}
+	writeConfig(t, path, withJWT)
+	if _, err := m.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if keys(m) == first {
+		t.Error("A dropped key set should be loaded again")
+	}
+}
+
+func TestUpstreamCertReloadFailuresAreLogged(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	certPEM, keyPEM := ca.IssuePEM(t, "gateway")
+	os.WriteFile(certFile, certPEM, 0o600)
+	os.WriteFile(keyFile, keyPEM, 0o600)
+	cfg, err := Parse([]byte("upstreams:\n  a:\n    url: https://a\n    tls:\n      cert: "+certFile+"\n      key: "+keyFile+"\n"), FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	logger := &recordingLogger{}
+	res := newResources()
+	res.logger = func() log.Logger { return logger }
+	configs, err := cfg.buildUpstreamTLS(res)
+	if err != nil {
+		t.Fatalf("Failed to build TLS settings: %v", err)
+	}
+
+	// A broken renewal keeps the previous certificate, and is logged
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	os.Chtimes(certFile, later, later)
+	time.Sleep(reload.DefaultInterval)
+	if _, err := configs["https://a"].GetClientCertificate(&tls.CertificateRequestInfo{}); err != nil {
+		t.Fatalf("The previous certificate should be kept: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logger.String(), "[Proxy][ERROR] Client certificate reload failed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the failed reload to be logged, but got %q", logger.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMirrorLogsToManagerLogger(t *testing.T) {
+	cfg, err := Parse([]byte("routes:\n  - {id: a, filters: [\"Mirror=http://shadow\"], upstream: \"http://a\"}\n"), FormatYAML, "routes.yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	m, err := NewManager(cfg, NewRegistry())
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	// The logger is usually set after the filters are built
+	logger := &recordingLogger{}
+	m.Logger = logger
+
+	chain, _ := m.FilterChain("a")
+	chain[0].Filter.(*mirror.Filter).Logger.With("route_id", "a").Warn(log.FilterComponent, "Mirror mismatch")
+	if !strings.Contains(logger.String(), "[Filter][WARN] Mirror mismatch") {
+		t.Errorf("Mirror should log through the manager's logger, but got %q", logger.String())
+	}
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/d0lim/floo/pkg/gateway"
+)
+
+// Args holds the named arguments of a predicate or filter definition.
+// Shortcut arguments are bound to names by the factory's Shortcut field.
+type Args map[string]interface{}
+
+// String returns the named argument as a string. It fails if the argument is missing.
+func (a Args) String(name string) (string, error) {
+	v, ok := a[name]
+	if !ok {
+		return "", fmt.Errorf("missing argument %q", name)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+}
+
+// StringOr returns the named argument as a string, or def if it is missing.
+func (a Args) StringOr(name, def string) (string, error) {
+	if _, ok := a[name]; !ok {
+		return def, nil
+	}
+	return a.String(name)
+}
+
+// Bool returns the named argument as a bool, or def if it is missing.
+func (a Args) Bool(name string, def bool) (bool, error) {
+	v, ok := a[name]
+	if !ok {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("argument %q must be a boolean", name)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("argument %q must be a boolean", name)
+	}
+}
+
+// Float returns the named argument as a number, or def if it is missing.
+func (a Args) Float(name string, def float64) (float64, error) {
+	v, ok := a[name]
+	if !ok {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("argument %q must be a number", name)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("argument %q must be a number", name)
+	}
+}
+
+// Int returns the named argument as an integer, or def if it is missing.
+func (a Args) Int(name string, def int) (int, error) {
+	f, err := a.Float(name, float64(def))
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int(f)) {
+		return 0, fmt.Errorf("argument %q must be an integer", name)
+	}
+	return int(f), nil
+}
+
+// Strings returns the named argument as a list of strings, or nil if it is
+// missing. A string is split on commas and spaces.
+func (a Args) Strings(name string) ([]string, error) {
+	v, ok := a[name]
+	if !ok {
+		return nil, nil
+	}
+	switch v := v.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }), nil
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must be a list of strings", name)
+			}
+			list[i] = s
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("argument %q must be a list of strings", name)
+	}
+}
+
+// StringMap returns the named argument as a map of strings, or nil if it is missing.
+func (a Args) StringMap(name string) (map[string]string, error) {
+	v, ok := a[name]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("argument %q must be a map", name)
+	}
+	strs := make(map[string]string, len(m))
+	for k, item := range m {
+		if item == nil {
+			strs[k] = ""
+			continue
+		}
+		strs[k] = fmt.Sprint(item)
+	}
+	return strs, nil
+}
+
+// Decode stores the arguments in the struct pointed to by v, using its json tags.
+func (a Args) Decode(v interface{}) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// PredicateFactory builds a Predicate from a definition.
+type PredicateFactory struct {
+	// Shortcut names the arguments of the shortcut form, in order.
+	Shortcut []string
+	// New builds the predicate.
+	New func(args Args) (gateway.Predicate, error)
+}
+
+// FilterFactory builds a filter from a definition.
+type FilterFactory struct {
+	// Shortcut names the arguments of the shortcut form, in order.
+	Shortcut []string
+	// New builds the filter. The result must implement gateway.RequestFilter,
+	// gateway.ResponseFilter, or both.
+	New func(args Args) (interface{}, error)
+
+	// newShared, if set, is used instead of New by built-in filters that
+	// share resources between the configurations of a Manager.
+	newShared func(args Args, res *resources) (interface{}, error)
+}
+
+// Registry maps predicate and filter names to their factories.
+type Registry struct {
+	mu         sync.RWMutex
+	predicates map[string]PredicateFactory
+	filters    map[string]FilterFactory
+}
+
+// NewRegistry creates a Registry containing the built-in predicates and filters.
+func NewRegistry() *Registry {
+	r := &Registry{
+		predicates: map[string]PredicateFactory{},
+		filters:    map[string]FilterFactory{},
+	}
+	registerBuiltins(r)
+	return r
+}
+
+// DefaultRegistry is used by the package-level Register functions and by Build
+// when no Registry is given.
+var DefaultRegistry = NewRegistry()
+
+// RegisterPredicate registers a predicate factory in DefaultRegistry.
+func RegisterPredicate(name string, f PredicateFactory) {
+	DefaultRegistry.RegisterPredicate(name, f)
+}
+
+// RegisterFilter registers a filter factory in DefaultRegistry.
+func RegisterFilter(name string, f FilterFactory) {
+	DefaultRegistry.RegisterFilter(name, f)
+}
+
+// RegisterPredicate registers a predicate factory, replacing any factory with the same name.
+func (r *Registry) RegisterPredicate(name string, f PredicateFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.predicates[name] = f
+}
+
+// RegisterFilter registers a filter factory, replacing any factory with the same name.
+func (r *Registry) RegisterFilter(name string, f FilterFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filters[name] = f
+}
+
+// Predicates returns the names of all registered predicates.
+func (r *Registry) Predicates() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return sortedKeys(r.predicates)
+}
+
+// Filters returns the names of all registered filters.
+func (r *Registry) Filters() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return sortedKeys(r.filters)
+}
+
+// NewPredicate builds the predicate described by d.
+func (r *Registry) NewPredicate(d Definition) (gateway.Predicate, error) {
+	r.mu.RLock()
+	f, ok := r.predicates[d.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown predicate %q", d.Name)
+	}
+	args, err := bindArgs(d, f.Shortcut)
+	if err != nil {
+		return nil, fmt.Errorf("predicate %s: %w", d.Name, err)
+	}
+	p, err := f.New(args)
+	if err != nil {
+		return nil, fmt.Errorf("predicate %s: %w", d.Name, err)
+	}
+	return p, nil
+}
+
+// NewFilter builds the filter described by d.
+func (r *Registry) NewFilter(d Definition) (interface{}, error) {
+	return r.newFilter(d, newResources())
+}
+
+// newFilter is NewFilter, sharing key sets and other files through res.
+func (r *Registry) newFilter(d Definition, res *resources) (interface{}, error) {
+	r.mu.RLock()
+	f, ok := r.filters[d.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown filter %q", d.Name)
+	}
+	args, err := bindArgs(d, f.Shortcut)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w", d.Name, err)
+	}
+	var flt interface{}
+	if f.newShared != nil {
+		flt, err = f.newShared(args, res)
+	} else {
+		flt, err = f.New(args)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w", d.Name, err)
+	}
+	if len(FilterPhases(flt)) == 0 {
+		return nil, fmt.Errorf("filter %s: %T is neither a request nor a response filter", d.Name, flt)
+	}
+	return flt, nil
+}
+
+// FilterPhases reports whether f is a "request" filter, a "response" filter, or both.
+func FilterPhases(f interface{}) []string {
+	var phases []string
+	if _, ok := f.(gateway.RequestFilter); ok {
+		phases = append(phases, "request")
+	}
+	if _, ok := f.(gateway.ResponseFilter); ok {
+		phases = append(phases, "response")
+	}
+	return phases
+}
+
+// bindArgs merges the shortcut arguments of d into its named arguments.
+func bindArgs(d Definition, shortcut []string) (Args, error) {
+	args := Args{}
+	for k, v := range d.Args {
+		args[k] = v
+	}
+	if len(d.Shortcut) > len(shortcut) {
+		return nil, fmt.Errorf("expected at most %d arguments, got %d", len(shortcut), len(d.Shortcut))
+	}
+	for i, v := range d.Shortcut {
+		args[shortcut[i]] = v
+	}
+	return args, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
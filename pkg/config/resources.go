@@ -0,0 +1,118 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/d0lim/floo/pkg/log"
+)
+
+// resources holds the key sets, key stores and GeoIP databases built for the
+// filters of a Manager, so that they are not loaded again on every reload.
+// Entries are keyed by kind and source, e.g. "jwks:https://issuer/keys".
+type resources struct {
+	mu      sync.Mutex
+	entries map[string]interface{}
+	// used records the keys requested since the last prune
+	used map[string]bool
+	// logger, if set, returns the Logger receiving failed reloads of files
+	logger func() log.Logger
+}
+
+func newResources() *resources {
+	return &resources{entries: map[string]interface{}{}, used: map[string]bool{}}
+}
+
+// get returns the entry for key, creating it with open if there is none.
+func (r *resources) get(key string, open func() (interface{}, error)) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used[key] = true
+	if v, ok := r.entries[key]; ok {
+		return v, nil
+	}
+	v, err := open()
+	if err != nil {
+		return nil, err
+	}
+	r.entries[key] = v
+	return v, nil
+}
+
+// prune drops the entries that were not requested since the last prune,
+// i.e. by the configuration just applied.
+func (r *resources) prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.entries {
+		if !r.used[key] {
+			delete(r.entries, key)
+		}
+	}
+	r.used = map[string]bool{}
+}
+
+// reloadFailed logs the error of a file that changed but could not be
+// loaded. It is the OnReloadError hook of the filters' files.
+func (r *resources) reloadFailed(err error) {
+	if r.logger == nil {
+		return
+	}
+	r.logger().Error(log.FilterComponent, "Reload failed, keeping the previous version: %v", err)
+}
+
+// upstreamReloadFailed logs the error of an upstream client certificate that
+// changed but could not be loaded.
+func (r *resources) upstreamReloadFailed(err error) {
+	if r.logger == nil {
+		return
+	}
+	r.logger().Error(log.ProxyComponent, "Client certificate reload failed, keeping the previous one: %v", err)
+}
+
+// managerLogger is a log.Logger writing through the Logger of the Manager
+// owning res at the time of each line, so that filters follow changes to
+// Manager.Logger made after they were built.
+type managerLogger struct {
+	res  *resources
+	args []interface{}
+}
+
+func (l managerLogger) current() log.Logger {
+	logger := l.res.logger()
+	if len(l.args) > 0 {
+		logger = logger.With(l.args...)
+	}
+	return logger
+}
+
+func (l managerLogger) Debug(component log.ComponentType, format string, v ...interface{}) {
+	l.current().Debug(component, format, v...)
+}
+
+func (l managerLogger) Info(component log.ComponentType, format string, v ...interface{}) {
+	l.current().Info(component, format, v...)
+}
+
+func (l managerLogger) Warn(component log.ComponentType, format string, v ...interface{}) {
+	l.current().Warn(component, format, v...)
+}
+
+func (l managerLogger) Error(component log.ComponentType, format string, v ...interface{}) {
+	l.current().Error(component, format, v...)
+}
+
+func (l managerLogger) Timed(component log.ComponentType, format string, v ...interface{}) func(result string) {
+	return l.current().Timed(component, format, v...)
+}
+
+func (l managerLogger) TimedWith(component log.ComponentType, format string, v ...interface{}) func(result string, args ...interface{}) {
+	return l.current().TimedWith(component, format, v...)
+}
+
+func (l managerLogger) Enabled(component log.ComponentType, level log.LogLevel) bool {
+	return l.current().Enabled(component, level)
+}
+
+func (l managerLogger) With(args ...interface{}) log.Logger {
+	return managerLogger{res: l.res, args: append(append([]interface{}(nil), l.args...), args...)}
+}
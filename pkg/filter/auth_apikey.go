@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultAPIKeyHeader is the header AuthAPIKeyFilter reads keys from by default.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// consumerKey is the Locals and context key of the Consumer of a request.
+type consumerKey struct{}
+
+// AuthAPIKeyFilter authenticates requests with an API key looked up in Store.
+// The key is read from Header, Query or Cookie, the first one set; only
+// DefaultAPIKeyHeader is read when none is. The Consumer of the key is attached
+// to the request, where ConsumerOf and ConsumerFromContext return it.
+// Requests without a valid key are rejected with 401.
+type AuthAPIKeyFilter struct {
+	Store KeyStore
+	// Header, Query and Cookie name where the key is read from.
+	Header string
+	Query  string
+	Cookie string
+	// ForwardKey keeps the key in the request sent upstream; it is removed by default.
+	ForwardKey bool
+	// ConsumerHeader, if set, forwards the consumer ID upstream in this header.
+	// It is removed from incoming requests first, so clients cannot set it.
+	ConsumerHeader string
+}
+
+// ConsumerOf returns the Consumer authenticated by AuthAPIKeyFilter, or nil.
+func ConsumerOf(c *fiber.Ctx) *Consumer {
+	consumer, _ := c.Locals(consumerKey{}).(*Consumer)
+	return consumer
+}
+
+// ConsumerFromContext returns the Consumer stored in the user context of a
+// request by AuthAPIKeyFilter, or nil.
+func ConsumerFromContext(ctx context.Context) *Consumer {
+	consumer, _ := ctx.Value(consumerKey{}).(*Consumer)
+	return consumer
+}
+
+// OnRequest authenticates the request.
+func (f AuthAPIKeyFilter) OnRequest(c *fiber.Ctx) error {
+	if f.ConsumerHeader != "" {
+		c.Request().Header.Del(f.ConsumerHeader)
+	}
+
+	key := f.key(c)
+	if key == "" {
+		return f.challenge(gateway.ErrUnauthorized.WithMessage("API key required"))
+	}
+	consumer, err := f.Store.Lookup(key)
+	if err != nil {
+		return gateway.ErrInternal.Wrap(fmt.Errorf("API key lookup: %w", err))
+	}
+	if consumer == nil {
+		return f.challenge(gateway.ErrUnauthorized.WithMessage("Invalid API key"))
+	}
+
+	if !f.ForwardKey {
+		f.removeKey(c)
+	}
+	if f.ConsumerHeader != "" {
+		c.Request().Header.Set(f.ConsumerHeader, consumer.ID)
+	}
+	c.Locals(consumerKey{}, consumer)
+	c.SetUserContext(context.WithValue(c.UserContext(), consumerKey{}, consumer))
+	return nil
+}
+
+func (f AuthAPIKeyFilter) key(c *fiber.Ctx) string {
+	switch {
+	case f.Header != "":
+		return c.Get(f.Header)
+	case f.Query != "":
+		return c.Query(f.Query)
+	case f.Cookie != "":
+		return c.Cookies(f.Cookie)
+	default:
+		return c.Get(DefaultAPIKeyHeader)
+	}
+}
+
+func (f AuthAPIKeyFilter) removeKey(c *fiber.Ctx) {
+	switch {
+	case f.Header != "":
+		c.Request().Header.Del(f.Header)
+	case f.Query != "":
+		c.Request().URI().QueryArgs().Del(f.Query)
+	case f.Cookie != "":
+		c.Request().Header.DelCookie(f.Cookie)
+	default:
+		c.Request().Header.Del(DefaultAPIKeyHeader)
+	}
+}
+
+func (f AuthAPIKeyFilter) challenge(e *gateway.Error) error {
+	return e.WithHeader(fiber.HeaderWWWAuthenticate, `APIKey realm="floo"`)
+}
@@ -0,0 +1,172 @@
+package filter
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newAPIKeyApp serves a route protected by f that reports what the upstream
+// would receive.
+func newAPIKeyApp(f AuthAPIKeyFilter) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		if err := f.OnRequest(c); err != nil {
+			return err
+		}
+		consumer := ConsumerFromContext(c.UserContext())
+		return c.SendString(consumer.ID + "/" + consumer.Plan + " key=" + c.Get("X-API-Key") +
+			c.Query("api_key") + " consumer=" + c.Get("X-Consumer"))
+	})
+	return app
+}
+
+func TestAuthAPIKeyFilter(t *testing.T) {
+	store := NewMemoryKeyStore()
+	store.Add("secret-key", Consumer{ID: "mobile", Plan: "gold"})
+
+	tests := []struct {
+		name   string
+		filter AuthAPIKeyFilter
+		path   string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{
+			name:   "header",
+			filter: AuthAPIKeyFilter{Store: store, ConsumerHeader: "X-Consumer"},
+			header: map[string]string{"X-API-Key": "secret-key", "X-Consumer": "admin"},
+			status: 200,
+			body:   "mobile/gold key= consumer=mobile",
+		},
+		{
+			name:   "forwarded key",
+			filter: AuthAPIKeyFilter{Store: store, ForwardKey: true},
+			header: map[string]string{"X-API-Key": "secret-key"},
+			status: 200,
+			body:   "mobile/gold key=secret-key consumer=",
+		},
+		{
+			name:   "query",
+			filter: AuthAPIKeyFilter{Store: store, Query: "api_key"},
+			path:   "/?api_key=secret-key",
+			status: 200,
+			body:   "mobile/gold key= consumer=",
+		},
+		{
+			name:   "cookie",
+			filter: AuthAPIKeyFilter{Store: store, Cookie: "key"},
+			header: map[string]string{"Cookie": "key=secret-key"},
+			status: 200,
+			body:   "mobile/gold key= consumer=",
+		},
+		{
+			name:   "missing key",
+			filter: AuthAPIKeyFilter{Store: store},
+			status: 401,
+		},
+		{
+			name:   "unknown key",
+			filter: AuthAPIKeyFilter{Store: store},
+			header: map[string]string{"X-API-Key": "guess"},
+			status: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := newAPIKeyApp(tt.filter).Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tt.status == 200 && string(body) != tt.body {
+				t.Errorf("Body should be %q, but got %q", tt.body, body)
+			}
+			if tt.status == 401 && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate should be set")
+			}
+		})
+	}
+
+	// Revoked keys are rejected at once
+	store.Revoke("secret-key")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	resp, _ := newAPIKeyApp(AuthAPIKeyFilter{Store: store}).Test(req)
+	if resp.StatusCode != 401 {
+		t.Errorf("Status code should be 401 after revocation, but got %d", resp.StatusCode)
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write keys: %v", err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	keys := "keys:\n" +
+		"  - hash: " + HashAPIKey("alpha") + "\n    consumer: alpha-app\n    plan: free\n" +
+		"  - hash: " + HashAPIKey("beta") + "\n    consumer: beta-app\n    revoked: true\n"
+	write(keys, time.Now().Add(-time.Hour))
+
+	store, err := NewFileKeyStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	store.CheckInterval = time.Nanosecond
+	var reloadErrors []error
+	store.OnReloadError = func(err error) {
+		reloadErrors = append(reloadErrors, err)
+	}
+
+	if c, _ := store.Lookup("alpha"); c == nil || c.ID != "alpha-app" || c.Plan != "free" {
+		t.Errorf("Expected alpha-app on the free plan, but got %+v", c)
+	}
+	if c, _ := store.Lookup("beta"); c != nil {
+		t.Errorf("Revoked key should not be found, but got %+v", c)
+	}
+
+	// Revoke alpha by editing the file
+	// Changes are loaded in the background, the previous keys being used meanwhile
+	write("keys:\n  - hash: "+HashAPIKey("alpha")+"\n    consumer: alpha-app\n    revoked: true\n", time.Now())
+	store.Lookup("alpha")
+	store.check.Wait()
+	if c, _ := store.Lookup("alpha"); c != nil {
+		t.Errorf("Key revoked in the file should not be found, but got %+v", c)
+	}
+
+	// Invalid files keep the previous keys and are reported once
+	write("keys:\n  - hash: plain\n", time.Now().Add(time.Minute))
+	store.Lookup("alpha")
+	store.check.Wait()
+	for i := 0; i < 2; i++ {
+		if c, err := store.Lookup("alpha"); c != nil || err != nil {
+			t.Errorf("Expected the previous keys, but got %+v, %v", c, err)
+		}
+	}
+	if len(reloadErrors) != 1 || !strings.Contains(reloadErrors[0].Error(), "hash must be sha256") {
+		t.Errorf("Expected one reload error, but got %v", reloadErrors)
+	}
+}
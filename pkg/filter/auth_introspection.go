@@ -0,0 +1,285 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of NewAuthIntrospectionFilter.
+const (
+	DefaultIntrospectionCacheTTL    = 5 * time.Minute
+	DefaultIntrospectionNegativeTTL = 30 * time.Second
+	DefaultIntrospectionMaxEntries  = 10000
+	DefaultIntrospectionTimeout     = 5 * time.Second
+)
+
+// AuthIntrospectionFilter authenticates requests carrying opaque bearer
+// tokens by asking an OAuth2 introspection endpoint (RFC 7662) about them.
+// Tokens must be active, unexpired, grant Scopes and, if Audience is set,
+// name one of its values in aud.
+//
+// Results are cached by token hash: active tokens for CacheTTL but never past
+// their exp, inactive ones for NegativeTTL. Concurrent requests carrying the
+// same uncached token share one call to the endpoint. If the endpoint cannot
+// be reached within Timeout the request is rejected with 502, and nothing is
+// cached.
+// Create it with NewAuthIntrospectionFilter.
+type AuthIntrospectionFilter struct {
+	// Endpoint is the URL of the introspection endpoint.
+	Endpoint string
+	// ClientID and ClientSecret authenticate the gateway to the endpoint
+	// with HTTP Basic authentication, when set.
+	ClientID     string
+	ClientSecret string
+	// Client calls the endpoint.
+	Client *http.Client
+	// Scopes must all be granted by the scope claim.
+	Scopes []string
+	// Audience, if set, must contain one of the aud values.
+	Audience []string
+	// Timeout bounds how long a request waits for the endpoint, including
+	// calls made for other requests with the same token. Fiber does not
+	// cancel the context of requests whose client went away, so this is what
+	// frees them when the endpoint hangs. No limit when 0.
+	Timeout time.Duration
+	// CacheTTL, NegativeTTL and MaxEntries bound the cache.
+	CacheTTL    time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+	// ForwardClaims maps claims such as sub or client_id to the request
+	// headers they are forwarded in. Those headers are removed from requests first.
+	ForwardClaims map[string]string
+	// Realm is reported in WWW-Authenticate, "floo" when empty.
+	Realm string
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]Introspection
+	calls map[[sha256.Size]byte]*introspectionCall
+}
+
+// introspectionCall is a call to the endpoint in progress, shared by the
+// requests carrying the same token.
+type introspectionCall struct {
+	done   chan struct{}
+	result Introspection
+	err    error
+	// canceled is set if the request making the call went away
+	canceled bool
+}
+
+// Introspection is the result of introspecting a token.
+type Introspection struct {
+	// Active reports whether the token is active and unexpired.
+	Active bool
+	// Claims holds the members of the introspection response.
+	Claims map[string]interface{}
+	// Expires is when the result leaves the cache.
+	Expires time.Time
+}
+
+// NewAuthIntrospectionFilter creates a filter asking endpoint about tokens.
+func NewAuthIntrospectionFilter(endpoint string) *AuthIntrospectionFilter {
+	return &AuthIntrospectionFilter{
+		Endpoint:    endpoint,
+		Client:      &http.Client{},
+		Timeout:     DefaultIntrospectionTimeout,
+		CacheTTL:    DefaultIntrospectionCacheTTL,
+		NegativeTTL: DefaultIntrospectionNegativeTTL,
+		MaxEntries:  DefaultIntrospectionMaxEntries,
+		cache:       map[[sha256.Size]byte]Introspection{},
+	}
+}
+
+// OnRequest authenticates the bearer token of the request.
+func (f *AuthIntrospectionFilter) OnRequest(c *fiber.Ctx) error {
+	for _, header := range f.ForwardClaims {
+		c.Request().Header.Del(header)
+	}
+
+	token, ok := bearerToken(c)
+	if !ok {
+		return bearerChallenge(gateway.ErrUnauthorized, f.Realm, "", "")
+	}
+	ctx := c.UserContext()
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	result, err := f.Introspect(ctx, token, time.Now())
+	if err != nil {
+		return gateway.ErrUpstreamUnavailable.WithMessage("Token introspection unavailable").Wrap(err)
+	}
+	if !result.Active {
+		return bearerChallenge(gateway.ErrUnauthorized.WithMessage("Invalid token"), f.Realm, "invalid_token", "token is not active")
+	}
+	if len(f.Audience) > 0 {
+		found := false
+		for _, aud := range f.Audience {
+			if claimHas(result.Claims["aud"], aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return bearerChallenge(gateway.ErrUnauthorized.WithMessage("Invalid token"), f.Realm, "invalid_token", "invalid audience")
+		}
+	}
+	granted := scopes(result.Claims)
+	for _, scope := range f.Scopes {
+		if !granted[scope] {
+			return bearerChallenge(gateway.ErrForbidden.WithMessage("Insufficient scope"), f.Realm, "insufficient_scope", "scope "+scope+" is required")
+		}
+	}
+
+	for name, header := range f.ForwardClaims {
+		if v, ok := result.Claims[name]; ok {
+			c.Request().Header.Set(header, ClaimString(v))
+		}
+	}
+	c.Locals(claimsKey, result.Claims)
+	return nil
+}
+
+// Introspect returns the cached or fresh introspection of token at now.
+// Tokens whose exp has passed are reported inactive. The endpoint is called
+// with ctx, and only once at a time per token.
+func (f *AuthIntrospectionFilter) Introspect(ctx context.Context, token string, now time.Time) (Introspection, error) {
+	key := sha256.Sum256([]byte(token))
+	for {
+		f.mu.Lock()
+		if cached, ok := f.cache[key]; ok && now.Before(cached.Expires) {
+			f.mu.Unlock()
+			return cached, nil
+		}
+		call, shared := f.calls[key]
+		if !shared {
+			call = &introspectionCall{done: make(chan struct{})}
+			if f.calls == nil {
+				f.calls = map[[sha256.Size]byte]*introspectionCall{}
+			}
+			f.calls[key] = call
+		}
+		f.mu.Unlock()
+
+		if !shared {
+			call.result, call.err = f.introspect(ctx, token, key, now)
+			call.canceled = ctx.Err() != nil
+			f.mu.Lock()
+			delete(f.calls, key)
+			f.mu.Unlock()
+			close(call.done)
+			return call.result, call.err
+		}
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return Introspection{}, ctx.Err()
+		}
+		// Call again if the request that made the call was canceled
+		if !call.canceled {
+			return call.result, call.err
+		}
+	}
+}
+
+// introspect calls the endpoint and caches the result.
+func (f *AuthIntrospectionFilter) introspect(ctx context.Context, token string, key [sha256.Size]byte, now time.Time) (Introspection, error) {
+	claims, err := f.call(ctx, token)
+	if err != nil {
+		return Introspection{}, err
+	}
+	result := Introspection{Claims: claims, Expires: now.Add(f.NegativeTTL)}
+	result.Active, _ = claims["active"].(bool)
+	if exp, ok := numericDate(claims["exp"]); ok && !now.Before(exp) {
+		result.Active = false
+	}
+	if result.Active {
+		result.Expires = now.Add(f.CacheTTL)
+		if exp, ok := numericDate(claims["exp"]); ok && exp.Before(result.Expires) {
+			result.Expires = exp
+		}
+	}
+	f.store(key, result, now)
+	return result, nil
+}
+
+// store caches result, making room by dropping expired entries, or any
+// entry when none has expired.
+func (f *AuthIntrospectionFilter) store(key [sha256.Size]byte, result Introspection, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cache == nil {
+		f.cache = map[[sha256.Size]byte]Introspection{}
+	}
+	if f.MaxEntries > 0 && len(f.cache) >= f.MaxEntries {
+		for k, v := range f.cache {
+			if !now.Before(v.Expires) {
+				delete(f.cache, k)
+			}
+		}
+		for k := range f.cache {
+			if len(f.cache) < f.MaxEntries {
+				break
+			}
+			delete(f.cache, k)
+		}
+	}
+	f.cache[key] = result
+}
+
+// call posts token to the endpoint and returns the response members.
+func (f *AuthIntrospectionFilter) call(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if f.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(f.ClientID), url.QueryEscape(f.ClientSecret))
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+	if _, ok := claims["active"].(bool); !ok {
+		return nil, errors.New("invalid introspection response: active is missing")
+	}
+	return claims, nil
+}
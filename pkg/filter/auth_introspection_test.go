@@ -0,0 +1,239 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newIntrospectionServer answers introspection requests with the response
+// registered for the token, counting the calls.
+func newIntrospectionServer(t *testing.T, tokens map[string]map[string]interface{}) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response, ok := tokens[r.PostFormValue("token")]
+		if !ok {
+			response = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// newIntrospectionApp serves a route protected by f whose upstream echoes the X-User header.
+func newIntrospectionApp(f *AuthIntrospectionFilter) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		if err := f.OnRequest(c); err != nil {
+			return err
+		}
+		return c.SendString("user=" + c.Get("X-User"))
+	})
+	return app
+}
+
+func TestAuthIntrospectionFilter(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	server, _ := newIntrospectionServer(t, map[string]map[string]interface{}{
+		"good":      {"active": true, "sub": "alice", "scope": "orders:read", "aud": "orders", "exp": exp},
+		"no-scope":  {"active": true, "sub": "alice", "scope": "orders:write", "aud": "orders", "exp": exp},
+		"other-aud": {"active": true, "sub": "alice", "scope": "orders:read", "aud": "billing", "exp": exp},
+		"expired":   {"active": true, "sub": "alice", "scope": "orders:read", "aud": "orders", "exp": time.Now().Add(-time.Minute).Unix()},
+	})
+
+	f := NewAuthIntrospectionFilter(server.URL)
+	f.ClientID, f.ClientSecret = "gateway", "s3cret"
+	f.Scopes = []string{"orders:read"}
+	f.Audience = []string{"orders"}
+	f.ForwardClaims = map[string]string{"sub": "X-User"}
+	app := newIntrospectionApp(f)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		auth   string
+	}{
+		{"active", "good", 200, ""},
+		{"missing token", "", 401, `Bearer realm="floo"`},
+		{"inactive", "revoked", 401, "token is not active"},
+		{"expired", "expired", 401, "token is not active"},
+		{"wrong audience", "other-aud", 401, "invalid audience"},
+		{"missing scope", "no-scope", 403, `error="insufficient_scope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/orders", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req.Header.Set("X-User", "mallory")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); !strings.Contains(got, tt.auth) || (tt.auth == "") != (got == "") {
+				t.Errorf("WWW-Authenticate should contain %q, but got %q", tt.auth, got)
+			}
+			if tt.status == 200 {
+				body := make([]byte, 64)
+				n, _ := resp.Body.Read(body)
+				if string(body[:n]) != "user=alice" {
+					t.Errorf("Upstream should receive the sub claim, but got %q", body[:n])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthIntrospectionCache(t *testing.T) {
+	now := time.Now()
+	server, calls := newIntrospectionServer(t, map[string]map[string]interface{}{
+		"short": {"active": true, "exp": now.Add(time.Minute).Unix()},
+		"long":  {"active": true, "exp": now.Add(time.Hour).Unix()},
+	})
+	f := NewAuthIntrospectionFilter(server.URL)
+	f.ClientID, f.ClientSecret = "gateway", "s3cret"
+
+	introspect := func(token string, at time.Time) Introspection {
+		t.Helper()
+		result, err := f.Introspect(context.Background(), token, at)
+		if err != nil {
+			t.Fatalf("Failed to introspect %s: %v", token, err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		token  string
+		at     time.Duration
+		active bool
+		calls  int64
+	}{
+		{"long", 0, true, 1},
+		{"long", 4 * time.Minute, true, 1},
+		{"long", 6 * time.Minute, true, 2}, // CacheTTL passed
+		{"short", 0, true, 3},
+		{"short", 2 * time.Minute, false, 4}, // exp passed before CacheTTL
+		{"unknown", 0, false, 5},
+		{"unknown", 20 * time.Second, false, 5},
+		{"unknown", time.Minute, false, 6}, // NegativeTTL passed
+	}
+	for _, tt := range tests {
+		result := introspect(tt.token, now.Add(tt.at))
+		if result.Active != tt.active {
+			t.Errorf("%s at +%v: active should be %v, but got %v", tt.token, tt.at, tt.active, result.Active)
+		}
+		if got := calls.Load(); got != tt.calls {
+			t.Errorf("%s at +%v: endpoint should be called %d times, but was called %d times", tt.token, tt.at, tt.calls, got)
+		}
+	}
+}
+
+func TestAuthIntrospectionFailsClosed(t *testing.T) {
+	server, _ := newIntrospectionServer(t, map[string]map[string]interface{}{
+		"good": {"active": true},
+	})
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	tests := []struct {
+		name     string
+		endpoint string
+		secret   string
+	}{
+		{"unreachable", "http://127.0.0.1:1/introspect", "s3cret"},
+		{"rejected", server.URL, "wrong"},
+		{"hanging", hanging.URL, "s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewAuthIntrospectionFilter(tt.endpoint)
+			f.ClientID, f.ClientSecret = "gateway", tt.secret
+			f.Timeout = 100 * time.Millisecond
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer good")
+			resp, err := newIntrospectionApp(f).Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != 502 {
+				t.Errorf("Status code should be 502, but got %d", resp.StatusCode)
+			}
+			if len(f.cache) != 0 {
+				t.Errorf("Failures should not be cached, but %d entries were", len(f.cache))
+			}
+		})
+	}
+}
+
+func TestAuthIntrospectionSharesCalls(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer server.Close()
+	f := NewAuthIntrospectionFilter(server.URL)
+
+	// A canceled request gives up without waiting for the endpoint
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Introspect(canceled, "token", time.Now()); err == nil {
+		t.Error("Expected a canceled request to fail")
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan Introspection, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := f.Introspect(context.Background(), "token", time.Now())
+			if err != nil {
+				t.Errorf("Failed to introspect: %v", err)
+			}
+			results <- result
+		}()
+	}
+	// Let the requests queue up behind the first call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		if !result.Active {
+			t.Error("Every request should get the active result")
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Endpoint should be called once, but was called %d times", got)
+	}
+}
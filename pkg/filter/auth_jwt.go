@@ -0,0 +1,358 @@
+package filter
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// claimsKey is the Locals key of the verified JWT claims.
+const claimsKey = "floo.jwt.claims"
+
+// JWTAlgorithms lists the signature algorithms AuthJWTFilter supports.
+var JWTAlgorithms = []string{"RS256", "ES256", "EdDSA", "HS256"}
+
+// ErrJWKSUnavailable is wrapped by the errors of JWKS.Keys and
+// AuthJWTFilter.Verify when no key could be loaded, as opposed to tokens
+// being invalid.
+var ErrJWKSUnavailable = errors.New("JWKS unavailable")
+
+// Reasons a token is rejected, which AuthJWTFilter reports to clients as
+// error_description instead of the details of Verify's errors.
+var (
+	errTokenMalformed = errors.New("malformed token")
+	errTokenAlgorithm = errors.New("algorithm not accepted")
+	errTokenKey       = errors.New("unknown key")
+	errTokenSignature = errors.New("invalid signature")
+	errTokenExpired   = errors.New("token expired")
+	errTokenNoExpiry  = errors.New("token has no expiry")
+	errTokenNotYet    = errors.New("token not valid yet")
+	errTokenIssuer    = errors.New("invalid issuer")
+	errTokenAudience  = errors.New("invalid audience")
+)
+
+// AuthJWTFilter authenticates requests with a bearer JWT signed by a key of
+// Keys. It checks the signature, iss, aud, exp and nbf, then the required
+// claims and scopes, and forwards selected claims to the upstream.
+// Missing or invalid tokens are rejected with 401, tokens lacking a claim or
+// scope with 403, both with a WWW-Authenticate header (RFC 6750). Requests
+// are rejected with 502 when the keys cannot be loaded.
+type AuthJWTFilter struct {
+	Keys *JWKS
+	// Algorithms lists the accepted algorithms, JWTAlgorithms when empty.
+	Algorithms []string
+	// Issuer, if set, must equal the iss claim.
+	Issuer string
+	// Audience, if set, must contain one of the aud values.
+	Audience []string
+	// ClockSkew is the tolerance applied to exp and nbf.
+	ClockSkew time.Duration
+	// AllowNoExpiry accepts tokens without an exp claim, which are otherwise
+	// rejected since they would be valid forever.
+	AllowNoExpiry bool
+	// RequiredClaims maps claims that must be present to their value;
+	// an empty value accepts any.
+	RequiredClaims map[string]string
+	// Scopes must all be granted by the scope (space-separated) or scp claim.
+	Scopes []string
+	// ForwardClaims maps claims to the request headers they are forwarded in.
+	// Those headers are removed from requests first, so clients cannot set them.
+	ForwardClaims map[string]string
+	// Realm is reported in WWW-Authenticate, "floo" when empty.
+	Realm string
+}
+
+// JWTClaims returns the claims of the token verified by AuthJWTFilter, or the
+// introspection response accepted by AuthIntrospectionFilter, or nil.
+func JWTClaims(c *fiber.Ctx) map[string]interface{} {
+	claims, _ := c.Locals(claimsKey).(map[string]interface{})
+	return claims
+}
+
+// OnRequest verifies the bearer token of the request.
+func (f AuthJWTFilter) OnRequest(c *fiber.Ctx) error {
+	for _, header := range f.ForwardClaims {
+		c.Request().Header.Del(header)
+	}
+
+	token, ok := bearerToken(c)
+	if !ok {
+		return f.challenge(gateway.ErrUnauthorized, "", "")
+	}
+	claims, err := f.Verify(token, time.Now())
+	if errors.Is(err, ErrJWKSUnavailable) {
+		return gateway.ErrUpstreamUnavailable.WithMessage("Token keys unavailable").Wrap(err)
+	}
+	if err != nil {
+		return f.challenge(gateway.ErrUnauthorized.WithMessage("Invalid token").Wrap(err), "invalid_token", tokenErrorDescription(err))
+	}
+
+	for name, want := range f.RequiredClaims {
+		v, ok := claims[name]
+		if !ok || (want != "" && !claimHas(v, want)) {
+			return f.challenge(gateway.ErrForbidden.WithMessage("Insufficient claims"), "insufficient_scope", "claim "+name+" is required")
+		}
+	}
+	granted := scopes(claims)
+	for _, scope := range f.Scopes {
+		if !granted[scope] {
+			return f.challenge(gateway.ErrForbidden.WithMessage("Insufficient scope"), "insufficient_scope", "scope "+scope+" is required")
+		}
+	}
+
+	for name, header := range f.ForwardClaims {
+		if v, ok := claims[name]; ok {
+			c.Request().Header.Set(header, ClaimString(v))
+		}
+	}
+	c.Locals(claimsKey, claims)
+	return nil
+}
+
+// Verify checks the signature and registered claims of token at now and
+// returns its claims. Its errors wrap ErrJWKSUnavailable when the keys could
+// not be loaded.
+func (f AuthJWTFilter) Verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errTokenMalformed, err)
+	}
+	algorithms := f.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = JWTAlgorithms
+	}
+	if !containsString(algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: %q", errTokenAlgorithm, header.Alg)
+	}
+	signature, err := b64(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature", errTokenMalformed)
+	}
+
+	if f.Keys == nil {
+		return nil, fmt.Errorf("%w: no keys configured", ErrJWKSUnavailable)
+	}
+	keys, err := f.Keys.Keys(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if (k.Algorithm == "" || k.Algorithm == header.Alg) && verifySignature(header.Alg, k.Key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errTokenSignature
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", errTokenMalformed, err)
+	}
+	if err := f.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (f AuthJWTFilter) checkClaims(claims map[string]interface{}, now time.Time) error {
+	if exp, ok := numericDate(claims["exp"]); ok && !now.Before(exp.Add(f.ClockSkew)) {
+		return errTokenExpired
+	} else if !ok && claims["exp"] != nil {
+		return fmt.Errorf("%w: exp", errTokenMalformed)
+	} else if !ok && !f.AllowNoExpiry {
+		return errTokenNoExpiry
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(f.ClockSkew).Before(nbf) {
+		return errTokenNotYet
+	} else if !ok && claims["nbf"] != nil {
+		return fmt.Errorf("%w: nbf", errTokenMalformed)
+	}
+	if f.Issuer != "" && claims["iss"] != f.Issuer {
+		return errTokenIssuer
+	}
+	if len(f.Audience) > 0 {
+		found := false
+		for _, aud := range f.Audience {
+			if claimHas(claims["aud"], aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errTokenAudience
+		}
+	}
+	return nil
+}
+
+// tokenErrorDescription returns the reason of a Verify error that is safe to
+// show to clients.
+func tokenErrorDescription(err error) string {
+	for _, reason := range []error{errTokenMalformed, errTokenAlgorithm, errTokenKey, errTokenSignature, errTokenExpired,
+		errTokenNoExpiry, errTokenNotYet, errTokenIssuer, errTokenAudience} {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+	return "invalid token"
+}
+
+func (f AuthJWTFilter) challenge(e *gateway.Error, code, description string) error {
+	return bearerChallenge(e, f.Realm, code, description)
+}
+
+// bearerChallenge returns e with a WWW-Authenticate header describing the
+// failure (RFC 6750). Realm defaults to "floo".
+func bearerChallenge(e *gateway.Error, realm, code, description string) error {
+	if realm == "" {
+		realm = "floo"
+	}
+	value := fmt.Sprintf("Bearer realm=%q", realm)
+	if code != "" {
+		value += fmt.Sprintf(", error=%q, error_description=%q", code, description)
+	}
+	return e.WithHeader(fiber.HeaderWWWAuthenticate, value)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func verifySignature(alg string, key interface{}, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, signed, signature)
+	case "HS256":
+		k, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	default:
+		return false
+	}
+}
+
+// decodeSegment decodes a base64url JSON segment, keeping numbers exact.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := b64(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// numericDate converts a JWT NumericDate claim.
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// claimHas reports whether a claim equals want or, for arrays, contains it.
+func claimHas(v interface{}, want string) bool {
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			if ClaimString(item) == want {
+				return true
+			}
+		}
+		return false
+	}
+	return v != nil && ClaimString(v) == want
+}
+
+// ClaimString formats a claim for a header: strings as is, arrays
+// space-separated and objects as JSON. Filters forwarding claims use it, so
+// that upstreams get the same format whichever filter authenticated the request.
+func ClaimString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = ClaimString(item)
+		}
+		return strings.Join(items, " ")
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// scopes returns the scopes granted by the scope or scp claim.
+func scopes(claims map[string]interface{}) map[string]bool {
+	granted := map[string]bool{}
+	for _, name := range []string{"scope", "scp"} {
+		if v, ok := claims[name]; ok && v != nil {
+			for _, s := range strings.Fields(ClaimString(v)) {
+				granted[s] = true
+			}
+		}
+	}
+	return granted
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
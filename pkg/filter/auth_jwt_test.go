@@ -0,0 +1,327 @@
+package filter
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// testKeys holds a key pair of every supported algorithm.
+type testKeys struct {
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+	ed   ed25519.PrivateKey
+	hmac []byte
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	return &testKeys{rsa: rsaKey, ec: ecKey, ed: edKey, hmac: []byte("0123456789abcdef0123456789abcdef")}
+}
+
+// jwks returns the public JWKS of the keys.
+func (k *testKeys) jwks() []byte {
+	enc := base64.RawURLEncoding.EncodeToString
+	pad := func(b *big.Int) string {
+		buf := make([]byte, 32)
+		return enc(b.FillBytes(buf))
+	}
+	doc := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": enc(k.rsa.N.Bytes()), "e": enc(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": pad(k.ec.X), "y": pad(k.ec.Y)},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": enc(k.ed.Public().(ed25519.PublicKey))},
+		{"kty": "oct", "kid": "hmac", "k": enc(k.hmac)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": enc(k.rsa.N.Bytes()), "e": "AQAB"},
+	}}
+	data, _ := json.Marshal(doc)
+	return data
+}
+
+// sign creates a token signed with the key of alg.
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := enc(header) + "." + enc(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, e := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		sig, err = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), e
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	case "HS256":
+		mac := hmac.New(sha256.New, k.hmac)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + enc(sig)
+}
+
+// newJWTApp serves a route protected by f whose upstream echoes the X-User header.
+func newJWTApp(f AuthJWTFilter) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		if err := f.OnRequest(c); err != nil {
+			return err
+		}
+		return c.SendString("user=" + c.Get("X-User"))
+	})
+	return app
+}
+
+func TestAuthJWTFilter(t *testing.T) {
+	keys := newTestKeys(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(keys.jwks())
+	}))
+	defer server.Close()
+
+	f := AuthJWTFilter{
+		Keys:          NewJWKS(server.URL),
+		Issuer:        "https://issuer",
+		Audience:      []string{"orders"},
+		ClockSkew:     30 * time.Second,
+		Scopes:        []string{"orders:read"},
+		ForwardClaims: map[string]string{"sub": "X-User"},
+	}
+	app := newJWTApp(f)
+
+	now := time.Now().Unix()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://issuer", "aud": []string{"other", "orders"}, "sub": "alice",
+			"exp": now + 60, "nbf": now - 60, "scope": "orders:read orders:write",
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		auth   string
+	}{
+		{"RS256", keys.sign(t, "RS256", "rsa", valid()), 200, ""},
+		{"ES256", keys.sign(t, "ES256", "ec", valid()), 200, ""},
+		{"EdDSA", keys.sign(t, "EdDSA", "ed", valid()), 200, ""},
+		{"HS256", keys.sign(t, "HS256", "hmac", valid()), 200, ""},
+		{"no kid", keys.sign(t, "RS256", "", valid()), 200, ""},
+		{"missing token", "", 401, `Bearer realm="floo"`},
+		{"wrong key", keys.sign(t, "RS256", "ec", valid()), 401, `error="invalid_token"`},
+		{"encryption key", keys.sign(t, "RS256", "enc", valid()), 401, `error="invalid_token"`},
+		{"alg none", keys.sign(t, "none", "rsa", valid()), 401, "algorithm not accepted"},
+		{"tampered", keys.sign(t, "RS256", "rsa", valid()) + "x", 401, "invalid_token"},
+		{"expired", keys.sign(t, "RS256", "rsa", with("exp", now-60)), 401, "token expired"},
+		{"no expiry", keys.sign(t, "RS256", "rsa", with("exp", nil)), 401, "token has no expiry"},
+		{"expired within skew", keys.sign(t, "RS256", "rsa", with("exp", now-10)), 200, ""},
+		{"not yet valid", keys.sign(t, "RS256", "rsa", with("nbf", now+60)), 401, "token not valid yet"},
+		{"wrong issuer", keys.sign(t, "RS256", "rsa", with("iss", "https://evil")), 401, "invalid issuer"},
+		{"wrong audience", keys.sign(t, "RS256", "rsa", with("aud", "billing")), 401, "invalid audience"},
+		{"missing scope", keys.sign(t, "RS256", "rsa", with("scope", "orders:write")), 403, `error="insufficient_scope"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/orders", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req.Header.Set("X-User", "mallory")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			if got := resp.Header.Get("WWW-Authenticate"); !strings.Contains(got, tt.auth) || (tt.auth == "") != (got == "") {
+				t.Errorf("WWW-Authenticate should contain %q, but got %q", tt.auth, got)
+			}
+			if tt.status == 200 {
+				body := make([]byte, 64)
+				n, _ := resp.Body.Read(body)
+				if string(body[:n]) != "user=alice" {
+					t.Errorf("Upstream should receive the sub claim, but got %q", body[:n])
+				}
+			}
+		})
+	}
+}
+
+func TestAuthJWTFilterRequiredClaims(t *testing.T) {
+	keys := newTestKeys(t)
+	f := AuthJWTFilter{
+		Keys:           StaticJWKS(JWK{ID: "hmac", Key: keys.hmac}),
+		RequiredClaims: map[string]string{"role": "admin", "tenant": ""},
+		AllowNoExpiry:  true,
+	}
+
+	tests := []struct {
+		claims map[string]interface{}
+		status int
+	}{
+		{map[string]interface{}{"role": []string{"user", "admin"}, "tenant": "acme"}, 200},
+		{map[string]interface{}{"role": "user", "tenant": "acme"}, 403},
+		{map[string]interface{}{"role": "admin"}, 403},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+keys.sign(t, "HS256", "hmac", tt.claims))
+		resp, err := newJWTApp(f).Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("Claims %v: status code should be %d, but got %d", tt.claims, tt.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKeys, newKeys := newTestKeys(t), newTestKeys(t)
+	var mu sync.Mutex
+	current, prefix, fetches := oldKeys, "v1-", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		// Rotated keys use new IDs
+		data := strings.ReplaceAll(string(current.jwks()), `"kid":"`, `"kid":"`+prefix)
+		w.Write([]byte(data))
+	}))
+	defer server.Close()
+
+	jwks := &JWKS{URL: server.URL, MinRefresh: time.Nanosecond}
+	f := AuthJWTFilter{Keys: jwks}
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	if _, err := f.Verify(oldKeys.sign(t, "ES256", "v1-ec", claims), time.Now()); err != nil {
+		t.Fatalf("Token of the first key set should be valid: %v", err)
+	}
+	if _, err := f.Verify(oldKeys.sign(t, "ES256", "v1-ec", claims), time.Now()); err != nil {
+		t.Fatalf("Token of the first key set should be valid: %v", err)
+	}
+	if fetches != 1 {
+		t.Errorf("Keys should be cached, but were fetched %d times", fetches)
+	}
+
+	mu.Lock()
+	current, prefix = newKeys, "v2-"
+	mu.Unlock()
+	if _, err := f.Verify(newKeys.sign(t, "ES256", "v2-ec", claims), time.Now()); err != nil {
+		t.Errorf("Token of a rotated key should be valid: %v", err)
+	}
+	if _, err := f.Verify(oldKeys.sign(t, "ES256", "v1-ec", claims), time.Now()); err == nil {
+		t.Error("Token of a removed key should be rejected")
+	}
+}
+
+func TestAuthJWTFilterKeysUnavailable(t *testing.T) {
+	keys := newTestKeys(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	app := newJWTApp(AuthJWTFilter{Keys: NewJWKS(server.URL + "/internal/jwks")})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+keys.sign(t, "RS256", "rsa", map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()}))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Status code should be %d, but got %d", http.StatusBadGateway, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "/internal/jwks") || strings.Contains(resp.Header.Get("WWW-Authenticate"), "/internal/jwks") {
+		t.Errorf("Response should not name the JWKS URL, but got %q", body)
+	}
+}
+
+func TestJWKSServesStaleKeysWhileReloading(t *testing.T) {
+	keys := newTestKeys(t)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		first := fetches == 1
+		mu.Unlock()
+		if !first {
+			// The upstream hangs after the first fetch
+			<-release
+		}
+		w.Write(keys.jwks())
+	}))
+	defer server.Close()
+	defer close(release)
+
+	jwks := &JWKS{URL: server.URL, Refresh: time.Nanosecond, MinRefresh: time.Nanosecond}
+	if _, err := jwks.Keys("ec"); err != nil {
+		t.Fatalf("First load should succeed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := jwks.Keys("ec")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Stale keys should be served, but got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Keys should not wait for a reload while stale keys exist")
+	}
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultClientCertHeader is the header ClientCertRequestFilter forwards
+// client certificates in by default.
+const DefaultClientCertHeader = "X-Forwarded-Client-Cert"
+
+// ClientCertRequestFilter forwards the client certificate verified when the
+// gateway terminates mutual TLS to the upstream, in the format of Envoy's
+// X-Forwarded-Client-Cert header (see FormatClientCert). The header is
+// removed from incoming requests first, so clients cannot set it.
+type ClientCertRequestFilter struct {
+	// Header is DefaultClientCertHeader when empty.
+	Header string
+	// Required rejects requests without a verified client certificate with 401.
+	Required bool
+}
+
+// OnRequest forwards the client certificate.
+func (f ClientCertRequestFilter) OnRequest(c *fiber.Ctx) error {
+	header := f.Header
+	if header == "" {
+		header = DefaultClientCertHeader
+	}
+	c.Request().Header.Del(header)
+
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		if f.Required {
+			return gateway.ErrUnauthorized.WithMessage("Client certificate required")
+		}
+		return nil
+	}
+	c.Request().Header.Set(header, FormatClientCert(state.PeerCertificates[0]))
+	return nil
+}
+
+// FormatClientCert describes cert as Envoy's X-Forwarded-Client-Cert does:
+// the hex SHA-256 fingerprint, the subject and the URI and DNS names, e.g.
+//
+//	Hash=9ba6...;Subject="CN=billing,O=Acme";URI=spiffe://acme/billing;DNS=billing.internal
+func FormatClientCert(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := []string{
+		"Hash=" + hex.EncodeToString(sum[:]),
+		"Subject=" + quoteClientCertValue(cert.Subject.String()),
+	}
+	for _, uri := range cert.URIs {
+		parts = append(parts, "URI="+quoteClientCertValue(uri.String()))
+	}
+	for _, name := range cert.DNSNames {
+		parts = append(parts, "DNS="+quoteClientCertValue(name))
+	}
+	return strings.Join(parts, ";")
+}
+
+// quoteClientCertValue quotes values containing separators.
+func quoteClientCertValue(v string) string {
+	if !strings.ContainsAny(v, `,;="`) {
+		return v
+	}
+	return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+}
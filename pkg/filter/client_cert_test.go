@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/internal/testcert"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestClientCertRequestFilter(t *testing.T) {
+	ca := testcert.NewCA(t)
+	server := ca.Issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "gateway"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	spiffe, _ := url.Parse("spiffe://acme/billing")
+	client := ca.Issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing", Organization: []string{"Acme, Inc."}},
+		DNSNames:    []string{"billing.internal"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	pool := ca.Pool
+
+	f := ClientCertRequestFilter{Header: "X-Client-Cert", Required: true}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		if err := f.OnRequest(c); err != nil {
+			return err
+		}
+		return c.SendString(c.Get("X-Client-Cert"))
+	})
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	get := func(certs ...tls.Certificate) (int, string) {
+		t.Helper()
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		req, _ := http.NewRequest("GET", "https://"+ln.Addr().String()+"/", nil)
+		req.Header.Set("X-Client-Cert", "Hash=forged")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get(client)
+	if status != 200 {
+		t.Fatalf("Status code should be 200, but got %d", status)
+	}
+	want := FormatClientCert(client.Leaf)
+	if body != want {
+		t.Errorf("Upstream should receive %q, but got %q", want, body)
+	}
+	for _, part := range []string{`Subject="CN=billing,O=Acme\, Inc."`, "URI=spiffe://acme/billing", "DNS=billing.internal"} {
+		if !strings.Contains(body, part) {
+			t.Errorf("Header should contain %s, but got %q", part, body)
+		}
+	}
+
+	if status, body := get(); status != 401 || strings.Contains(body, "forged") {
+		t.Errorf("Request without a certificate should be rejected with 401, but got %d %q", status, body)
+	}
+}
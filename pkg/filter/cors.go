@@ -0,0 +1,246 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultCORSMethods are the methods CORSFilter allows by default.
+var DefaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// corsResponseHeaders are the CORS headers of responses, which CORSFilter
+// sets itself in place of those of the upstream.
+var corsResponseHeaders = []string{
+	fiber.HeaderAccessControlAllowOrigin,
+	fiber.HeaderAccessControlAllowCredentials,
+	fiber.HeaderAccessControlAllowMethods,
+	fiber.HeaderAccessControlAllowHeaders,
+	fiber.HeaderAccessControlExposeHeaders,
+	fiber.HeaderAccessControlMaxAge,
+}
+
+// CORSFilter lets browsers call the route from other origins. It answers
+// preflight requests itself, without calling the upstream, and replaces the
+// CORS headers of upstream responses with its own, so that clients never
+// get them twice. Exposed headers set by the upstream are kept.
+//
+// Create it with NewCORSFilter; it is both a RequestFilter and a
+// ResponseFilter. Responses to requests from origins that are not allowed
+// get no CORS headers, so browsers do not let scripts read them.
+//
+// Preflight requests are OPTIONS requests without credentials, so they only
+// reach the filter on routes matching OPTIONS, and only if it comes before
+// the authentication filters of the route.
+type CORSFilter struct {
+	// Methods are the methods allowed in preflight requests, DefaultCORSMethods
+	// when empty.
+	Methods []string
+	// Headers are the request headers allowed in preflight requests. Any
+	// header is allowed when empty or "*".
+	Headers []string
+	// ExposedHeaders are the response headers scripts can read, in addition
+	// to the CORS-safelisted ones.
+	ExposedHeaders []string
+	// MaxAge is how long browsers can cache preflight responses. Browsers
+	// use their own default when 0.
+	MaxAge time.Duration
+
+	credentials bool
+	anyOrigin   bool
+	exact       map[string]bool
+	patterns    []*regexp.Regexp
+}
+
+// NewCORSFilter creates a CORSFilter allowing origins, which are either
+//   - "*", any origin,
+//   - exact origins such as "https://app.example.com",
+//   - wildcards such as "https://*.example.com", where * matches one or
+//     more labels of the host name, or
+//   - regular expressions prefixed with "regex:", such as
+//     "regex:^https://(app|admin)\.example\.com$".
+//
+// With credentials, requests can carry cookies and authorization. "*", and
+// patterns matching any origin such as "regex:.*" or "https://*", are then
+// rejected, as they would let any web site make such requests on behalf of
+// the user.
+func NewCORSFilter(origins []string, credentials bool) (*CORSFilter, error) {
+	f := &CORSFilter{credentials: credentials, exact: map[string]bool{}}
+	for _, origin := range origins {
+		var pattern *regexp.Regexp
+		switch {
+		case origin == "*":
+			if credentials {
+				return nil, errors.New("origin \"*\" cannot be used with credentials, list the allowed origins instead")
+			}
+			f.anyOrigin = true
+		case strings.HasPrefix(origin, "regex:"):
+			var err error
+			if pattern, err = regexp.Compile(strings.TrimPrefix(origin, "regex:")); err != nil {
+				return nil, fmt.Errorf("origin %q: %v", origin, err)
+			}
+		case strings.Contains(origin, "*"):
+			expr := strings.ReplaceAll(regexp.QuoteMeta(origin), `\*`, `[a-z0-9-]+(?:\.[a-z0-9-]+)*`)
+			pattern = regexp.MustCompile("(?i)^" + expr + "$")
+		default:
+			f.exact[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+		if pattern == nil {
+			continue
+		}
+		if credentials && matchesAnyOrigin(pattern) {
+			return nil, fmt.Errorf("origin %q matches any origin and cannot be used with credentials, list the allowed origins instead", origin)
+		}
+		f.patterns = append(f.patterns, pattern)
+	}
+	return f, nil
+}
+
+// untrustedOrigins are origins no configuration should allow, under the
+// reserved .invalid domain, or sent by sandboxed and local documents.
+var untrustedOrigins = []string{"https://attacker.invalid", "http://attacker.invalid", "null"}
+
+// matchesAnyOrigin reports whether pattern allows one of untrustedOrigins,
+// and so likely any origin.
+func matchesAnyOrigin(pattern *regexp.Regexp) bool {
+	for _, origin := range untrustedOrigins {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOrigin reports whether origin is allowed.
+func (f *CORSFilter) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if f.anyOrigin || f.exact[strings.ToLower(origin)] {
+		return true
+	}
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnRequest answers preflight requests, and sets the CORS headers of other
+// requests from allowed origins, so that error responses carry them too.
+func (f *CORSFilter) OnRequest(c *fiber.Ctx) error {
+	origin := c.Get(fiber.HeaderOrigin)
+	requestMethod := c.Get(fiber.HeaderAccessControlRequestMethod)
+	if c.Method() != fiber.MethodOptions || requestMethod == "" {
+		f.varyOrigin(c)
+		if f.AllowsOrigin(origin) {
+			f.setOrigin(c, origin)
+		}
+		return nil
+	}
+
+	// Preflight request
+	c.Vary(fiber.HeaderOrigin, fiber.HeaderAccessControlRequestMethod, fiber.HeaderAccessControlRequestHeaders)
+	if !f.AllowsOrigin(origin) {
+		return gateway.ErrForbidden.WithMessage("CORS origin not allowed")
+	}
+	if !containsFold(f.methods(), requestMethod) {
+		return gateway.ErrForbidden.WithMessage("CORS method not allowed")
+	}
+	requestHeaders := c.Get(fiber.HeaderAccessControlRequestHeaders)
+	if !f.allowsHeaders(requestHeaders) {
+		return gateway.ErrForbidden.WithMessage("CORS headers not allowed")
+	}
+
+	f.setOrigin(c, origin)
+	c.Set(fiber.HeaderAccessControlAllowMethods, strings.Join(f.methods(), ", "))
+	if requestHeaders != "" {
+		c.Set(fiber.HeaderAccessControlAllowHeaders, requestHeaders)
+	}
+	if f.MaxAge > 0 {
+		c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(int(f.MaxAge.Seconds())))
+	}
+	c.Status(http.StatusNoContent)
+	return gateway.ErrHandled
+}
+
+// OnResponse replaces the CORS headers of the upstream with those of the
+// filter, keeping the exposed headers of both.
+func (f *CORSFilter) OnResponse(c *fiber.Ctx) error {
+	exposed := append([]string(nil), f.ExposedHeaders...)
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		if strings.EqualFold(string(key), fiber.HeaderAccessControlExposeHeaders) {
+			for _, name := range strings.Split(string(value), ",") {
+				if name = strings.TrimSpace(name); name != "" && !containsFold(exposed, name) {
+					exposed = append(exposed, name)
+				}
+			}
+		}
+	})
+	for _, name := range corsResponseHeaders {
+		c.Response().Header.Del(name)
+	}
+
+	f.varyOrigin(c)
+	origin := c.Get(fiber.HeaderOrigin)
+	if !f.AllowsOrigin(origin) {
+		return nil
+	}
+	f.setOrigin(c, origin)
+	if len(exposed) > 0 {
+		c.Set(fiber.HeaderAccessControlExposeHeaders, strings.Join(exposed, ", "))
+	}
+	return nil
+}
+
+// setOrigin sets the headers allowing origin.
+func (f *CORSFilter) setOrigin(c *fiber.Ctx, origin string) {
+	if f.anyOrigin {
+		c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	} else {
+		c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+	}
+	if f.credentials {
+		c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+	}
+	if len(f.ExposedHeaders) > 0 {
+		c.Set(fiber.HeaderAccessControlExposeHeaders, strings.Join(f.ExposedHeaders, ", "))
+	}
+}
+
+// varyOrigin tells caches that the response depends on the origin, unless
+// every origin gets the same one.
+func (f *CORSFilter) varyOrigin(c *fiber.Ctx) {
+	if !f.anyOrigin {
+		c.Vary(fiber.HeaderOrigin)
+	}
+}
+
+func (f *CORSFilter) methods() []string {
+	if len(f.Methods) == 0 {
+		return DefaultCORSMethods
+	}
+	return f.Methods
+}
+
+// allowsHeaders reports whether every header of the comma-separated list
+// requested is allowed.
+func (f *CORSFilter) allowsHeaders(requested string) bool {
+	if len(f.Headers) == 0 || containsFold(f.Headers, "*") {
+		return true
+	}
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name != "" && !containsFold(f.Headers, name) {
+			return false
+		}
+	}
+	return true
+}
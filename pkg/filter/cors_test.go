@@ -0,0 +1,212 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// corsUpstream responds with CORS headers of its own and counts its calls.
+type corsUpstream struct {
+	calls int
+}
+
+func (u *corsUpstream) Proxy(c *fiber.Ctx, upstream string) error {
+	u.calls++
+	c.Append(fiber.HeaderAccessControlAllowOrigin, "*")
+	c.Append(fiber.HeaderAccessControlExposeHeaders, "X-Upstream-Total")
+	c.Append(fiber.HeaderVary, "Accept-Encoding")
+	return c.SendString("ok")
+}
+
+func newCORSApp(t *testing.T, f *CORSFilter) (*fiber.App, *corsUpstream) {
+	t.Helper()
+	upstream := &corsUpstream{}
+	gw := &gateway.Gateway{
+		ReverseProxy: upstream,
+		Routes: []gateway.Route{{
+			RequestFilters:  []gateway.RequestFilter{f},
+			ResponseFilters: []gateway.ResponseFilter{f},
+			Upstream:        "http://upstream",
+		}},
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.All("/*", gw.Handle)
+	return app, upstream
+}
+
+func TestCORSFilterOrigins(t *testing.T) {
+	f, err := NewCORSFilter([]string{"https://app.example.com", "https://*.example.org", `regex:^https://(dev|qa)\.example\.net$`}, false)
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+	for origin, want := range map[string]bool{
+		"https://app.example.com":       true,
+		"https://APP.example.com":       true,
+		"http://app.example.com":        false,
+		"https://app.example.com.evil":  false,
+		"https://a.example.org":         true,
+		"https://a.b.example.org":       true,
+		"https://example.org":           false,
+		"https://evil.com/.example.org": false,
+		"https://dev.example.net":       true,
+		"https://prod.example.net":      false,
+		"null":                          false,
+		"":                              false,
+	} {
+		if got := f.AllowsOrigin(origin); got != want {
+			t.Errorf("AllowsOrigin(%q) should be %v, but got %v", origin, want, got)
+		}
+	}
+
+	if _, err := NewCORSFilter([]string{"regex:(unclosed"}, false); err == nil {
+		t.Error("Invalid regular expression should be rejected")
+	}
+}
+
+func TestCORSFilterPreflight(t *testing.T) {
+	f, _ := NewCORSFilter([]string{"https://app.example.com"}, false)
+	f.Methods = []string{"GET", "POST"}
+	f.Headers = []string{"Authorization", "Content-Type"}
+	f.MaxAge = 10 * time.Minute
+	app, upstream := newCORSApp(t, f)
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		status  int
+	}{
+		{"allowed", "https://app.example.com", "POST", "authorization, content-type", 204},
+		{"other origin", "https://evil.example.com", "POST", "", 403},
+		{"method not allowed", "https://app.example.com", "DELETE", "", 403},
+		{"header not allowed", "https://app.example.com", "GET", "X-Debug", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/orders", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			if tt.status != 204 {
+				if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Rejected preflight should not allow the origin, but got %q", got)
+				}
+				return
+			}
+			want := map[string]string{
+				"Access-Control-Allow-Origin":  tt.origin,
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": tt.headers,
+				"Access-Control-Max-Age":       "600",
+			}
+			for name, value := range want {
+				if got := resp.Header.Get(name); got != value {
+					t.Errorf("%s should be %q, but got %q", name, value, got)
+				}
+			}
+			if vary := resp.Header.Get("Vary"); !strings.Contains(vary, "Access-Control-Request-Method") {
+				t.Errorf("Vary should list the preflight headers, but got %q", vary)
+			}
+		})
+	}
+
+	if upstream.calls != 0 {
+		t.Errorf("Preflight requests should not reach the upstream, but got %d calls", upstream.calls)
+	}
+
+	// OPTIONS requests that are not preflights are proxied
+	resp, err := app.Test(httptest.NewRequest(http.MethodOptions, "/orders", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != 200 || upstream.calls != 1 {
+		t.Errorf("Plain OPTIONS request should be proxied, but got %d with %d calls", resp.StatusCode, upstream.calls)
+	}
+}
+
+func TestCORSFilterResponseHeaders(t *testing.T) {
+	f, _ := NewCORSFilter([]string{"https://app.example.com"}, true)
+	f.ExposedHeaders = []string{"X-Request-ID"}
+	app, _ := newCORSApp(t, f)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if got := resp.Header.Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "https://app.example.com" {
+		t.Errorf("Upstream origin should be replaced, but got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Credentials should be allowed, but got %q", got)
+	}
+	if got := resp.Header.Get("Access-Control-Expose-Headers"); got != "X-Request-ID, X-Upstream-Total" {
+		t.Errorf("Exposed headers should be merged, but got %q", got)
+	}
+	if got := resp.Header.Get("Vary"); !strings.Contains(got, "Accept-Encoding") || !strings.Contains(got, "Origin") {
+		t.Errorf("Vary should keep the upstream's value and add Origin, but got %q", got)
+	}
+
+	// Other origins get no CORS headers, including the upstream's
+	req = httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Expose-Headers", "Access-Control-Allow-Credentials"} {
+		if got := resp.Header.Get(name); got != "" {
+			t.Errorf("%s should be removed, but got %q", name, got)
+		}
+	}
+}
+
+func TestCORSFilterAnyOrigin(t *testing.T) {
+	f, _ := NewCORSFilter([]string{"*"}, false)
+	app, _ := newCORSApp(t, f)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Any origin should be allowed with *, but got %q", got)
+	}
+	if got := resp.Header.Get("Vary"); strings.Contains(got, "Origin") {
+		t.Errorf("Vary should not list Origin, but got %q", got)
+	}
+
+	// Any origin with credentials would let any site act on behalf of users
+	for _, origin := range []string{"*", "regex:.*", "regex:^https?://", "https://*", "regex:null"} {
+		if _, err := NewCORSFilter([]string{origin}, true); err == nil {
+			t.Errorf("Origin %q should be rejected with credentials", origin)
+		}
+		if _, err := NewCORSFilter([]string{origin}, false); err != nil {
+			t.Errorf("Origin %q should be allowed without credentials: %v", origin, err)
+		}
+	}
+	for _, origin := range []string{"https://*.example.com", `regex:^https://(app|admin)\.example\.com$`} {
+		if _, err := NewCORSFilter([]string{origin}, true); err != nil {
+			t.Errorf("Origin %q should be allowed with credentials: %v", origin, err)
+		}
+	}
+}
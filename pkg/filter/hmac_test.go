@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/reverseproxy"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHMACSignAndVerify(t *testing.T) {
+	oldKey := HMACKey{ID: "2024", Secret: []byte("old-secret")}
+	newKey := HMACKey{ID: "2025", Secret: []byte("new-secret")}
+	verifier := HMACVerifyRequestFilter{Keys: NewHMACKeys(oldKey, newKey)}
+
+	// The upstream verifies what the signer sent
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		if err := verifier.OnRequest(c); err != nil {
+			return err
+		}
+		return c.SendString("verified")
+	})
+	signed := func(keys *HMACKeys, method, target, body string) *fiber.Ctx {
+		t.Helper()
+		c := app.AcquireCtx(&fasthttp.RequestCtx{})
+		c.Request().Reset()
+		c.Method(method)
+		c.Request().SetRequestURI(target)
+		c.Request().SetBodyString(body)
+		if err := (HMACSignRequestFilter{Keys: keys}).OnRequest(c); err != nil {
+			t.Fatalf("Failed to sign request: %v", err)
+		}
+		return c
+	}
+	send := func(c *fiber.Ctx, tamper func(*fiber.Ctx)) int {
+		t.Helper()
+		if tamper != nil {
+			tamper(c)
+		}
+		req := httptest.NewRequest(string(c.Method()), string(c.Request().RequestURI()), strings.NewReader(string(c.Body())))
+		c.Request().Header.VisitAll(func(k, v []byte) {
+			if strings.HasPrefix(string(k), "X-Floo-") {
+				req.Header.Set(string(k), string(v))
+			}
+		})
+		app.ReleaseCtx(c)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name   string
+		keys   *HMACKeys
+		tamper func(*fiber.Ctx)
+		status int
+	}{
+		{"old key", NewHMACKeys(oldKey), nil, 200},
+		{"rotated key", NewHMACKeys(newKey, oldKey), nil, 200},
+		{"unknown key", NewHMACKeys(HMACKey{ID: "2023", Secret: []byte("old-secret")}), nil, 401},
+		{"wrong secret", NewHMACKeys(HMACKey{ID: "2024", Secret: []byte("guess")}), nil, 401},
+		{"tampered body", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Request().SetBodyString(`{"amount":1000}`) }, 401},
+		{"tampered path", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Request().SetRequestURI("/refunds?b=2&a=1") }, 401},
+		{"tampered query", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Request().SetRequestURI("/payments?b=3&a=1") }, 401},
+		{"reordered query", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Request().SetRequestURI("/payments?a=1&b=2") }, 200},
+		{"tampered method", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Method("PUT") }, 401},
+		{"unsigned", NewHMACKeys(newKey), func(c *fiber.Ctx) { c.Request().Header.Del(HMACSignatureHeader) }, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := send(signed(tt.keys, "POST", "/payments?b=2&a=1", `{"amount":10}`), tt.tamper)
+			if status != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, status)
+			}
+		})
+	}
+}
+
+func TestHMACSignThroughProxy(t *testing.T) {
+	key := HMACKey{ID: "2025", Secret: []byte("secret")}
+	keys := NewHMACKeys(key)
+
+	// The upstream verifies what it received, under its base path
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = r.URL.RequestURI()
+		if err := VerifyHMAC(keys, time.Now(), time.Minute, r.Method, r.URL.Path, r.URL.RawQuery, body, r.Header.Get); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("verified"))
+	}))
+	defer upstream.Close()
+
+	gw := &gateway.Gateway{
+		ReverseProxy: reverseproxy.NewNetHTTPProxy(),
+		Routes: []gateway.Route{{
+			RequestFilters: []gateway.RequestFilter{HMACSignRequestFilter{Keys: keys}},
+			Upstream:       upstream.URL + "/api",
+		}},
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.All("/*", gw.Handle)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/orders?b=2&a=1", strings.NewReader(`{"amount":10}`)))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be %d, but got %d", 200, resp.StatusCode)
+	}
+	if received != "/api/orders?b=2&a=1" {
+		t.Errorf("Upstream should receive %q, but got %q", "/api/orders?b=2&a=1", received)
+	}
+}
+
+func TestVerifyHMACTimestamp(t *testing.T) {
+	keys := NewHMACKeys(HMACKey{ID: "k", Secret: []byte("secret")})
+	key, _ := keys.Signing()
+	now := time.Now()
+
+	for _, tt := range []struct {
+		age time.Duration
+		ok  bool
+	}{
+		{0, true},
+		{4 * time.Minute, true},
+		{-4 * time.Minute, true},
+		{6 * time.Minute, false},
+		{-6 * time.Minute, false},
+	} {
+		headers := SignHMAC(key, now.Add(-tt.age), "GET", "/hooks", "", nil)
+		err := VerifyHMAC(keys, now, DefaultHMACMaxSkew, "GET", "/hooks", "", nil, func(name string) string { return headers[name] })
+		if (err == nil) != tt.ok {
+			t.Errorf("Signature %v old: expected valid=%v, but got %v", tt.age, tt.ok, err)
+		}
+	}
+}
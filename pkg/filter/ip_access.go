@@ -0,0 +1,136 @@
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultClientIPHeader is the header ClientIP reads the addresses of proxies
+// from by default.
+const DefaultClientIPHeader = "X-Forwarded-For"
+
+// CountryLookup returns the ISO 3166-1 alpha-2 code of the country an
+// address is located in, or "" if it is unknown. geoip.DB implements it.
+type CountryLookup interface {
+	Country(ip netip.Addr) (string, error)
+}
+
+// ClientIP returns the address of the client that sent the request. That is
+// the address of the connection unless it comes from one of trusted, the
+// proxies in front of the gateway: then header, X-Forwarded-For when empty,
+// is read from right to left, skipping the proxies, and the first address
+// not in trusted is the client's. Addresses further left could have been
+// sent by the client, so are never used.
+func ClientIP(c *fiber.Ctx, trusted *IPList, header string) netip.Addr {
+	remote, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+	client := remote.Unmap()
+	if trusted == nil || !trusted.Contains(client) {
+		return client
+	}
+	if header == "" {
+		header = DefaultClientIPHeader
+	}
+
+	var hops []string
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		if strings.EqualFold(string(key), header) {
+			hops = append(hops, strings.Split(string(value), ",")...)
+		}
+	})
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed entry ends the chain of proxies we can trust
+			break
+		}
+		client = addr.Unmap()
+		if !trusted.Contains(client) {
+			break
+		}
+	}
+	return client
+}
+
+// IPAccessRequestFilter allows or denies requests by the IP address of the
+// client, see ClientIP, and the country it is located in. A request is
+// denied when the client is in Deny or DenyCountries. Otherwise, when Allow
+// or AllowCountries is set, it is only allowed when the client is in one of
+// them.
+type IPAccessRequestFilter struct {
+	Allow *IPList
+	Deny  *IPList
+	// AllowCountries and DenyCountries are ISO 3166-1 alpha-2 codes, such as
+	// "DE", looked up with Countries. Clients of unknown countries are not in
+	// either.
+	AllowCountries []string
+	DenyCountries  []string
+	Countries      CountryLookup
+	// TrustedProxies and Header configure ClientIP.
+	TrustedProxies *IPList
+	Header         string
+	// Status is the status of denied requests, 403 when 0.
+	Status int
+}
+
+// OnRequest denies clients that are not allowed.
+func (f IPAccessRequestFilter) OnRequest(c *fiber.Ctx) error {
+	ip := ClientIP(c, f.TrustedProxies, f.Header)
+	reason, err := f.check(ip)
+	if err != nil {
+		return gateway.ErrInternal.Wrap(fmt.Errorf("IP access check: %w", err))
+	}
+	if reason == "" {
+		return nil
+	}
+
+	e := gateway.ErrForbidden
+	if f.Status != 0 && f.Status != http.StatusForbidden {
+		e = gateway.AsError(fiber.NewError(f.Status, http.StatusText(f.Status)))
+	}
+	return e.Wrap(fmt.Errorf("client %s denied: %s", ip, reason))
+}
+
+// check returns why ip is denied, or "" if it is allowed.
+func (f IPAccessRequestFilter) check(ip netip.Addr) (string, error) {
+	if !ip.IsValid() {
+		return "unknown address", nil
+	}
+	if f.Deny != nil && f.Deny.Contains(ip) {
+		return "in deny list", nil
+	}
+
+	country := ""
+	if f.Countries != nil && (len(f.AllowCountries) > 0 || len(f.DenyCountries) > 0) {
+		var err error
+		if country, err = f.Countries.Country(ip); err != nil {
+			return "", err
+		}
+	}
+	if country != "" && containsFold(f.DenyCountries, country) {
+		return "country " + country + " denied", nil
+	}
+
+	if f.Allow == nil && len(f.AllowCountries) == 0 {
+		return "", nil
+	}
+	if f.Allow != nil && f.Allow.Contains(ip) {
+		return "", nil
+	}
+	if country != "" && containsFold(f.AllowCountries, country) {
+		return "", nil
+	}
+	if country == "" {
+		return "not in allow list", nil
+	}
+	return "not in allow list, country " + country, nil
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
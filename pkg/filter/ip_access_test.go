@@ -0,0 +1,187 @@
+package filter
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// countryMap is a CountryLookup of addresses to countries.
+type countryMap map[string]string
+
+func (m countryMap) Country(ip netip.Addr) (string, error) {
+	if ip.String() == "192.0.2.99" {
+		return "", errors.New("database unavailable")
+	}
+	return m[ip.String()], nil
+}
+
+// ipRequest runs fn with a request from remote carrying the X-Forwarded-For
+// headers xff.
+func ipRequest(t *testing.T, remote string, xff []string, fn func(c *fiber.Ctx)) {
+	t.Helper()
+	var req fasthttp.Request
+	req.SetRequestURI("/")
+	for _, v := range xff {
+		req.Header.Add("X-Forwarded-For", v)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 4321}, nil)
+	app := fiber.New()
+	c := app.AcquireCtx(ctx)
+	defer app.ReleaseCtx(c)
+	fn(c)
+}
+
+func mustIPList(t *testing.T, entries ...string) *IPList {
+	t.Helper()
+	l, err := NewIPList(entries, "")
+	if err != nil {
+		t.Fatalf("Failed to parse IP list: %v", err)
+	}
+	return l
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := mustIPList(t, "10.0.0.0/8", "2001:db8::/32")
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted *IPList
+		want    string
+	}{
+		{"no trusted proxies", "10.0.0.1", []string{"198.51.100.7"}, nil, "10.0.0.1"},
+		{"direct client", "203.0.113.5", []string{"198.51.100.7"}, trusted, "203.0.113.5"},
+		{"through proxies", "10.0.0.1", []string{"198.51.100.7, 10.0.0.2"}, trusted, "198.51.100.7"},
+		{"spoofed entries", "10.0.0.1", []string{"1.1.1.1, 198.51.100.7"}, trusted, "198.51.100.7"},
+		{"several headers", "10.0.0.1", []string{"1.1.1.1", "198.51.100.7, 10.0.0.2"}, trusted, "198.51.100.7"},
+		{"malformed entry", "10.0.0.1", []string{"1.1.1.1, bogus, 10.0.0.2"}, trusted, "10.0.0.2"},
+		{"only proxies", "10.0.0.1", []string{"10.0.0.3, 10.0.0.2"}, trusted, "10.0.0.3"},
+		{"no header", "10.0.0.1", nil, trusted, "10.0.0.1"},
+		{"IPv6 proxy", "2001:db8::1", []string{"198.51.100.7"}, trusted, "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipRequest(t, tt.remote, tt.xff, func(c *fiber.Ctx) {
+				if got := ClientIP(c, tt.trusted, ""); got.String() != tt.want {
+					t.Errorf("Client IP should be %s, but got %s", tt.want, got)
+				}
+			})
+		})
+	}
+}
+
+func TestIPAccessRequestFilter(t *testing.T) {
+	countries := countryMap{"198.51.100.1": "DE", "198.51.100.2": "RU", "198.51.100.3": "US"}
+	tests := []struct {
+		name   string
+		filter IPAccessRequestFilter
+		remote string
+		status int
+	}{
+		{"no rules", IPAccessRequestFilter{}, "198.51.100.1", 0},
+		{"denied range", IPAccessRequestFilter{Deny: mustIPList(t, "198.51.100.0/24")}, "198.51.100.1", 403},
+		{"outside denied range", IPAccessRequestFilter{Deny: mustIPList(t, "198.51.100.0/24")}, "203.0.113.1", 0},
+		{"allowed address", IPAccessRequestFilter{Allow: mustIPList(t, "198.51.100.1")}, "198.51.100.1", 0},
+		{"not allowed", IPAccessRequestFilter{Allow: mustIPList(t, "198.51.100.1")}, "198.51.100.2", 403},
+		{"deny wins", IPAccessRequestFilter{Allow: mustIPList(t, "198.51.100.0/24"), Deny: mustIPList(t, "198.51.100.2")}, "198.51.100.2", 403},
+		{"denied country", IPAccessRequestFilter{DenyCountries: []string{"ru"}, Countries: countries}, "198.51.100.2", 403},
+		{"other country", IPAccessRequestFilter{DenyCountries: []string{"RU"}, Countries: countries}, "198.51.100.1", 0},
+		{"allowed country", IPAccessRequestFilter{AllowCountries: []string{"DE"}, Countries: countries}, "198.51.100.1", 0},
+		{"country not allowed", IPAccessRequestFilter{AllowCountries: []string{"DE"}, Countries: countries}, "198.51.100.3", 403},
+		{"unknown country not allowed", IPAccessRequestFilter{AllowCountries: []string{"DE"}, Countries: countries}, "203.0.113.1", 403},
+		{"allowed address outside countries", IPAccessRequestFilter{Allow: mustIPList(t, "198.51.100.3"), AllowCountries: []string{"DE"}, Countries: countries}, "198.51.100.3", 0},
+		{"custom status", IPAccessRequestFilter{Deny: mustIPList(t, "198.51.100.1"), Status: 404}, "198.51.100.1", 404},
+		{"lookup failure", IPAccessRequestFilter{AllowCountries: []string{"DE"}, Countries: countries}, "192.0.2.99", 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipRequest(t, tt.remote, nil, func(c *fiber.Ctx) {
+				err := tt.filter.OnRequest(c)
+				status := 0
+				if err != nil {
+					status = gateway.AsError(err).Status
+				}
+				if status != tt.status {
+					t.Errorf("Status code should be %d, but got %d (%v)", tt.status, status, err)
+				}
+			})
+		})
+	}
+
+	// The cause names the client for logs
+	ipRequest(t, "10.0.0.1", []string{"198.51.100.2"}, func(c *fiber.Ctx) {
+		f := IPAccessRequestFilter{DenyCountries: []string{"RU"}, Countries: countries, TrustedProxies: mustIPList(t, "10.0.0.0/8")}
+		err := f.OnRequest(c)
+		if cause := errors.Unwrap(err); cause == nil || !strings.Contains(cause.Error(), "198.51.100.2") || !strings.Contains(cause.Error(), "RU") {
+			t.Errorf("Cause should name the client and country, but got %v", cause)
+		}
+	})
+}
+
+func TestIPListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.txt")
+	write := func(data string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	write("# scanners\n198.51.100.0/24\n\n2001:db8::1  # single address\n", time.Now().Add(-time.Hour))
+
+	l, err := NewIPList([]string{"::ffff:203.0.113.0/120"}, path)
+	if err != nil {
+		t.Fatalf("Failed to load IP list: %v", err)
+	}
+	l.CheckInterval = time.Nanosecond
+	for addr, want := range map[string]bool{
+		"198.51.100.7":        true,
+		"::ffff:198.51.100.7": true,
+		"2001:db8::1":         true,
+		"2001:db8::2":         false,
+		"203.0.113.9":         true,
+		"192.0.2.1":           false,
+	} {
+		if got := l.Contains(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Contains(%s) should be %v, but got %v", addr, want, got)
+		}
+	}
+
+	// Changes are loaded in the background, the previous ranges being used meanwhile
+	write("192.0.2.0/24\n", time.Now())
+	l.Contains(netip.MustParseAddr("192.0.2.1"))
+	l.check.Wait()
+	if !l.Contains(netip.MustParseAddr("192.0.2.1")) || l.Contains(netip.MustParseAddr("198.51.100.7")) {
+		t.Error("Changed file should be reloaded")
+	}
+
+	var reloadErr error
+	l.OnReloadError = func(err error) { reloadErr = err }
+	write("192.0.2.0/24\nnot-an-address\n", time.Now().Add(time.Minute))
+	l.Contains(netip.MustParseAddr("192.0.2.1"))
+	l.check.Wait()
+	if reloadErr == nil {
+		t.Error("Invalid file should be reported")
+	}
+	if !l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("Invalid file should keep the previous ranges")
+	}
+	if err := l.Reload(); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("Reload error should name the line, but got %v", err)
+	}
+
+	if _, err := NewIPList([]string{"10.0.0.0/33"}, ""); err == nil {
+		t.Error("Invalid range should be rejected")
+	}
+}
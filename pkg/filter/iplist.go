@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+)
+
+// IPList is a set of IP ranges, given as CIDRs such as 10.0.0.0/8 or single
+// addresses. Ranges can also be read from a file, one per line with #
+// comments:
+//
+//	# office
+//	203.0.113.0/24
+//	2001:db8::1
+//
+// The file is reloaded when it changes, so ranges can be added or removed
+// without a restart. If a reload fails, the previous ranges are kept. It is
+// safe for concurrent use.
+type IPList struct {
+	// Path is the file ranges are read from, in addition to those given to
+	// NewIPList. No file is read when empty.
+	Path string
+	// CheckInterval is how often the file is checked for changes, 1s when 0.
+	CheckInterval time.Duration
+	// OnReloadError, if set, is called when the file changed but could not
+	// be loaded, e.g. to log it.
+	OnReloadError func(err error)
+
+	static []netip.Prefix
+
+	mu    sync.Mutex
+	file  []netip.Prefix
+	check reload.Checker
+}
+
+// NewIPList creates an IPList of entries and, if path is not empty, the
+// entries of the file at path.
+func NewIPList(entries []string, path string) (*IPList, error) {
+	l := &IPList{Path: path}
+	for _, entry := range entries {
+		prefix, err := ParseIPRange(entry)
+		if err != nil {
+			return nil, err
+		}
+		l.static = append(l.static, prefix)
+	}
+	if path != "" {
+		if err := l.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// ParseIPRange parses a CIDR or a single address, which becomes a range of
+// one address.
+func ParseIPRange(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IP range %q", s)
+		}
+		addr, bits := prefix.Addr(), prefix.Bits()
+		if addr.Is4In6() && bits >= 96 {
+			// Contains compares unmapped addresses
+			addr, bits = addr.Unmap(), bits-96
+		}
+		return netip.PrefixFrom(addr, bits).Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Reload reads the file.
+func (l *IPList) Reload() error {
+	version, err := l.version()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(l.Path)
+	if err != nil {
+		return err
+	}
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := ParseIPRange(entry)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", l.Path, line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	l.mu.Lock()
+	l.file = prefixes
+	l.mu.Unlock()
+	l.check.Loaded(version)
+	return nil
+}
+
+// Contains reports whether addr is in one of the ranges. If the file changed,
+// it is reloaded in the background and the previous ranges are used until
+// the reload completes.
+func (l *IPList) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l.static {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if l.Path == "" {
+		return false
+	}
+
+	// Keep the previous ranges if the new file is invalid
+	l.check.CheckInBackground(l.CheckInterval, l.version, l.Reload, l.OnReloadError)
+
+	l.mu.Lock()
+	file := l.file
+	l.mu.Unlock()
+	for _, prefix := range file {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *IPList) version() (string, error) {
+	return reload.FileVersion(l.Path)
+}
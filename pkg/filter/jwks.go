@@ -0,0 +1,272 @@
+package filter
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of JWKS.
+const (
+	DefaultJWKSRefresh    = 10 * time.Minute
+	DefaultJWKSMinRefresh = 30 * time.Second
+)
+
+// JWK is a key of a JWKS: an *rsa.PublicKey, *ecdsa.PublicKey,
+// ed25519.PublicKey or HMAC secret ([]byte).
+type JWK struct {
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+// JWKS is a JSON Web Key Set loaded from a URL or a file. Keys are cached for
+// Refresh, and reloaded sooner when a token names an unknown key ID, so that
+// rotated keys are picked up; such reloads happen at most every MinRefresh.
+// Keys are reloaded in the background and the previous keys are served
+// meanwhile; only callers with no key to use wait for the reload.
+// It is safe for concurrent use.
+type JWKS struct {
+	// URL or File is the source of the keys.
+	URL  string
+	File string
+	// Refresh is how long keys are cached, DefaultJWKSRefresh when 0.
+	Refresh time.Duration
+	// MinRefresh is the shortest interval between reloads, DefaultJWKSMinRefresh when 0.
+	MinRefresh time.Duration
+	// Client fetches URL, with a 10s timeout when nil.
+	Client *http.Client
+
+	mu      sync.Mutex
+	keys    []JWK
+	loaded  time.Time
+	tried   time.Time
+	lastErr error
+	// loading is closed when the reload in progress, if any, completes.
+	loading chan struct{}
+}
+
+// NewJWKS creates a JWKS for source, a URL when it starts with http:// or
+// https:// and a file path otherwise.
+func NewJWKS(source string) *JWKS {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return &JWKS{URL: source}
+	}
+	return &JWKS{File: source}
+}
+
+// StaticJWKS returns a JWKS holding keys, which is never reloaded.
+func StaticJWKS(keys ...JWK) *JWKS {
+	return &JWKS{keys: keys, loaded: time.Now(), Refresh: time.Duration(1<<63 - 1)}
+}
+
+// Keys returns the keys whose ID is kid, or every key when kid is empty. The
+// error wraps ErrJWKSUnavailable when the keys could not be loaded.
+func (s *JWKS) Keys(kid string) ([]JWK, error) {
+	s.mu.Lock()
+	now := time.Now()
+	stale := s.loaded.IsZero() || now.Sub(s.loaded) > s.refresh()
+	if stale && s.canReload(now) {
+		s.startReload(now)
+	}
+	keys := s.find(kid)
+	if len(keys) == 0 && kid != "" && s.canReload(now) {
+		// The key may have been rotated in
+		s.startReload(now)
+	}
+	if len(keys) == 0 && s.loading != nil {
+		loading := s.loading
+		s.mu.Unlock()
+		<-loading
+		s.mu.Lock()
+		keys = s.find(kid)
+	}
+	lastErr := s.lastErr
+	s.mu.Unlock()
+
+	if len(keys) == 0 {
+		if lastErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrJWKSUnavailable, lastErr)
+		}
+		return nil, fmt.Errorf("%w %q", errTokenKey, kid)
+	}
+	return keys, nil
+}
+
+func (s *JWKS) find(kid string) []JWK {
+	var keys []JWK
+	for _, k := range s.keys {
+		if kid == "" || k.ID == kid {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// canReload reports whether the keys have a source and were not loaded in
+// the last MinRefresh, successfully or not.
+func (s *JWKS) canReload(now time.Time) bool {
+	return (s.URL != "" || s.File != "") && now.Sub(s.tried) >= s.minRefresh()
+}
+
+// startReload loads the keys in the background unless a reload is already in
+// progress, keeping the previous keys if it fails. s.mu must be held.
+func (s *JWKS) startReload(now time.Time) {
+	s.tried = now
+	if s.loading != nil {
+		return
+	}
+	loading := make(chan struct{})
+	s.loading = loading
+	go func() {
+		defer close(loading)
+		data, err := s.fetch()
+		var keys []JWK
+		if err == nil {
+			keys, err = ParseJWKS(data)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.loading = nil
+		if err != nil {
+			s.lastErr = err
+			return
+		}
+		s.keys, s.loaded, s.lastErr = keys, time.Now(), nil
+	}()
+}
+
+func (s *JWKS) fetch() ([]byte, error) {
+	if s.File != "" {
+		return os.ReadFile(s.File)
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status %d", s.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func (s *JWKS) refresh() time.Duration {
+	if s.Refresh == 0 {
+		return DefaultJWKSRefresh
+	}
+	return s.Refresh
+}
+
+func (s *JWKS) minRefresh() time.Duration {
+	if s.MinRefresh == 0 {
+		return DefaultJWKSMinRefresh
+	}
+	return s.MinRefresh
+}
+
+// ParseJWKS parses a JWKS document ({"keys": [...]}). Keys that are not
+// signing keys, or of unsupported types, are skipped.
+func ParseJWKS(data []byte) ([]JWK, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	var keys []JWK
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key interface{}
+		var err error
+		switch {
+		case k.Kty == "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key, err = ecKey(k.X, k.Y)
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			var x []byte
+			if x, err = b64(k.X); err == nil && len(x) != ed25519.PublicKeySize {
+				err = errors.New("invalid Ed25519 key size")
+			}
+			key = ed25519.PublicKey(x)
+		case k.Kty == "oct":
+			key, err = b64(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys = append(keys, JWK{ID: k.Kid, Algorithm: k.Alg, Key: key})
+	}
+	return keys, nil
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := b64(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := b64(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if len(nb) < 256 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+func ecKey(x, y string) (*ecdsa.PublicKey, error) {
+	xb, err := b64(x)
+	if err != nil {
+		return nil, err
+	}
+	yb, err := b64(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if _, err := key.ECDH(); err != nil {
+		return nil, errors.New("invalid EC key")
+	}
+	return key, nil
+}
+
+// b64 decodes base64url without padding, as used by JOSE.
+func b64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
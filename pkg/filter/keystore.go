@@ -0,0 +1,184 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+	"gopkg.in/yaml.v3"
+)
+
+// Consumer is the client an API key belongs to.
+type Consumer struct {
+	// ID identifies the consumer, e.g. for rate limits and logs.
+	ID string `yaml:"consumer" json:"consumer"`
+	// Plan names the consumer's subscription, e.g. for quotas.
+	Plan string `yaml:"plan,omitempty" json:"plan,omitempty"`
+	// Metadata holds any other attributes of the consumer.
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+}
+
+// KeyStore looks up the Consumer of an API key.
+type KeyStore interface {
+	// Lookup returns the Consumer of key, or nil if the key is unknown or revoked.
+	Lookup(key string) (*Consumer, error)
+}
+
+// HashAPIKey returns the form in which KeyStores keep key: "sha256:" followed
+// by the hex SHA-256 of key. Keys are long random strings, so a plain hash
+// is enough to keep them out of configuration files and memory dumps.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// MemoryKeyStore is a KeyStore holding hashed keys in memory. Keys can be
+// added and revoked while it is used.
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]Consumer
+}
+
+// NewMemoryKeyStore creates an empty MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string]Consumer{}}
+}
+
+// Add registers key for consumer.
+func (s *MemoryKeyStore) Add(key string, consumer Consumer) {
+	s.AddHash(HashAPIKey(key), consumer)
+}
+
+// AddHash registers a key by its HashAPIKey hash.
+func (s *MemoryKeyStore) AddHash(hash string, consumer Consumer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[hash] = consumer
+}
+
+// Revoke removes key.
+func (s *MemoryKeyStore) Revoke(key string) {
+	s.RevokeHash(HashAPIKey(key))
+}
+
+// RevokeHash removes a key by its HashAPIKey hash.
+func (s *MemoryKeyStore) RevokeHash(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, hash)
+}
+
+// Lookup implements KeyStore.
+func (s *MemoryKeyStore) Lookup(key string) (*Consumer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	consumer, ok := s.keys[HashAPIKey(key)]
+	if !ok {
+		return nil, nil
+	}
+	return &consumer, nil
+}
+
+// FileKeyStore is a KeyStore reading hashed keys from a YAML or JSON file:
+//
+//	keys:
+//	  - hash: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	    consumer: mobile-app
+//	    plan: gold
+//	  - hash: sha256:...
+//	    consumer: partner
+//	    revoked: true
+//
+// The file is reloaded in the background when it changes, so keys can be
+// added or revoked without a restart. If a reload fails, the previous keys
+// are kept.
+type FileKeyStore struct {
+	Path string
+	// CheckInterval is how often the file is checked for changes, 1s when 0.
+	CheckInterval time.Duration
+	// OnReloadError, if set, is called when the file changed but could not
+	// be loaded, e.g. to log it.
+	OnReloadError func(err error)
+
+	mu    sync.Mutex
+	keys  *MemoryKeyStore
+	check reload.Checker
+}
+
+// NewFileKeyStore creates a FileKeyStore and loads path.
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{Path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// keyFile is the format of FileKeyStore files.
+type keyFile struct {
+	Keys []struct {
+		Hash     string `yaml:"hash"`
+		Revoked  bool   `yaml:"revoked"`
+		Consumer `yaml:",inline"`
+	} `yaml:"keys"`
+}
+
+// Reload reads the file.
+func (s *FileKeyStore) Reload() error {
+	version, err := s.version()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	// YAML also reads JSON
+	var file keyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", s.Path, err)
+	}
+
+	keys := NewMemoryKeyStore()
+	for i, k := range file.Keys {
+		if !strings.HasPrefix(k.Hash, "sha256:") || len(k.Hash) != len("sha256:")+64 {
+			return fmt.Errorf("%s: key %d: hash must be sha256: followed by 64 hex digits", s.Path, i+1)
+		}
+		if k.ID == "" {
+			return fmt.Errorf("%s: key %d: consumer is required", s.Path, i+1)
+		}
+		if !k.Revoked {
+			keys.AddHash(strings.ToLower(k.Hash), k.Consumer)
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	s.check.Loaded(version)
+	return nil
+}
+
+// Lookup implements KeyStore. If the file changed, it is reloaded in the
+// background and the previous keys are used until the reload completes.
+func (s *FileKeyStore) Lookup(key string) (*Consumer, error) {
+	// Keep serving the previous keys if the new file is invalid
+	s.check.CheckInBackground(s.CheckInterval, s.version, s.Reload, s.OnReloadError)
+
+	s.mu.Lock()
+	keys := s.keys
+	s.mu.Unlock()
+	if keys == nil {
+		return nil, fmt.Errorf("%s: keys not loaded", s.Path)
+	}
+	return keys.Lookup(key)
+}
+
+func (s *FileKeyStore) version() (string, error) {
+	return reload.FileVersion(s.Path)
+}
@@ -11,10 +11,13 @@ type AddHeaderRequestFilter struct {
 }
 
 func (f AddHeaderRequestFilter) OnRequest(c *fiber.Ctx) error {
-	c.Set(f.Key, f.Value)
+	c.Request().Header.Set(f.Key, f.Value)
 	return nil
 }
 
+// RewriteOnly marks the filter as a gateway.RewriteFilter.
+func (f AddHeaderRequestFilter) RewriteOnly() {}
+
 type RewritePathRequestFilter struct {
 	Pattern     *regexp.Regexp
 	Replacement string
@@ -26,3 +29,6 @@ func (f RewritePathRequestFilter) OnRequest(c *fiber.Ctx) error {
 	c.Request().URI().SetPath(newPath)
 	return nil
 }
+
+// RewriteOnly marks the filter as a gateway.RewriteFilter.
+func (f RewritePathRequestFilter) RewriteOnly() {}
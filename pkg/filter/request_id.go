@@ -0,0 +1,157 @@
+package filter
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// DefaultRequestIDHeader is the header RequestIDFilter uses by default.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// RequestIDFilter reads the request ID from Header or generates one, forwards
+// it upstream, echoes it in the response and records it in the request's
+// gateway.Exchange, where pkg/log picks it up.
+// It is both a request and a response filter. Use Middleware instead to
+// assign the ID before the gateway, so that every log line of the request
+// carries it.
+type RequestIDFilter struct {
+	// Header carries the ID, DefaultRequestIDHeader when empty.
+	Header string
+	// Generate creates IDs, NewUUIDv4 when nil.
+	Generate func() string
+	// Trust reuses IDs sent by clients; otherwise they are replaced.
+	Trust bool
+}
+
+// OnRequest assigns the request ID and forwards it upstream.
+func (f RequestIDFilter) OnRequest(c *fiber.Ctx) error {
+	id := f.assign(c)
+	c.Request().Header.Set(f.header(), id)
+	return nil
+}
+
+// OnResponse echoes the request ID in the response.
+func (f RequestIDFilter) OnResponse(c *fiber.Ctx) error {
+	if id := gateway.ExchangeOf(c).RequestID; id != "" {
+		c.Set(f.header(), id)
+	}
+	return nil
+}
+
+// Middleware returns a handler for app.Use that assigns the request ID
+// before the rest of the chain and echoes it in the response.
+func (f RequestIDFilter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := f.OnRequest(c); err != nil {
+			return err
+		}
+		err := c.Next()
+		f.OnResponse(c)
+		return err
+	}
+}
+
+// assign returns the ID of the request, choosing it on first use.
+func (f RequestIDFilter) assign(c *fiber.Ctx) string {
+	exchange := gateway.ExchangeOf(c)
+	if exchange.RequestID != "" {
+		return exchange.RequestID
+	}
+
+	id := ""
+	if f.Trust {
+		id = c.Get(f.header())
+		if !validRequestID(id) {
+			id = ""
+		}
+	}
+	if id == "" {
+		generate := f.Generate
+		if generate == nil {
+			generate = NewUUIDv4
+		}
+		id = generate()
+	}
+	exchange.RequestID = id
+	return id
+}
+
+func (f RequestIDFilter) header() string {
+	if f.Header == "" {
+		return DefaultRequestIDHeader
+	}
+	return f.Header
+}
+
+// validRequestID accepts short IDs of printable ASCII, so that client IDs
+// cannot inject anything into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDGenerator returns the generator of a format: "uuidv4", "uuidv7" or "ulid".
+func RequestIDGenerator(format string) (func() string, error) {
+	switch format {
+	case "", "uuid", "uuidv4":
+		return NewUUIDv4, nil
+	case "uuidv7":
+		return NewUUIDv7, nil
+	case "ulid":
+		return NewULID, nil
+	default:
+		return nil, fmt.Errorf("unknown request ID format %q", format)
+	}
+}
+
+// NewUUIDv4 returns a random UUID.
+func NewUUIDv4() string {
+	return uuid.NewString()
+}
+
+// NewUUIDv7 returns a time-ordered UUID.
+func NewUUIDv7() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return NewUUIDv4()
+	}
+	return id.String()
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID: a 48-bit millisecond timestamp followed by 80
+// random bits, as 26 Crockford base32 characters.
+func NewULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	// Encode 128 bits as 26 characters of 5 bits, the first holding only 3
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// echoHeaderProxy responds with the request ID it would send upstream.
+type echoHeaderProxy struct{}
+
+func (echoHeaderProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	return c.SendString(c.Get("X-Correlation-ID"))
+}
+
+func TestRequestIDFilter(t *testing.T) {
+	f := RequestIDFilter{Header: "X-Correlation-ID", Generate: func() string { return "generated" }, Trust: true}
+	gw := &gateway.Gateway{
+		ReverseProxy: echoHeaderProxy{},
+		Routes: []gateway.Route{
+			{
+				RequestFilters:  []gateway.RequestFilter{f},
+				ResponseFilters: []gateway.ResponseFilter{f},
+				Upstream:        "http://upstream",
+			},
+		},
+	}
+
+	// Create fiber app
+	app := fiber.New()
+	app.All("/*", gw.Handle)
+
+	tests := []struct {
+		name     string
+		incoming string
+		expected string
+	}{
+		{"generated", "", "generated"},
+		{"trusted", "abc-123", "abc-123"},
+		{"invalid", "bad id\n", "generated"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.incoming != "" {
+			req.Header.Set("X-Correlation-ID", tt.incoming)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Request test failed: %v", err)
+		}
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		if string(body[:n]) != tt.expected {
+			t.Errorf("%s: expected upstream to receive %q, got %q", tt.name, tt.expected, body[:n])
+		}
+		if got := resp.Header.Get("X-Correlation-ID"); got != tt.expected {
+			t.Errorf("%s: expected response header %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	patterns := map[string]*regexp.Regexp{
+		"uuidv4": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"uuidv7": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		"ulid":   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	}
+	for format, pattern := range patterns {
+		generate, err := RequestIDGenerator(format)
+		if err != nil {
+			t.Fatalf("Failed to get generator %s: %v", format, err)
+		}
+		if id := generate(); !pattern.MatchString(id) {
+			t.Errorf("Unexpected %s %q", format, id)
+		}
+	}
+
+	// ULIDs sort by time
+	first := NewULID()
+	second := NewULID()
+	if first[:10] > second[:10] {
+		t.Errorf("Expected %s to sort before %s", first, second)
+	}
+
+	if _, err := RequestIDGenerator("snowflake"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
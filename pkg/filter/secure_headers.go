@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Default values of the headers set by SecureHeadersResponseFilter.
+const (
+	DefaultStrictTransportSecurity = "max-age=31536000; includeSubDomains"
+	DefaultContentTypeOptions      = "nosniff"
+	DefaultFrameOptions            = "DENY"
+	DefaultContentSecurityPolicy   = "default-src 'self'; frame-ancestors 'none'; object-src 'none'"
+	DefaultReferrerPolicy          = "strict-origin-when-cross-origin"
+	DefaultPermissionsPolicy       = "camera=(), microphone=(), geolocation=(), payment=()"
+)
+
+// DefaultRemovedHeaders are the upstream headers identifying the server
+// software that SecureHeadersResponseFilter removes by default.
+var DefaultRemovedHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version"}
+
+// SecureHeadersResponseFilter sets security headers on responses and removes
+// headers identifying the upstream's server software. Headers with an empty
+// value are not set; NewSecureHeadersResponseFilter returns a filter with
+// the Default values, which routes can then override.
+//
+// It is both a RequestFilter and a ResponseFilter: responses the gateway
+// generates after it ran as a RequestFilter, such as errors of later filters
+// or of the upstream, CORS preflights and redirects, get the headers too, so
+// list it before the filters that can reject requests. Handler applies it to
+// every response of an app, those of no route included.
+type SecureHeadersResponseFilter struct {
+	StrictTransportSecurity string
+	ContentTypeOptions      string
+	FrameOptions            string
+	ContentSecurityPolicy   string
+	ReferrerPolicy          string
+	PermissionsPolicy       string
+	// Override replaces the values the upstream set for these headers. By
+	// default the upstream's are kept, as it knows best e.g. which scripts
+	// its pages load.
+	Override bool
+	// Remove lists the upstream headers removed from responses.
+	Remove []string
+}
+
+// NewSecureHeadersResponseFilter creates a SecureHeadersResponseFilter with
+// the default values.
+func NewSecureHeadersResponseFilter() SecureHeadersResponseFilter {
+	return SecureHeadersResponseFilter{
+		StrictTransportSecurity: DefaultStrictTransportSecurity,
+		ContentTypeOptions:      DefaultContentTypeOptions,
+		FrameOptions:            DefaultFrameOptions,
+		ContentSecurityPolicy:   DefaultContentSecurityPolicy,
+		ReferrerPolicy:          DefaultReferrerPolicy,
+		PermissionsPolicy:       DefaultPermissionsPolicy,
+		Remove:                  DefaultRemovedHeaders,
+	}
+}
+
+// OnRequest sets the headers on the response in advance, so that responses
+// generated without calling the upstream carry them.
+func (f SecureHeadersResponseFilter) OnRequest(c *fiber.Ctx) error {
+	f.set(c, true)
+	return nil
+}
+
+// OnResponse sets the headers.
+func (f SecureHeadersResponseFilter) OnResponse(c *fiber.Ctx) error {
+	header := &c.Response().Header
+	for _, name := range f.Remove {
+		header.Del(name)
+	}
+	f.set(c, f.Override)
+	return nil
+}
+
+// Handler is a middleware form of the filter, e.g. for app.Use, setting the
+// headers on every response, including errors and requests matching no route.
+func (f SecureHeadersResponseFilter) Handler(c *fiber.Ctx) error {
+	f.set(c, true)
+	err := c.Next()
+	f.OnResponse(c)
+	return err
+}
+
+// set sets the headers with a value, keeping those already set unless
+// override is true.
+func (f SecureHeadersResponseFilter) set(c *fiber.Ctx, override bool) {
+	header := &c.Response().Header
+	for _, h := range [...]struct{ name, value string }{
+		{fiber.HeaderStrictTransportSecurity, f.StrictTransportSecurity},
+		{fiber.HeaderXContentTypeOptions, f.ContentTypeOptions},
+		{fiber.HeaderXFrameOptions, f.FrameOptions},
+		{fiber.HeaderContentSecurityPolicy, f.ContentSecurityPolicy},
+		{fiber.HeaderReferrerPolicy, f.ReferrerPolicy},
+		{fiber.HeaderPermissionsPolicy, f.PermissionsPolicy},
+	} {
+		if h.value == "" || (!override && len(header.Peek(h.name)) > 0) {
+			continue
+		}
+		header.Set(h.name, h.value)
+	}
+}
@@ -0,0 +1,136 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// identifyingUpstream responds with headers naming its server software and a
+// content security policy of its own.
+type identifyingUpstream struct{}
+
+func (identifyingUpstream) Proxy(c *fiber.Ctx, upstream string) error {
+	c.Set(fiber.HeaderServer, "nginx/1.25.3")
+	c.Set(fiber.HeaderXPoweredBy, "PHP/8.3.0")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'self' cdn.example.com")
+	return c.SendString("ok")
+}
+
+func TestSecureHeadersResponseFilter(t *testing.T) {
+	custom := NewSecureHeadersResponseFilter()
+	custom.FrameOptions = "SAMEORIGIN"
+	custom.PermissionsPolicy = ""
+	overriding := NewSecureHeadersResponseFilter()
+	overriding.Override = true
+
+	tests := []struct {
+		name   string
+		filter SecureHeadersResponseFilter
+		want   map[string]string
+	}{
+		{"defaults", NewSecureHeadersResponseFilter(), map[string]string{
+			"Strict-Transport-Security": DefaultStrictTransportSecurity,
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Content-Security-Policy":   "default-src 'self' cdn.example.com",
+			"Referrer-Policy":           DefaultReferrerPolicy,
+			"Permissions-Policy":        DefaultPermissionsPolicy,
+			"Server":                    "",
+			"X-Powered-By":              "",
+		}},
+		{"overridden values", custom, map[string]string{
+			"X-Frame-Options":    "SAMEORIGIN",
+			"Permissions-Policy": "",
+		}},
+		{"override upstream", overriding, map[string]string{
+			"Content-Security-Policy": DefaultContentSecurityPolicy,
+		}},
+		{"keep upstream headers", SecureHeadersResponseFilter{ContentTypeOptions: "nosniff"}, map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"Strict-Transport-Security": "",
+			"Server":                    "nginx/1.25.3",
+			"X-Powered-By":              "PHP/8.3.0",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &gateway.Gateway{
+				ReverseProxy: identifyingUpstream{},
+				Routes: []gateway.Route{{
+					ResponseFilters: []gateway.ResponseFilter{tt.filter},
+					Upstream:        "http://upstream",
+				}},
+			}
+			app := fiber.New()
+			app.All("/*", gw.Handle)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("Status code should be %d, but got %d", fiber.StatusOK, resp.StatusCode)
+			}
+			for name, value := range tt.want {
+				if got := resp.Header.Get(name); got != value {
+					t.Errorf("%s should be %q, but got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSecureHeadersOnGatewayResponses(t *testing.T) {
+	f := NewSecureHeadersResponseFilter()
+	rejecting := HMACVerifyRequestFilter{Keys: NewHMACKeys(HMACKey{ID: "2025", Secret: []byte("secret")})}
+	gw := &gateway.Gateway{
+		ReverseProxy: identifyingUpstream{},
+		Routes: []gateway.Route{{
+			Predicates:      []gateway.Predicate{predicate.PathPredicate{Path: "/signed"}},
+			RequestFilters:  []gateway.RequestFilter{f, rejecting},
+			ResponseFilters: []gateway.ResponseFilter{f},
+			Upstream:        "http://upstream",
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		handler bool
+		path    string
+		status  int
+	}{
+		{"rejected by a later filter", false, "/signed", fiber.StatusUnauthorized},
+		{"no route, with the handler", true, "/other", fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+			if tt.handler {
+				app.Use(f.Handler)
+			}
+			app.All("/*", gw.Handle)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			for name, value := range map[string]string{
+				"Strict-Transport-Security": DefaultStrictTransportSecurity,
+				"X-Frame-Options":           DefaultFrameOptions,
+				"Content-Security-Policy":   DefaultContentSecurityPolicy,
+			} {
+				if got := resp.Header.Get(name); got != value {
+					t.Errorf("%s should be %q, but got %q", name, value, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Error is an error the gateway reports to clients. Message is safe to show;
+// the cause in Err is kept for logs and never rendered.
+// Compare Errors with errors.Is against the Err* values, which matches on Code.
+// errors.As also converts an Error to a *fiber.Error, so Fiber's default
+// error handler and status-based middleware see its Status.
+type Error struct {
+	// Status is the HTTP status of the response.
+	Status int
+	// Code identifies the kind of error, e.g. "upstream_timeout".
+	Code string
+	// Message describes the error to clients.
+	Message string
+	// Headers are set on the error response, e.g. Retry-After.
+	Headers map[string]string
+	// Err is the cause of the error.
+	Err error
+}
+
+// Errors reported by the gateway and its filters.
+var (
+	ErrNoRoute             = &Error{Status: http.StatusNotFound, Code: "no_route", Message: "No matching route found"}
+	ErrUpstreamUnavailable = &Error{Status: http.StatusBadGateway, Code: "upstream_unavailable", Message: "Upstream unavailable"}
+	ErrUpstreamTimeout     = &Error{Status: http.StatusGatewayTimeout, Code: "upstream_timeout", Message: "Upstream timed out"}
+	ErrRateLimited         = &Error{Status: http.StatusTooManyRequests, Code: "rate_limited", Message: "Too many requests"}
+	ErrUnauthorized        = &Error{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "Unauthorized"}
+	ErrForbidden           = &Error{Status: http.StatusForbidden, Code: "forbidden", Message: "Forbidden"}
+	ErrPayloadTooLarge     = &Error{Status: http.StatusRequestEntityTooLarge, Code: "payload_too_large", Message: "Payload too large"}
+	ErrInternal            = &Error{Status: http.StatusInternalServerError, Code: "internal", Message: "Internal server error"}
+)
+
+// Error returns Message, which Fiber's default error handler sends to
+// clients. Use Unwrap to log the cause.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the cause of the error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same Code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// As converts the Error to a *fiber.Error carrying its Status and Message.
+func (e *Error) As(target interface{}) bool {
+	if fe, ok := target.(**fiber.Error); ok {
+		*fe = fiber.NewError(e.Status, e.Message)
+		return true
+	}
+	return false
+}
+
+// Wrap returns a copy of the Error caused by err.
+func (e *Error) Wrap(err error) *Error {
+	c := e.copy()
+	c.Err = err
+	return c
+}
+
+// WithMessage returns a copy of the Error with another Message.
+func (e *Error) WithMessage(message string) *Error {
+	c := e.copy()
+	c.Message = message
+	return c
+}
+
+// WithHeader returns a copy of the Error that sets a response header.
+func (e *Error) WithHeader(name, value string) *Error {
+	c := e.copy()
+	c.Headers = make(map[string]string, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		c.Headers[k] = v
+	}
+	c.Headers[name] = value
+	return c
+}
+
+func (e *Error) copy() *Error {
+	c := *e
+	return &c
+}
+
+// UpstreamError classifies an error returned by a ReverseProxy as
+// ErrUpstreamTimeout or ErrUpstreamUnavailable. Errors that already are an
+// Error or a *fiber.Error are returned unchanged.
+func UpstreamError(err error) error {
+	var ge *Error
+	var fe *fiber.Error
+	if err == nil || errors.As(err, &ge) || errors.As(err, &fe) {
+		return err
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, fasthttp.ErrDialTimeout) ||
+		(errors.As(err, &ne) && ne.Timeout()) {
+		return ErrUpstreamTimeout.Wrap(err)
+	}
+	return ErrUpstreamUnavailable.Wrap(err)
+}
+
+// AsError returns err as an Error. A *fiber.Error becomes the Error of its
+// status, keeping its message; any other error becomes ErrInternal, so that
+// its details are not shown to clients.
+func AsError(err error) *Error {
+	var ge *Error
+	if errors.As(err, &ge) {
+		return ge
+	}
+	var fe *fiber.Error
+	if !errors.As(err, &fe) {
+		return ErrInternal.Wrap(err)
+	}
+
+	for _, known := range []*Error{ErrUnauthorized, ErrForbidden, ErrPayloadTooLarge, ErrRateLimited, ErrUpstreamUnavailable, ErrUpstreamTimeout} {
+		if known.Status == fe.Code {
+			return known.WithMessage(fe.Message)
+		}
+	}
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(fe.Code)), " ", "_")
+	if code == "" {
+		code = "error"
+	}
+	return &Error{Status: fe.Code, Code: code, Message: fe.Message}
+}
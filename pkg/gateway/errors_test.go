@@ -0,0 +1,144 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorProxy returns err for every request.
+type errorProxy struct {
+	err error
+}
+
+func (p errorProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	return p.err
+}
+
+// newErrorApp serves a single route proxied by proxy.
+func newErrorApp(proxy gateway.ReverseProxy, config fiber.Config) *fiber.App {
+	gw := &gateway.Gateway{
+		ReverseProxy: proxy,
+		Routes:       []gateway.Route{{ID: "api", Upstream: "http://api"}},
+	}
+	app := fiber.New(config)
+	app.All("/*", gw.Handle)
+	return app
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"connection refused", errors.New("dial tcp 10.0.0.1:80: connect: connection refused"), 502, "upstream_unavailable"},
+		{"timeout", fmt.Errorf("request: %w", context.DeadlineExceeded), 504, "upstream_timeout"},
+		{"gateway error", gateway.ErrRateLimited.WithHeader("Retry-After", "1"), 429, "rate_limited"},
+		{"fiber error", fiber.ErrRequestEntityTooLarge, 413, "payload_too_large"},
+	}
+
+	app := func(err error) *fiber.App {
+		return newErrorApp(errorProxy{err}, fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app(tt.err).Test(httptest.NewRequest("GET", "/orders", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type should be application/problem+json, but got %q", ct)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if strings.Contains(string(body), "10.0.0.1") {
+				t.Errorf("Body should not reveal the cause, but got %s", body)
+			}
+			var problem gateway.ErrorView
+			if err := json.Unmarshal(body, &problem); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			if problem.Code != tt.code || problem.Status != tt.status || problem.Type != "about:blank" || problem.Instance != "/orders" {
+				t.Errorf("Unexpected problem %+v", problem)
+			}
+		})
+	}
+
+	// Headers of the error are set on the response
+	resp, _ := app(gateway.ErrRateLimited.WithHeader("Retry-After", "1")).Test(httptest.NewRequest("GET", "/", nil))
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After should be 1, but got %q", got)
+	}
+}
+
+func TestErrorsWithDefaultHandler(t *testing.T) {
+	// Fiber's default handler sees the status, not the cause
+	app := newErrorApp(errorProxy{errors.New("connection refused")}, fiber.Config{})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 502 || string(body) != "Upstream unavailable" {
+		t.Errorf("Expected 502 Upstream unavailable, but got %d %s", resp.StatusCode, body)
+	}
+
+	if !errors.Is(gateway.UpstreamError(errors.New("refused")), gateway.ErrUpstreamUnavailable) {
+		t.Error("UpstreamError should match ErrUpstreamUnavailable")
+	}
+}
+
+func TestErrorRenderers(t *testing.T) {
+	tmpl, err := gateway.NewTemplateRenderer("text/html", `<p>{{.Code}}: {{.Detail}}</p>`)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		renderer    gateway.ErrorRenderer
+		contentType string
+		body        string
+	}{
+		{"html", gateway.HTMLRenderer(), "text/html; charset=utf-8", "<h1>404 Not Found</h1>"},
+		{"text", gateway.TextRenderer{}, "text/plain; charset=utf-8", "No matching route found"},
+		{"template", tmpl, "text/html", "<p>no_route: No matching route found</p>"},
+		{"problem type", gateway.ProblemRenderer{TypeBase: "https://errors.example.com/"}, "application/problem+json", `"type":"https://errors.example.com/no_route"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &gateway.Gateway{}
+			app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(tt.renderer)})
+			app.All("/*", gw.Handle)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/missing", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != 404 {
+				t.Errorf("Status code should be 404, but got %d", resp.StatusCode)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Content-Type should be %q, but got %q", tt.contentType, ct)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("Body should contain %q, but got %s", tt.body, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exchangeKey is the Locals key of the Exchange of a request.
+const exchangeKey = "floo.exchange"
+
+// Exchange records what the gateway did with a single request,
+// for middleware such as access logs that run around the gateway.
+type Exchange struct {
+	// RequestID correlates the request across logs, set by filter.RequestIDFilter.
+	RequestID string
+	// RouteID is the ID of the matched Route, empty when none matched.
+	RouteID string
+	// Upstream is the upstream the request was proxied to.
+	Upstream string
+	// UpstreamLatency is the time spent in the ReverseProxy.
+	UpstreamLatency time.Duration
+
+	hooks []Hook
+}
+
+// ExchangeOf returns the Exchange of the request, creating it on first use.
+func ExchangeOf(c *fiber.Ctx) *Exchange {
+	if e, ok := c.Locals(exchangeKey).(*Exchange); ok {
+		return e
+	}
+	e := &Exchange{}
+	c.Locals(exchangeKey, e)
+	return e
+}
+
+// Begin records that the request matched route.
+func (e *Exchange) Begin(route *Route) {
+	e.RouteID = route.ID
+	e.Upstream = route.Upstream
+}
+
+// TimeUpstream adds the time since start to UpstreamLatency.
+func (e *Exchange) TimeUpstream(start time.Time) {
+	e.UpstreamLatency += time.Since(start)
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Explanation describes how the Gateway would handle a request, without proxying it.
+type Explanation struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Routes holds the result of every Route, in match order.
+	Routes []RouteExplanation `json:"routes"`
+	// RouteIndex is the index of the chosen Route, or -1 if none matched.
+	RouteIndex int `json:"route_index"`
+	// RouteID is the ID of the chosen Route.
+	RouteID string `json:"route_id,omitempty"`
+	// RewrittenPath is the path after the chosen Route's RewriteFilters ran.
+	RewrittenPath string `json:"rewritten_path,omitempty"`
+	// UpstreamURL is the URL the request would be proxied to, query included.
+	UpstreamURL string `json:"upstream_url,omitempty"`
+	// SkippedFilters names the RequestFilters of the chosen Route that were
+	// not run because they are not RewriteFilters, e.g. authentication
+	// filters. They could still reject or answer the request.
+	SkippedFilters []string `json:"skipped_filters,omitempty"`
+	// FilterError is set when a RequestFilter rejected the request.
+	FilterError string `json:"filter_error,omitempty"`
+	// HandledBy names the RequestFilter that would send the response itself,
+	// see ErrHandled.
+	HandledBy string `json:"handled_by,omitempty"`
+}
+
+// RouteExplanation is the result of matching a single Route.
+type RouteExplanation struct {
+	Index      int               `json:"index"`
+	ID         string            `json:"id"`
+	Disabled   bool              `json:"disabled,omitempty"`
+	Predicates []PredicateResult `json:"predicates"`
+	Matched    bool              `json:"matched"`
+}
+
+// PredicateResult is the result of a single Predicate.
+type PredicateResult struct {
+	// Predicate describes the Predicate, e.g. "predicate.PathPredicate{Path:/api}".
+	Predicate string `json:"predicate"`
+	Matched   bool   `json:"matched"`
+}
+
+// Matched returns true if a Route was chosen.
+func (e *Explanation) Matched() bool {
+	return e.RouteIndex >= 0
+}
+
+// Explain evaluates every Predicate of every Route against the request and
+// runs the RewriteFilters of the chosen Route, but does not proxy the request.
+// The filters run on a copy of the request, so c is left as it was; the other
+// RequestFilters are skipped, as they could call other services or respond.
+func (g *Gateway) Explain(c *fiber.Ctx) *Explanation {
+	e := &Explanation{
+		Method:     c.Method(),
+		Path:       string(c.Request().URI().Path()),
+		RouteIndex: -1,
+	}
+
+	routes := g.Snapshot()
+	for i := range routes {
+		route := &routes[i]
+		re := RouteExplanation{Index: i, ID: route.ID, Disabled: route.Disabled, Matched: !route.Disabled}
+		for _, pred := range route.Predicates {
+			matched := pred.Match(c)
+			re.Predicates = append(re.Predicates, PredicateResult{Predicate: fmt.Sprintf("%T%+v", pred, pred), Matched: matched})
+			re.Matched = re.Matched && matched
+		}
+		if re.Matched && e.RouteIndex < 0 {
+			e.RouteIndex, e.RouteID = i, route.ID
+		}
+		e.Routes = append(e.Routes, re)
+	}
+
+	if !e.Matched() {
+		return e
+	}
+	route := &routes[e.RouteIndex]
+
+	fctx := &fasthttp.RequestCtx{}
+	c.Request().CopyTo(&fctx.Request)
+	dry := c.App().AcquireCtx(fctx)
+	defer c.App().ReleaseCtx(dry)
+	for _, rf := range route.RequestFilters {
+		if _, ok := rf.(RewriteFilter); !ok {
+			e.SkippedFilters = append(e.SkippedFilters, FilterName(rf))
+			continue
+		}
+		if err := rf.OnRequest(dry); errors.Is(err, ErrHandled) {
+			e.HandledBy = FilterName(rf)
+			return e
+		} else if err != nil {
+			e.FilterError = err.Error()
+			return e
+		}
+	}
+	e.RewrittenPath = string(dry.Request().URI().Path())
+	if route.Upstream != "" {
+		e.UpstreamURL = TargetURL(dry, route.Upstream)
+	}
+	return e
+}
+
+var (
+	explainAppOnce sync.Once
+	explainApp     *fiber.App
+)
+
+// ExplainRequest is like Explain for a net/http request, e.g. one built by a test
+// or a command line tool.
+func (g *Gateway) ExplainRequest(req *http.Request) (*Explanation, error) {
+	explainAppOnce.Do(func() {
+		explainApp = fiber.New()
+	})
+
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(req.Method)
+	fctx.Request.SetRequestURI(req.URL.String())
+	if req.Host != "" {
+		fctx.Request.Header.SetHost(req.Host)
+	}
+	for name, values := range req.Header {
+		for _, v := range values {
+			fctx.Request.Header.Add(name, v)
+		}
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		fctx.Request.SetBody(body)
+	}
+
+	c := explainApp.AcquireCtx(fctx)
+	defer explainApp.ReleaseCtx(c)
+	return g.Explain(c), nil
+}
+
+// WantsExplain reports whether the request asks for an Explanation through
+// ExplainHeader instead of being proxied, sending ExplainToken as its value.
+func (g *Gateway) WantsExplain(c *fiber.Ctx) bool {
+	if g.ExplainHeader == "" || g.ExplainToken == "" {
+		return false
+	}
+	value := c.Get(g.ExplainHeader)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(g.ExplainToken)) == 1
+}
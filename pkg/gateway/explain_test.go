@@ -0,0 +1,180 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// failingProxy fails the test if a request is proxied.
+type failingProxy struct {
+	t *testing.T
+}
+
+func (p failingProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	p.t.Errorf("Request should not be proxied to %s", upstream)
+	return nil
+}
+
+// loginFilter redirects to a login page, failing the test if it runs.
+type loginFilter struct {
+	t *testing.T
+}
+
+func (f loginFilter) OnRequest(c *fiber.Ctx) error {
+	f.t.Error("Filter with side effects should not run")
+	c.Cookie(&fiber.Cookie{Name: "state", Value: "abc"})
+	c.Status(http.StatusFound)
+	return gateway.ErrHandled
+}
+
+// maintenanceFilter answers every request itself without side effects.
+type maintenanceFilter struct{}
+
+func (maintenanceFilter) OnRequest(c *fiber.Ctx) error {
+	c.Status(http.StatusServiceUnavailable)
+	return gateway.ErrHandled
+}
+
+func (maintenanceFilter) RewriteOnly() {}
+
+func newExplainGateway(t *testing.T) *gateway.Gateway {
+	return &gateway.Gateway{
+		ReverseProxy:  failingProxy{t},
+		ExplainHeader: "X-Floo-Explain",
+		ExplainToken:  "s3cret",
+		Routes: []gateway.Route{
+			{
+				ID: "posts",
+				Predicates: []gateway.Predicate{
+					predicate.PathPrefixPredicate{Prefix: "/posts"},
+				},
+				Upstream: "http://posts",
+			},
+			{
+				ID: "todos",
+				Predicates: []gateway.Predicate{
+					predicate.PathPrefixPredicate{Prefix: "/api/todos"},
+					predicate.MethodPredicate{Method: "GET"},
+				},
+				RequestFilters: []gateway.RequestFilter{
+					loginFilter{t},
+					filter.RewritePathRequestFilter{Pattern: regexp.MustCompile(`^/api/(.*)`), Replacement: "/$1"},
+				},
+				Upstream: "http://todos",
+			},
+			{
+				ID: "maintenance",
+				Predicates: []gateway.Predicate{
+					predicate.PathPrefixPredicate{Prefix: "/legacy"},
+				},
+				RequestFilters: []gateway.RequestFilter{maintenanceFilter{}},
+				Upstream:       "http://legacy",
+			},
+		},
+	}
+}
+
+func TestExplainRequest(t *testing.T) {
+	gw := newExplainGateway(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/1?expand=user", nil)
+	e, err := gw.ExplainRequest(req)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+
+	if e.RouteIndex != 1 || e.RouteID != "todos" {
+		t.Errorf("Expected route todos to be chosen, got %d (%s)", e.RouteIndex, e.RouteID)
+	}
+	if len(e.Routes) != 3 || e.Routes[0].Matched || e.Routes[0].Predicates[0].Matched {
+		t.Errorf("Expected route posts to be rejected by its predicate: %+v", e.Routes)
+	}
+	if got := e.Routes[0].Predicates[0].Predicate; got != "predicate.PathPrefixPredicate{Prefix:/posts}" {
+		t.Errorf("Unexpected predicate description %s", got)
+	}
+	if e.RewrittenPath != "/todos/1" {
+		t.Errorf("Expected rewritten path /todos/1, got %s", e.RewrittenPath)
+	}
+	if e.UpstreamURL != "http://todos/todos/1?expand=user" {
+		t.Errorf("Expected upstream URL http://todos/todos/1?expand=user, got %s", e.UpstreamURL)
+	}
+	if len(e.SkippedFilters) != 1 || e.SkippedFilters[0] != "gateway_test.loginFilter" {
+		t.Errorf("Expected the login filter to be skipped, got %v", e.SkippedFilters)
+	}
+
+	// Filters sending the response themselves are reported
+	e, _ = gw.ExplainRequest(httptest.NewRequest(http.MethodGet, "/legacy/x", nil))
+	if e.HandledBy != "gateway_test.maintenanceFilter" || e.UpstreamURL != "" {
+		t.Errorf("Expected the request to be handled by the maintenance filter: %+v", e)
+	}
+
+	// The method predicate rejects POST
+	req = httptest.NewRequest(http.MethodPost, "/api/todos/1", nil)
+	e, _ = gw.ExplainRequest(req)
+	if e.Matched() {
+		t.Errorf("Expected no route to match, got %s", e.RouteID)
+	}
+	if p := e.Routes[1].Predicates; !p[0].Matched || p[1].Matched {
+		t.Errorf("Expected only the method predicate to fail: %+v", p)
+	}
+}
+
+func TestExplainHeader(t *testing.T) {
+	gw := newExplainGateway(t)
+	app := fiber.New()
+	app.All("/*", gw.Handle)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/todos/1", nil)
+	req.Header.Set("X-Floo-Explain", "s3cret")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+
+	var e gateway.Explanation
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("Failed to parse explanation: %v", err)
+	}
+	if e.RouteID != "todos" || e.UpstreamURL != "http://todos/todos/1" {
+		t.Errorf("Unexpected explanation %+v", e)
+	}
+	if cookie := resp.Header.Get("Set-Cookie"); cookie != "" {
+		t.Errorf("Skipped filters should not set cookies, but got %q", cookie)
+	}
+
+	// Without the token the header is ignored and the request proxied
+	gw.ReverseProxy = proxyFunc(func(c *fiber.Ctx, upstream string) error {
+		return c.SendString("proxied")
+	})
+	gw.Routes[1].RequestFilters = nil
+	for _, value := range []string{"1", "s3cre", ""} {
+		req = httptest.NewRequest(http.MethodGet, "/api/todos/1", nil)
+		req.Header.Set("X-Floo-Explain", value)
+		resp, err = app.Test(req)
+		if err != nil {
+			t.Fatalf("Request test failed: %v", err)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != "proxied" {
+			t.Errorf("Request with token %q should be proxied, but got %q", value, body)
+		}
+	}
+}
+
+// proxyFunc adapts a function to gateway.ReverseProxy.
+type proxyFunc func(c *fiber.Ctx, upstream string) error
+
+func (f proxyFunc) Proxy(c *fiber.Ctx, upstream string) error {
+	return f(c, upstream)
+}
@@ -1,6 +1,15 @@
 package gateway
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrHandled is returned by a RequestFilter that has sent the response itself,
+// e.g. a redirect to a login page. The remaining filters and the proxy are
+// skipped and the request succeeds.
+var ErrHandled = errors.New("request handled by filter")
 
 // RequestFilter only involves in pre-processing "requests"
 type RequestFilter interface {
@@ -11,3 +20,11 @@ type RequestFilter interface {
 type ResponseFilter interface {
 	OnResponse(c *fiber.Ctx) error
 }
+
+// RewriteFilter is implemented by RequestFilters that only rewrite the
+// request, e.g. its path or headers, without calling other services or
+// sending a response. Explain runs them and skips the other RequestFilters.
+type RewriteFilter interface {
+	RequestFilter
+	RewriteOnly()
+}
@@ -1,25 +1,44 @@
 package gateway
 
-import (
-	"net/http"
-
-	"github.com/gofiber/fiber/v2"
-)
+import "github.com/gofiber/fiber/v2"
 
 // Gateway contains multiple Routes and appropriately routes incoming requests
 type Gateway struct {
-	Routes       []Route
+	// Routes is used when Table is nil. It must not be modified while serving requests.
+	Routes []Route
+	// Table, if set, holds Routes that can be replaced while serving requests.
+	Table        *RouteTable
 	ReverseProxy ReverseProxy
+	// ExplainHeader, if set together with ExplainToken, names a request header
+	// that makes Handle respond with the request's Explanation as JSON instead
+	// of proxying it, when its value is ExplainToken. The Explanation exposes
+	// the routing configuration, so keep the token secret.
+	ExplainHeader string
+	ExplainToken  string
+}
+
+// Snapshot returns the Routes to use for a single request.
+func (g *Gateway) Snapshot() []Route {
+	if g.Table != nil {
+		return g.Table.Routes()
+	}
+	return g.Routes
 }
 
 // Handle is handler of Fiber
 func (g *Gateway) Handle(c *fiber.Ctx) error {
-	// Process the first matching Route from the defined Routes
-	for _, route := range g.Routes {
-		if route.Match(c) {
-			return route.Serve(c, g.ReverseProxy)
+	if g.WantsExplain(c) {
+		return c.JSON(g.Explain(c))
+	}
+
+	// Process the first matching Route, holding on to the same snapshot
+	// for the whole request even if the table is swapped meanwhile
+	routes := g.Snapshot()
+	for i := range routes {
+		if routes[i].Match(c) {
+			return routes[i].Serve(c, g.ReverseProxy)
 		}
 	}
 	// Return 404 when no matching route is found
-	return fiber.NewError(http.StatusNotFound, "No matching route found")
+	return ErrNoRoute
 }
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Stage is a step of serving a request.
+type Stage string
+
+const (
+	// StageRequestFilter runs a RequestFilter.
+	StageRequestFilter Stage = "request"
+	// StageProxy calls the upstream through the ReverseProxy.
+	StageProxy Stage = "proxy"
+	// StageResponseFilter runs a ResponseFilter.
+	StageResponseFilter Stage = "response"
+)
+
+// Hook observes the steps of a request, e.g. to record metrics or traces.
+// Hooks are attached to a single request with AddHook, usually by a middleware
+// running before the gateway.
+type Hook interface {
+	// Begin is called before a step runs and returns a function called with
+	// the step's result. Name is the filter type or the upstream.
+	Begin(c *fiber.Ctx, stage Stage, name string) func(err error)
+}
+
+// AddHook attaches h to the request.
+func AddHook(c *fiber.Ctx, h Hook) {
+	e := ExchangeOf(c)
+	e.hooks = append(e.hooks, h)
+}
+
+// BeginStage notifies the hooks of the request that a step begins and returns
+// the function to call with its result.
+func (e *Exchange) BeginStage(c *fiber.Ctx, stage Stage, name string) func(err error) {
+	switch len(e.hooks) {
+	case 0:
+		return func(error) {}
+	case 1:
+		return e.hooks[0].Begin(c, stage, name)
+	}
+	ends := make([]func(error), len(e.hooks))
+	for i, h := range e.hooks {
+		ends[i] = h.Begin(c, stage, name)
+	}
+	return func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+// FilterName names a filter in hooks, e.g. "filter.AddHeaderRequestFilter".
+func FilterName(f interface{}) string {
+	return fmt.Sprintf("%T", f)
+}
@@ -1,9 +1,33 @@
 package gateway
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 // ReverseProxy Interface
 // - Send a request to a specific Upstream and copy the result to fiber.Ctx
 type ReverseProxy interface {
 	Proxy(ctx *fiber.Ctx, upstream string) error
 }
+
+// TargetURL returns the URL the ReverseProxy implementations of Floo send
+// the request to: upstream, including its base path if any, followed by the
+// path and query of the request.
+func TargetURL(c *fiber.Ctx, upstream string) string {
+	target := upstream + string(c.Request().URI().Path())
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		target += "?" + string(query)
+	}
+	return target
+}
+
+// UpstreamPath returns the path of TargetURL, as the upstream receives it.
+func UpstreamPath(c *fiber.Ctx, upstream string) string {
+	base := ""
+	if u, err := url.Parse(upstream); err == nil {
+		base = u.Path
+	}
+	return base + string(c.Request().URI().Path())
+}
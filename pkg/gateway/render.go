@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorRenderer writes the response of an Error.
+type ErrorRenderer interface {
+	Render(c *fiber.Ctx, e *Error) error
+}
+
+// ErrorView is the data ErrorRenderers show, without the cause of the Error.
+type ErrorView struct {
+	// Type is a URI identifying the kind of error, "about:blank" by default.
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// NewErrorView describes e for the request of c. Type is typeBase followed
+// by the Code of e, or "about:blank" when typeBase is empty.
+func NewErrorView(c *fiber.Ctx, e *Error, typeBase string) ErrorView {
+	v := ErrorView{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  c.Path(),
+		Code:      e.Code,
+		RequestID: ExchangeOf(c).RequestID,
+	}
+	if typeBase != "" {
+		v.Type = typeBase + e.Code
+	}
+	if v.Title == "" {
+		v.Title = e.Message
+	}
+	return v
+}
+
+// ErrorHandler returns a fiber.ErrorHandler that renders errors with r,
+// ProblemRenderer{} when nil. Use it as fiber.Config.ErrorHandler.
+func ErrorHandler(r ErrorRenderer) fiber.ErrorHandler {
+	if r == nil {
+		r = ProblemRenderer{}
+	}
+	return func(c *fiber.Ctx, err error) error {
+		e := AsError(err)
+		for name, value := range e.Headers {
+			c.Set(name, value)
+		}
+		c.Status(e.Status)
+		return r.Render(c, e)
+	}
+}
+
+// ProblemRenderer writes Errors as application/problem+json (RFC 9457),
+// with the Code and request ID as extension members.
+type ProblemRenderer struct {
+	// TypeBase prefixes the Code of the Error to form the problem type URI,
+	// e.g. "https://errors.example.com/". The type is "about:blank" when empty.
+	TypeBase string
+}
+
+// Render implements ErrorRenderer.
+func (r ProblemRenderer) Render(c *fiber.Ctx, e *Error) error {
+	data, err := json.Marshal(NewErrorView(c, e, r.TypeBase))
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/problem+json")
+	return c.Send(data)
+}
+
+// TextRenderer writes the Message of Errors as plain text, like Fiber's
+// default error handler.
+type TextRenderer struct{}
+
+// Render implements ErrorRenderer.
+func (TextRenderer) Render(c *fiber.Ctx, e *Error) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(e.Message)
+}
+
+// DefaultHTMLTemplate is the page HTMLRenderer writes by default.
+const DefaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.Detail}}</p>
+{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`
+
+// TemplateRenderer executes a template with the ErrorView of Errors.
+type TemplateRenderer struct {
+	// Template is a text/template or html/template template.
+	Template interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+	// ContentType of the response.
+	ContentType string
+	// TypeBase is passed to NewErrorView.
+	TypeBase string
+}
+
+// NewTemplateRenderer parses a template rendering Errors as contentType.
+// HTML templates are parsed with html/template, so that values are escaped.
+func NewTemplateRenderer(contentType, text string) (*TemplateRenderer, error) {
+	r := &TemplateRenderer{ContentType: contentType}
+	var err error
+	if strings.HasPrefix(contentType, "text/html") {
+		r.Template, err = htmltemplate.New("error").Parse(text)
+	} else {
+		r.Template, err = template.New("error").Parse(text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error template: %w", err)
+	}
+	return r, nil
+}
+
+// HTMLRenderer returns a TemplateRenderer writing DefaultHTMLTemplate.
+func HTMLRenderer() *TemplateRenderer {
+	return &TemplateRenderer{
+		Template:    htmltemplate.Must(htmltemplate.New("error").Parse(DefaultHTMLTemplate)),
+		ContentType: fiber.MIMETextHTMLCharsetUTF8,
+	}
+}
+
+// Render implements ErrorRenderer.
+func (r *TemplateRenderer) Render(c *fiber.Ctx, e *Error) error {
+	var buf bytes.Buffer
+	if err := r.Template.Execute(&buf, NewErrorView(c, e, r.TypeBase)); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, r.ContentType)
+	return c.Send(buf.Bytes())
+}
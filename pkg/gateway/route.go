@@ -1,20 +1,29 @@
 package gateway
 
 import (
+	"errors"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	"net/http"
 )
 
 // Route contains Predicates, Filters, and Upstream.
 type Route struct {
+	// ID identifies the Route, e.g. in configuration files and logs.
+	ID              string
 	Predicates      []Predicate
 	RequestFilters  []RequestFilter
 	ResponseFilters []ResponseFilter
 	Upstream        string
+	// Disabled Routes never match.
+	Disabled bool
 }
 
 // Match checks if this Route matches the current request.
 func (r *Route) Match(c *fiber.Ctx) bool {
+	if r.Disabled {
+		return false
+	}
 	for _, pred := range r.Predicates {
 		if !pred.Match(c) {
 			return false
@@ -23,27 +32,52 @@ func (r *Route) Match(c *fiber.Ctx) bool {
 	return true
 }
 
-// Serve applies filters, then processes proxies to Upstream.
+// Serve applies filters, then processes proxies to Upstream. A RequestFilter
+// returning ErrHandled ends the request without proxying it.
+// Proxy failures are returned as ErrUpstreamUnavailable or ErrUpstreamTimeout.
+// The Route and the upstream latency are recorded in the request's Exchange,
+// and every step is reported to the request's Hooks.
 func (r *Route) Serve(c *fiber.Ctx, proxy ReverseProxy) error {
+	exchange := ExchangeOf(c)
+	exchange.Begin(r)
+
 	// 1) Apply all RequestFilters
 	for _, rf := range r.RequestFilters {
-		if err := rf.OnRequest(c); err != nil {
+		end := exchange.BeginStage(c, StageRequestFilter, FilterName(rf))
+		err := rf.OnRequest(c)
+		if errors.Is(err, ErrHandled) {
+			end(nil)
+			return nil
+		}
+		end(err)
+		if err != nil {
 			return err
 		}
 	}
 
-	// 2) Reverse Proxy if Upstream is set
-	if r.Upstream != "" && proxy != nil {
-		return proxy.Proxy(c, r.Upstream)
+	// 2) Return 404 when the Route has nowhere to proxy to
+	if r.Upstream == "" || proxy == nil {
+		return ErrNoRoute
 	}
 
-	// 3) Apply all ResponseFilters
+	// 3) Reverse Proxy to Upstream
+	end := exchange.BeginStage(c, StageProxy, r.Upstream)
+	start := time.Now()
+	err := UpstreamError(proxy.Proxy(c, r.Upstream))
+	exchange.TimeUpstream(start)
+	end(err)
+	if err != nil {
+		return err
+	}
+
+	// 4) Apply all ResponseFilters
 	for _, rf := range r.ResponseFilters {
-		if err := rf.OnResponse(c); err != nil {
+		end := exchange.BeginStage(c, StageResponseFilter, FilterName(rf))
+		err := rf.OnResponse(c)
+		end(err)
+		if err != nil {
 			return err
 		}
 	}
-
-	// 4) Return 404 when no matching route is found
-	return fiber.NewError(http.StatusNotFound, "No matching route found")
+	return nil
 }
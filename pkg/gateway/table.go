@@ -0,0 +1,33 @@
+package gateway
+
+import "sync/atomic"
+
+// RouteTable holds the Routes of a Gateway and lets them be replaced atomically
+// while requests are being served. The slices it hands out must not be modified.
+type RouteTable struct {
+	routes atomic.Pointer[[]Route]
+}
+
+// NewRouteTable creates a RouteTable containing routes.
+func NewRouteTable(routes []Route) *RouteTable {
+	t := &RouteTable{}
+	t.Swap(routes)
+	return t
+}
+
+// Routes returns the current Routes.
+func (t *RouteTable) Routes() []Route {
+	if routes := t.routes.Load(); routes != nil {
+		return *routes
+	}
+	return nil
+}
+
+// Swap replaces the Routes and returns the previous ones.
+// Requests that already took a snapshot keep using the previous Routes.
+func (t *RouteTable) Swap(routes []Route) []Route {
+	if old := t.routes.Swap(&routes); old != nil {
+		return *old
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+)
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is located
+// in, falling back to the country it is registered in, or "" if the database
+// has neither.
+func (r *Reader) Country(ip netip.Addr) (string, error) {
+	record, err := r.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	m, _ := record.(map[string]interface{})
+	for _, field := range []string{"country", "registered_country"} {
+		country, _ := m[field].(map[string]interface{})
+		if code, _ := country["iso_code"].(string); code != "" {
+			return strings.ToUpper(code), nil
+		}
+	}
+	return "", nil
+}
+
+// DB is a MaxMind DB file. The file is reloaded when it changes, e.g. when
+// geoipupdate downloads a new edition, without a restart. If a reload fails,
+// the previous database is kept. It is safe for concurrent use.
+type DB struct {
+	Path string
+	// CheckInterval is how often the file is checked for changes, 1s when 0.
+	CheckInterval time.Duration
+	// OnReloadError, if set, is called when the file changed but could not
+	// be loaded, e.g. to log it.
+	OnReloadError func(err error)
+
+	mu     sync.Mutex
+	reader *Reader
+	check  reload.Checker
+}
+
+// Open creates a DB and loads path.
+func Open(path string) (*DB, error) {
+	db := &DB{Path: path}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload reads the file.
+func (db *DB) Reload() error {
+	version, err := db.version()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(db.Path)
+	if err != nil {
+		return err
+	}
+	reader, err := NewReader(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.Path, err)
+	}
+
+	db.mu.Lock()
+	db.reader = reader
+	db.mu.Unlock()
+	db.check.Loaded(version)
+	return nil
+}
+
+// Reader returns the current database. If the file changed, it is reloaded in
+// the background and the previous database is returned until the reload
+// completes.
+func (db *DB) Reader() (*Reader, error) {
+	// Keep the previous database if the new file is invalid
+	db.check.CheckInBackground(db.CheckInterval, db.version, db.Reload, db.OnReloadError)
+
+	db.mu.Lock()
+	reader := db.reader
+	db.mu.Unlock()
+	if reader == nil {
+		return nil, fmt.Errorf("%s: database not loaded", db.Path)
+	}
+	return reader, nil
+}
+
+// Country looks up the country of ip as Reader.Country does.
+func (db *DB) Country(ip netip.Addr) (string, error) {
+	reader, err := db.Reader()
+	if err != nil {
+		return "", err
+	}
+	return reader.Country(ip)
+}
+
+func (db *DB) version() (string, error) {
+	return reload.FileVersion(db.Path)
+}
@@ -0,0 +1,241 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildDB encodes a MaxMind DB mapping prefixes to country codes, with IPv4
+// prefixes under ::/96 as in MaxMind's IPv6 databases. Countries repeated
+// after their first record are encoded as pointers to it.
+func buildDB(t testing.TB, recordSize uint, countries map[string]string) []byte {
+	t.Helper()
+	const (
+		empty = -1
+		data  = -2
+	)
+	type node struct {
+		child [2]int // node index, empty, or data - offset
+	}
+	nodes := []node{{child: [2]int{empty, empty}}}
+
+	var section []byte
+	offsets := map[string]int{}
+	for prefix, country := range countries {
+		p := netip.MustParsePrefix(prefix)
+		bits := p.Bits()
+		a := p.Addr().As16()
+		if p.Addr().Is4() {
+			bits += 96
+			a = [16]byte{}
+			v4 := p.Addr().As4()
+			copy(a[12:], v4[:])
+		}
+
+		offset, ok := offsets[country]
+		if !ok {
+			offset = len(section)
+			offsets[country] = offset
+			section = append(section, 0xe1) // map of 1 entry
+			section = appendString(section, "country")
+			section = append(section, 0xe1)
+			section = appendString(section, "iso_code")
+			section = appendString(section, country)
+		} else {
+			// Pointer to the first record, a pointer of size 0
+			target := offset
+			offset = len(section)
+			section = append(section, 0x20|byte(target>>8&0x7), byte(target))
+		}
+
+		n := 0
+		for i := 0; i < bits; i++ {
+			bit := int(a[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[n].child[bit] = data - offset
+				break
+			}
+			if nodes[n].child[bit] < 0 {
+				nodes = append(nodes, node{child: [2]int{empty, empty}})
+				nodes[n].child[bit] = len(nodes) - 1
+			}
+			n = nodes[n].child[bit]
+		}
+	}
+
+	count := len(nodes)
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint32
+		for i, c := range n.child {
+			switch {
+			case c == empty:
+				records[i] = uint32(count)
+			case c <= data:
+				records[i] = uint32(count + 16 + data - c)
+			default:
+				records[i] = uint32(c)
+			}
+		}
+		l, r := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xf0)|byte(r>>24&0x0f), byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, l)
+			tree = binary.BigEndian.AppendUint32(tree, r)
+		}
+	}
+
+	b := append(tree, make([]byte, 16)...)
+	b = append(b, section...)
+	b = append(b, metadataMarker...)
+	b = append(b, 0xe5) // map of 5 entries
+	b = appendString(b, "node_count")
+	b = append(b, 0xc4) // uint32 of 4 bytes
+	b = binary.BigEndian.AppendUint32(b, uint32(count))
+	b = appendString(b, "record_size")
+	b = append(b, 0xa1, byte(recordSize)) // uint16 of 1 byte
+	b = appendString(b, "ip_version")
+	b = append(b, 0xa1, 6)
+	b = appendString(b, "binary_format_major_version")
+	b = append(b, 0xa1, 2)
+	b = appendString(b, "database_type")
+	b = appendString(b, "Test-Country")
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(append(b, 0x40|byte(len(s))), s...)
+}
+
+func TestReaderCountry(t *testing.T) {
+	countries := map[string]string{
+		"1.2.3.0/24":    "DE",
+		"5.6.0.0/16":    "DE",
+		"9.9.9.0/24":    "ch",
+		"2001:db8::/32": "FR",
+	}
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.2.3.4", "DE"},
+		{"::ffff:1.2.3.200", "DE"},
+		{"5.6.7.8", "DE"},
+		{"9.9.9.9", "CH"},
+		{"1.2.4.1", ""},
+		{"2001:db8::1", "FR"},
+		{"2001:db9::1", ""},
+	}
+	for _, size := range []uint{24, 28, 32} {
+		r, err := NewReader(buildDB(t, size, countries))
+		if err != nil {
+			t.Fatalf("Failed to read %d-bit database: %v", size, err)
+		}
+		if r.DatabaseType != "Test-Country" {
+			t.Errorf("Database type should be Test-Country, but got %q", r.DatabaseType)
+		}
+		for _, tt := range tests {
+			got, err := r.Country(netip.MustParseAddr(tt.ip))
+			if err != nil {
+				t.Fatalf("Failed to look up %s: %v", tt.ip, err)
+			}
+			if got != tt.want {
+				t.Errorf("%d-bit records: country of %s should be %q, but got %q", size, tt.ip, tt.want, got)
+			}
+		}
+	}
+
+	if _, err := NewReader([]byte("not a database")); err == nil {
+		t.Error("Invalid database should be rejected")
+	}
+}
+
+func TestDBReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	write := func(data []byte, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("Failed to write database: %v", err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	write(buildDB(t, 24, map[string]string{"1.2.3.0/24": "DE"}), time.Now().Add(-time.Hour))
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.CheckInterval = time.Nanosecond
+	country := func() string {
+		t.Helper()
+		c, err := db.Country(netip.MustParseAddr("1.2.3.4"))
+		if err != nil {
+			t.Fatalf("Failed to look up: %v", err)
+		}
+		return c
+	}
+	if got := country(); got != "DE" {
+		t.Errorf("Country should be DE, but got %q", got)
+	}
+
+	// Updates are loaded in the background, the previous database being used meanwhile
+	write(buildDB(t, 24, map[string]string{"1.2.3.0/24": "AT"}), time.Now())
+	country()
+	db.check.Wait()
+	if got := country(); got != "AT" {
+		t.Errorf("Updated database should be loaded, but got %q", got)
+	}
+
+	write([]byte("truncated"), time.Now().Add(time.Minute))
+	country()
+	db.check.Wait()
+	if got := country(); got != "AT" {
+		t.Errorf("Invalid database should keep the previous one, but got %q", got)
+	}
+}
+
+// FuzzNewReader checks that malformed databases are rejected or looked up
+// with an error, never with a panic or an endless loop.
+func FuzzNewReader(f *testing.F) {
+	countries := map[string]string{"1.2.3.0/24": "DE", "5.6.0.0/16": "DE", "2001:db8::/32": "FR"}
+	for _, size := range []uint{24, 28, 32} {
+		f.Add(buildDB(f, size, countries), []byte{1, 2, 3, 4})
+	}
+	f.Add([]byte("not a database"), []byte(net.IPv6loopback))
+	f.Add(append([]byte{}, metadataMarker...), []byte{5, 6, 7, 8})
+	// Metadata of 15 nested arrays of 10 pointers to the next one, which
+	// would decode into 10^15 values
+	nested := append([]byte{}, metadataMarker...)
+	for level := 0; level < 15; level++ {
+		nested = append(nested, 0x0a, 0x04) // array of 10
+		next := (level + 1) * 22
+		for i := 0; i < 10; i++ {
+			nested = append(nested, 0x20|byte(next>>8), byte(next))
+		}
+	}
+	f.Add(append(nested, 0x41, 'x'), []byte{5, 6, 7, 8})
+
+	f.Fuzz(func(t *testing.T, db, ip []byte) {
+		r, err := NewReader(db)
+		if err != nil {
+			return
+		}
+		addrs := []netip.Addr{netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2001:db8::1")}
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addrs = append(addrs, addr)
+		}
+		for _, addr := range addrs {
+			r.Lookup(addr)
+			r.Country(addr)
+		}
+	})
+}
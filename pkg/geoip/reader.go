@@ -0,0 +1,331 @@
+// Package geoip looks up the country of IP addresses in a local MaxMind DB
+// file, such as GeoLite2-Country.mmdb or a DB-IP country database.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// metadataMarker precedes the metadata at the end of a MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// Reader looks up records in a MaxMind DB file read into memory. It is safe
+// for concurrent use.
+type Reader struct {
+	// DatabaseType is e.g. "GeoLite2-Country".
+	DatabaseType string
+
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// NewReader parses a MaxMind DB file.
+func NewReader(b []byte) (*Reader, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata not found")
+	}
+	d := decoder{buf: b[i+len(metadataMarker):]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("metadata: not a map")
+	}
+
+	r := &Reader{}
+	r.DatabaseType, _ = meta["database_type"].(string)
+	r.nodeCount, _ = metaUint(meta, "node_count")
+	r.recordSize, _ = metaUint(meta, "record_size")
+	r.ipVersion, _ = metaUint(meta, "ip_version")
+	if major, _ := metaUint(meta, "binary_format_major_version"); major != 2 {
+		return nil, fmt.Errorf("unsupported MaxMind DB format version %d", major)
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", r.ipVersion)
+	}
+
+	// The search tree is followed by 16 zero bytes, then the data section
+	if r.nodeCount > uint(i) {
+		return nil, errors.New("search tree larger than the file")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("search tree larger than the file")
+	}
+	r.tree, r.data = b[:treeSize], b[treeSize+16:i]
+
+	// IPv4 addresses are found under 96 zero bits in IPv6 trees
+	if r.ipVersion == 6 {
+		for n := 0; n < 96 && r.ipv4Start < r.nodeCount; n++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// Lookup returns the record of ip, decoded into maps, slices, strings, bools,
+// float64, uint64 and int64 values, or nil if the database has none.
+func (r *Reader) Lookup(ip netip.Addr) (interface{}, error) {
+	ip = ip.Unmap()
+	var bits []byte
+	node := uint(0)
+	if ip.Is4() {
+		a := ip.As4()
+		bits = a[:]
+		node = r.ipv4Start
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		a := ip.As16()
+		bits = a[:]
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node < r.nodeCount:
+		return nil, errors.New("invalid search tree: address deeper than the tree")
+	}
+
+	offset := node - r.nodeCount - 16
+	if offset >= uint(len(r.data)) {
+		return nil, errors.New("invalid search tree: record outside the data section")
+	}
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.tree[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func metaUint(meta map[string]interface{}, key string) (uint, bool) {
+	v, ok := meta[key].(uint64)
+	return uint(v), ok
+}
+
+// Data types of the MaxMind DB data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder decodes values of the MaxMind DB data section.
+type decoder struct {
+	buf    []byte
+	depth  int
+	values int
+}
+
+// maxDepth bounds the nesting of maps, arrays and pointers, which could
+// otherwise be infinite in a corrupt file.
+const maxDepth = 32
+
+// maxValues bounds the values decoded at once. Pointers let a corrupt file
+// reuse values, so that a few bytes of nested arrays decode into billions.
+const maxValues = 1 << 16
+
+var errTruncated = errors.New("invalid data section: value truncated")
+
+// decode decodes the value at offset and returns the offset following it.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	if d.values++; d.values > maxValues {
+		return nil, 0, errors.New("invalid data section: too many values")
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer || typ == typeMap || typ == typeArray {
+		if d.depth++; d.depth > maxDepth {
+			return nil, 0, errors.New("invalid data section: values nested too deeply")
+		}
+		defer func() { d.depth-- }()
+	}
+	if typ == typePointer {
+		// size holds the offset pointed to
+		v, _, err := d.decode(size)
+		return v, offset, err
+	}
+
+	var field []byte
+	switch typ {
+	case typeMap, typeArray:
+		// size counts entries, which take a byte at least
+		if size > uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+	case typeBool:
+		// size is the value
+	default:
+		if offset+size > uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		field = d.buf[offset : offset+size]
+	}
+
+	switch typ {
+	case typeString:
+		return string(field), offset + size, nil
+	case typeBytes:
+		return append([]byte(nil), field...), offset + size, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid data section: double of %d bytes", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(field)), offset + size, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid data section: float of %d bytes", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(field))), offset + size, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		if size > 8 {
+			// Larger than any value a country lookup needs
+			return append([]byte(nil), field...), offset + size, nil
+		}
+		var n uint64
+		for _, b := range field {
+			n = n<<8 | uint64(b)
+		}
+		return n, offset + size, nil
+	case typeInt32:
+		var n uint32
+		for _, b := range field {
+			n = n<<8 | uint32(b)
+		}
+		return int64(int32(n)), offset + size, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("invalid data section: map key is not a string")
+			}
+			if m[key], offset, err = d.decode(next); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			var err error
+			if a[i], offset, err = d.decode(offset); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("invalid data section: unexpected type %d", typ)
+	}
+}
+
+// control reads the control byte at offset and returns the type and size of
+// the value, or the target of a pointer, and the offset of its payload.
+func (d *decoder) control(offset uint) (typ, size, next uint, err error) {
+	read := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(d.buf)) {
+			return nil, errTruncated
+		}
+		b := d.buf[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	b, err := read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ctrl := b[0]
+	typ = uint(ctrl >> 5)
+	if typ == typePointer {
+		n := uint(ctrl>>3&0x3) + 1
+		if b, err = read(n); err != nil {
+			return 0, 0, 0, err
+		}
+		var p uint
+		if n < 4 {
+			p = uint(ctrl & 0x7)
+		}
+		for _, c := range b {
+			p = p<<8 | uint(c)
+		}
+		p += [...]uint{0, 2048, 526336, 0}[n-1]
+		return typ, p, offset, nil
+	}
+	if typ == typeExtended {
+		if b, err = read(1); err != nil {
+			return 0, 0, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = read(n); err != nil {
+			return 0, 0, 0, err
+		}
+		var extra uint
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		size = [...]uint{29, 285, 65821}[n-1] + extra
+	}
+	return typ, size, offset, nil
+}
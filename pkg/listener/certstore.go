@@ -0,0 +1,211 @@
+package listener
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+)
+
+// CertStore serves certificates from a directory by SNI host name. The
+// directory holds PEM pairs named <name>.crt and <name>.key, or <name>.pem
+// and <name>-key.pem; each certificate serves the DNS names it is valid for,
+// including wildcards such as *.example.com.
+//
+// The directory is checked for changes on handshakes, at most every
+// CheckInterval, and reloaded in the background when a file is added, removed
+// or modified. A pair that fails to load, e.g. while it is being replaced,
+// keeps serving its previous certificate. It is safe for concurrent use.
+type CertStore struct {
+	Dir string
+	// CheckInterval is how often the directory is checked for changes, 1s when 0.
+	CheckInterval time.Duration
+	// Default names the pair served to clients whose SNI matches no
+	// certificate, or that send none. The first pair by name when empty.
+	Default string
+	// OnReloadError, if set, is called when the directory changed but some
+	// pairs could not be loaded, e.g. to log it.
+	OnReloadError func(err error)
+
+	mu    sync.Mutex
+	pairs map[string]*tls.Certificate
+	hosts map[string]*tls.Certificate
+	check reload.Checker
+}
+
+// NewCertStore creates a CertStore and loads dir. It fails if dir holds no
+// valid pair.
+func NewCertStore(dir string) (*CertStore, error) {
+	s := &CertStore{Dir: dir}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	if len(s.pairs) == 0 {
+		return nil, fmt.Errorf("%s: no certificate and key pairs found", dir)
+	}
+	return s, nil
+}
+
+// Reload reads the directory. Pairs that fail to load keep their previous
+// certificate, and are reported in the error.
+func (s *CertStore) Reload() error {
+	files, state, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.pairs
+	s.mu.Unlock()
+
+	var errs []error
+	pairs := map[string]*tls.Certificate{}
+	for name, pair := range files {
+		cert, err := tls.LoadX509KeyPair(pair[0], pair[1])
+		if err == nil && cert.Leaf == nil {
+			cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pair[0], err))
+			if old, ok := previous[name]; ok {
+				pairs[name] = old
+			}
+			continue
+		}
+		pairs[name] = &cert
+	}
+
+	hosts := map[string]*tls.Certificate{}
+	names := make([]string, 0, len(pairs))
+	for name := range pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cert := pairs[name]
+		for _, host := range certHosts(cert.Leaf) {
+			if _, ok := hosts[host]; !ok {
+				hosts[host] = cert
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.pairs, s.hosts = pairs, hosts
+	s.mu.Unlock()
+	s.check.Loaded(state)
+	return errors.Join(errs...)
+}
+
+// GetCertificate returns the certificate for the SNI host name of hello, as
+// a tls.Config.GetCertificate callback.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.refresh()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cert := lookupHost(s.hosts, hello.ServerName); cert != nil {
+		return cert, nil
+	}
+	if cert, ok := s.pairs[s.Default]; ok {
+		return cert, nil
+	}
+	names := make([]string, 0, len(s.pairs))
+	for name := range s.pairs {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: no certificates loaded", s.Dir)
+	}
+	sort.Strings(names)
+	return s.pairs[names[0]], nil
+}
+
+// refresh reloads the directory in the background if it changed since the
+// last check; the previous certificates are served until the reload completes.
+func (s *CertStore) refresh() {
+	state := func() (string, error) {
+		_, state, err := s.scan()
+		return state, err
+	}
+	// Keep serving the previous certificates of pairs that fail to load
+	s.check.CheckInBackground(s.CheckInterval, state, s.Reload, s.OnReloadError)
+}
+
+// scan lists the pairs of the directory by name, and returns a string that
+// changes whenever one of their files does.
+func (s *CertStore) scan() (map[string][2]string, string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, "", err
+	}
+	present := map[string]bool{}
+	for _, e := range entries {
+		present[e.Name()] = true
+	}
+
+	pairs := map[string][2]string{}
+	var state strings.Builder
+	for _, e := range entries {
+		var name, key string
+		switch file := e.Name(); {
+		case strings.HasSuffix(file, ".crt"):
+			name = strings.TrimSuffix(file, ".crt")
+			key = name + ".key"
+		case strings.HasSuffix(file, ".pem") && !strings.HasSuffix(file, "-key.pem"):
+			name = strings.TrimSuffix(file, ".pem")
+			key = name + "-key.pem"
+		default:
+			continue
+		}
+		if !present[key] {
+			continue
+		}
+		pair := [2]string{filepath.Join(s.Dir, e.Name()), filepath.Join(s.Dir, key)}
+		pairs[name] = pair
+		for _, path := range pair {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, "", err
+			}
+			fmt.Fprintf(&state, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return pairs, state.String(), nil
+}
+
+// certHosts returns the lowercase host names cert is valid for.
+func certHosts(cert *x509.Certificate) []string {
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+	hosts := make([]string, len(names))
+	for i, name := range names {
+		hosts[i] = strings.ToLower(name)
+	}
+	return hosts
+}
+
+// lookupHost finds host in m, then the wildcard of its parent domain.
+func lookupHost[V any](m map[string]V, host string) V {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if v, ok := m[host]; ok {
+		return v
+	}
+	if _, parent, ok := strings.Cut(host, "."); ok {
+		if v, ok := m["*."+parent]; ok {
+			return v
+		}
+	}
+	var zero V
+	return zero
+}
@@ -0,0 +1,287 @@
+// Package listener opens the addresses a gateway is served on, terminating
+// TLS with certificates selected by SNI and reloaded when their files change.
+package listener
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/tlsutil"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrMisdirected is returned by CheckSNI for requests whose Host does not
+// match the TLS server name.
+var ErrMisdirected = &gateway.Error{Status: http.StatusMisdirectedRequest, Code: "misdirected_request", Message: "Misdirected request"}
+
+// Spec describes an address the gateway is served on.
+type Spec struct {
+	// Address is the host:port to listen on, e.g. ":8443".
+	Address string `yaml:"address" json:"address"`
+	// TLS serves HTTPS on the address. Plain HTTP is served when nil.
+	TLS *TLSSpec `yaml:"tls" json:"tls,omitempty"`
+}
+
+// TLSSpec configures TLS termination.
+type TLSSpec struct {
+	// CertDir holds the certificates selected by SNI (see CertStore).
+	CertDir string `yaml:"cert_dir" json:"cert_dir,omitempty"`
+	// DefaultCert names the pair of CertDir served when SNI matches no certificate.
+	DefaultCert string `yaml:"default_cert" json:"default_cert,omitempty"`
+	// Cert and Key are a single certificate pair, used instead of CertDir.
+	Cert string `yaml:"cert" json:"cert,omitempty"`
+	Key  string `yaml:"key" json:"key,omitempty"`
+	// MinVersion is the lowest TLS version accepted, "1.2" when empty.
+	MinVersion string `yaml:"min_version" json:"min_version,omitempty"`
+	// CipherSuites lists the TLS 1.0-1.2 cipher suites accepted, by their
+	// crypto/tls names; the crypto/tls defaults when empty. TLS 1.3 suites
+	// are not configurable.
+	CipherSuites []string `yaml:"cipher_suites" json:"cipher_suites,omitempty"`
+	// ClientCA and ClientAuth verify client certificates on every host name;
+	// see ClientAuthSpec.
+	ClientAuthSpec `yaml:",inline"`
+	// Hosts sets client certificate verification per SNI host name, which may
+	// be a wildcard such as *.internal.example.com, overriding ClientAuthSpec.
+	Hosts map[string]ClientAuthSpec `yaml:"hosts" json:"hosts,omitempty"`
+}
+
+// ClientAuthSpec configures client certificate verification.
+type ClientAuthSpec struct {
+	// ClientCA is a PEM file of the CAs client certificates must be signed by.
+	ClientCA string `yaml:"client_ca" json:"client_ca,omitempty"`
+	// ClientAuth is "require" (the default with ClientCA), "optional" or "none".
+	ClientAuth string `yaml:"client_auth" json:"client_auth,omitempty"`
+}
+
+// Build loads the certificates and returns the tls.Config.
+func (s *TLSSpec) Build() (*tls.Config, error) {
+	return s.build(nil)
+}
+
+// build is Build, setting onReloadError as the OnReloadError hook of the
+// certificates.
+func (s *TLSSpec) build(onReloadError func(err error)) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.MinVersion != "" {
+		v, err := tlsutil.ParseVersion(s.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinVersion = v
+	}
+	suites, err := ParseCipherSuites(s.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	cfg.CipherSuites = suites
+
+	switch {
+	case s.CertDir != "" && s.Cert != "":
+		return nil, errors.New("cert_dir and cert cannot be used together")
+	case s.CertDir != "":
+		store, err := NewCertStore(s.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		store.Default = s.DefaultCert
+		store.OnReloadError = onReloadError
+		cfg.GetCertificate = store.GetCertificate
+	case s.Cert != "" && s.Key != "":
+		reloader, err := tlsutil.NewCertReloader(s.Cert, s.Key)
+		if err != nil {
+			return nil, err
+		}
+		reloader.OnReloadError = onReloadError
+		cfg.GetCertificate = reloader.GetCertificate
+	default:
+		return nil, errors.New("cert_dir, or cert and key, are required")
+	}
+
+	if err := s.ClientAuthSpec.apply(cfg); err != nil {
+		return nil, err
+	}
+	if len(s.Hosts) == 0 {
+		return cfg, nil
+	}
+	hosts := make(map[string]*tls.Config, len(s.Hosts))
+	for host, spec := range s.Hosts {
+		hostCfg := cfg.Clone()
+		if err := spec.apply(hostCfg); err != nil {
+			return nil, fmt.Errorf("host %s: %w", host, err)
+		}
+		hosts[strings.ToLower(host)] = hostCfg
+	}
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		// nil keeps the base configuration
+		return lookupHost(hosts, hello.ServerName), nil
+	}
+	return cfg, nil
+}
+
+func (s ClientAuthSpec) apply(cfg *tls.Config) error {
+	switch s.ClientAuth {
+	case "", "require":
+		if s.ClientCA == "" {
+			if s.ClientAuth != "" {
+				return errors.New("client_auth require needs client_ca")
+			}
+			return nil
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		if s.ClientCA == "" {
+			return errors.New("client_auth optional needs client_ca")
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "none":
+		cfg.ClientAuth, cfg.ClientCAs = tls.NoClientCert, nil
+		return nil
+	default:
+		return fmt.Errorf("unknown client_auth %q, expected require, optional or none", s.ClientAuth)
+	}
+	pool, err := tlsutil.LoadCertPool(s.ClientCA)
+	if err != nil {
+		return err
+	}
+	cfg.ClientCAs = pool
+	return nil
+}
+
+// ParseCipherSuites converts cipher suite names, such as
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, to their IDs. Insecure suites are
+// rejected.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, len(names))
+	for i, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// Listen opens the addresses of specs, with TLS where they have TLS settings.
+// If one fails, the ones already opened are closed. onReloadError, if set, is
+// called when certificate files changed but could not be loaded, e.g. to log
+// it; the previous certificates keep being served.
+func Listen(specs []Spec, onReloadError func(err error)) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(specs))
+	closeAll := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+	for _, spec := range specs {
+		var cfg *tls.Config
+		if spec.TLS != nil {
+			var err error
+			if cfg, err = spec.TLS.build(onReloadError); err != nil {
+				closeAll()
+				return nil, fmt.Errorf("listener %s: %w", spec.Address, err)
+			}
+		}
+		ln, err := net.Listen("tcp", spec.Address)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if cfg != nil {
+			ln = tls.NewListener(ln, cfg)
+			if len(spec.TLS.Hosts) > 0 {
+				ln = hostsListener{ln}
+			}
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// Serve serves app on all listeners and returns when one of them stops,
+// e.g. because app was shut down, which closes them all.
+func Serve(app *fiber.App, listeners []net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners")
+	}
+	errc := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			errc <- app.Listener(ln)
+		}(ln)
+	}
+	return <-errc
+}
+
+// CheckSNI returns a handler enforcing the client certificate verification
+// per host name of specs (see TLSSpec.Hosts) with 421:
+//   - on listeners with Hosts, requests must send SNI, and their Host must
+//     be the server name they sent;
+//   - elsewhere, including plain HTTP listeners, requests must not address
+//     a host name of Hosts, which they would reach unverified.
+//
+// Otherwise a client could pass the verification of one host name, or skip
+// it, and then address another. The listeners must be opened by Listen.
+func CheckSNI(specs []Spec) fiber.Handler {
+	verified := map[string]bool{}
+	for _, spec := range specs {
+		if spec.TLS == nil {
+			continue
+		}
+		for host := range spec.TLS.Hosts {
+			verified[strings.ToLower(host)] = true
+		}
+	}
+	return func(c *fiber.Ctx) error {
+		host := c.Hostname()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(host, ".")
+		state := c.Context().TLSConnectionState()
+		if _, ok := c.Context().Conn().(hostsConn); ok {
+			if state.ServerName == "" || !strings.EqualFold(host, strings.TrimSuffix(state.ServerName, ".")) {
+				return ErrMisdirected
+			}
+			return c.Next()
+		}
+		if lookupHost(verified, host) {
+			return ErrMisdirected
+		}
+		if state != nil && state.ServerName != "" && !strings.EqualFold(host, strings.TrimSuffix(state.ServerName, ".")) {
+			return ErrMisdirected
+		}
+		return c.Next()
+	}
+}
+
+// hostsListener marks the connections of listeners verifying client
+// certificates per host name, for CheckSNI.
+type hostsListener struct {
+	net.Listener
+}
+
+// hostsConn is a connection accepted by a hostsListener.
+type hostsConn struct {
+	*tls.Conn
+}
+
+func (l hostsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return hostsConn{conn.(*tls.Conn)}, nil
+}
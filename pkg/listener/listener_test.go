@@ -0,0 +1,282 @@
+package listener
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+	"github.com/d0lim/floo/internal/testcert"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// writePair writes the certificate and key of cn to certFile and keyFile.
+func writePair(t *testing.T, ca *testcert.CA, certFile, keyFile, cn string, hosts ...string) {
+	t.Helper()
+	certPEM, keyPEM := ca.IssuePEM(t, cn, hosts...)
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+}
+
+func writeFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	os.Chtimes(path, mtime, mtime)
+}
+
+func TestCertStore(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	writePair(t, ca, filepath.Join(dir, "api.crt"), filepath.Join(dir, "api.key"), "api", "api.example.com")
+	writePair(t, ca, filepath.Join(dir, "example.pem"), filepath.Join(dir, "example-key.pem"), "example", "example.com", "*.example.com")
+	// Files without their pair are ignored
+	writeFile(t, filepath.Join(dir, "orphan.crt"), []byte("not a certificate"), time.Now())
+
+	store, err := NewCertStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+	store.CheckInterval = time.Nanosecond
+	// Changes are loaded in the background, so wait for them before checking
+	name := func(serverName string) string {
+		t.Helper()
+		store.refresh()
+		store.check.Wait()
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if err != nil {
+			t.Fatalf("Failed to get certificate: %v", err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.example.com", "api"},
+		{"API.Example.com.", "api"},
+		{"www.example.com", "example"},
+		{"example.com", "example"},
+		{"a.b.example.com", "api"},
+		{"", "api"},
+	}
+	for _, tt := range tests {
+		if got := name(tt.serverName); got != tt.want {
+			t.Errorf("Certificate for %q should be %s, but got %s", tt.serverName, tt.want, got)
+		}
+	}
+
+	store.Default = "example"
+	if got := name("unknown.org"); got != "example" {
+		t.Errorf("Unmatched SNI should get the default certificate, but got %s", got)
+	}
+
+	// Added and renewed pairs are picked up
+	writePair(t, ca, filepath.Join(dir, "www.crt"), filepath.Join(dir, "www.key"), "www", "www.example.com")
+	if got := name("www.example.com"); got != "www" {
+		t.Errorf("Added certificate should be served, but got %s", got)
+	}
+	writePair(t, ca, filepath.Join(dir, "api.crt"), filepath.Join(dir, "api.key"), "api-renewed", "api.example.com")
+	if got := name("api.example.com"); got != "api-renewed" {
+		t.Errorf("Renewed certificate should be served, but got %s", got)
+	}
+
+	// A half-replaced pair keeps the previous certificate
+	certPEM, _ := ca.IssuePEM(t, "api-broken", "api.example.com")
+	writeFile(t, filepath.Join(dir, "api.crt"), certPEM, time.Now().Add(time.Minute))
+	if got := name("api.example.com"); got != "api-renewed" {
+		t.Errorf("Mismatched pair should keep the previous certificate, but got %s", got)
+	}
+
+	// Removed pairs are no longer served
+	os.Remove(filepath.Join(dir, "www.crt"))
+	if got := name("www.example.com"); got != "example" {
+		t.Errorf("Removed certificate should not be served, but got %s", got)
+	}
+
+	if _, err := NewCertStore(t.TempDir()); err == nil {
+		t.Error("Empty directory should be rejected")
+	}
+}
+
+func TestListenPerHostClientAuth(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.PEM")
+	writeFile(t, caFile, ca.PEM, time.Now())
+	writePair(t, ca, filepath.Join(dir, "example.crt"), filepath.Join(dir, "example.key"), "example", "example.com", "*.example.com", "*.internal.example.com")
+	clientPEM, clientKeyPEM := ca.IssuePEM(t, "client")
+	client, _ := tls.X509KeyPair(clientPEM, clientKeyPEM)
+
+	specs := []Spec{
+		{Address: "127.0.0.1:0"},
+		{Address: "127.0.0.1:0", TLS: &TLSSpec{
+			CertDir:     dir,
+			DefaultCert: "example",
+			Hosts: map[string]ClientAuthSpec{
+				"admin.example.com":      {ClientCA: caFile},
+				"*.internal.example.com": {ClientCA: caFile, ClientAuth: "optional"},
+			},
+		}},
+	}
+	listeners, err := Listen(specs, nil)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(CheckSNI(specs))
+	app.Get("/", func(c *fiber.Ctx) error {
+		if state := c.Context().TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+			return c.SendString(state.PeerCertificates[0].Subject.CommonName)
+		}
+		return c.SendString("anonymous")
+	})
+	go Serve(app, listeners)
+	defer app.Shutdown()
+	plain, secure := listeners[0].Addr().String(), listeners[1].Addr().String()
+
+	get := func(url, serverName, host string, certs ...tls.Certificate) (int, string, error) {
+		t.Helper()
+		// Without a server name, the client sends no SNI for the IP address
+		// of the listener and cannot verify its certificate
+		tlsConfig := &tls.Config{RootCAs: ca.Pool, ServerName: serverName, Certificates: certs, InsecureSkipVerify: serverName == ""}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Host = host
+		resp, err := c.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), nil
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		serverName string
+		host       string
+		certs      []tls.Certificate
+		status     int
+		body       string
+		fails      bool
+	}{
+		{"plain HTTP", "http://" + plain + "/", "", "api.example.com", nil, 200, "anonymous", false},
+		{"no client auth", "https://" + secure + "/", "api.example.com", "api.example.com", nil, 200, "anonymous", false},
+		{"required without certificate", "https://" + secure + "/", "admin.example.com", "admin.example.com", nil, 0, "", true},
+		{"required with certificate", "https://" + secure + "/", "admin.example.com", "admin.example.com", []tls.Certificate{client}, 200, "client", false},
+		{"optional without certificate", "https://" + secure + "/", "db.internal.example.com", "db.internal.example.com", nil, 200, "anonymous", false},
+		{"optional with certificate", "https://" + secure + "/", "db.internal.example.com", "db.internal.example.com", []tls.Certificate{client}, 200, "client", false},
+		{"host differs from SNI", "https://" + secure + "/", "api.example.com", "admin.example.com", nil, 421, "", false},
+		{"no SNI", "https://" + secure + "/", "", "api.example.com", nil, 421, "", false},
+		{"no SNI for verified host", "https://" + secure + "/", "", "admin.example.com", []tls.Certificate{client}, 421, "", false},
+		{"plain HTTP for verified host", "http://" + plain + "/", "", "admin.example.com", nil, 421, "", false},
+		{"plain HTTP for verified wildcard host", "http://" + plain + "/", "", "db.internal.example.com", nil, 421, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := get(tt.url, tt.serverName, tt.host, tt.certs...)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("Request should fail, but got %d", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if status != tt.status {
+				t.Errorf("Status code should be %d, but got %d", tt.status, status)
+			}
+			if tt.body != "" && body != tt.body {
+				t.Errorf("Body should be %q, but got %q", tt.body, body)
+			}
+		})
+	}
+}
+
+func TestTLSSpecBuild(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "gateway.crt"), filepath.Join(dir, "gateway.key")
+	writePair(t, ca, certFile, keyFile, "gateway", "gateway.example.com")
+
+	cfg, err := (&TLSSpec{Cert: certFile, Key: keyFile, MinVersion: "1.3", CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}).Build()
+	if err != nil {
+		t.Fatalf("Failed to build TLS config: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Min version should be TLS 1.3, but got %x", cfg.MinVersion)
+	}
+	if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Cipher suites should be set, but got %v", cfg.CipherSuites)
+	}
+	if cfg, _ := (&TLSSpec{Cert: certFile, Key: keyFile}).Build(); cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Min version should default to TLS 1.2, but got %x", cfg.MinVersion)
+	}
+
+	tests := []struct {
+		name string
+		spec TLSSpec
+	}{
+		{"no certificates", TLSSpec{}},
+		{"cert_dir and cert", TLSSpec{CertDir: dir, Cert: certFile, Key: keyFile}},
+		{"unknown version", TLSSpec{Cert: certFile, Key: keyFile, MinVersion: "2.0"}},
+		{"insecure cipher suite", TLSSpec{Cert: certFile, Key: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}},
+		{"unknown client auth", TLSSpec{Cert: certFile, Key: keyFile, ClientAuthSpec: ClientAuthSpec{ClientCA: certFile, ClientAuth: "always"}}},
+		{"client auth without CA", TLSSpec{Cert: certFile, Key: keyFile, Hosts: map[string]ClientAuthSpec{"a.example.com": {ClientAuth: "optional"}}}},
+		{"missing CA", TLSSpec{Cert: certFile, Key: keyFile, ClientAuthSpec: ClientAuthSpec{ClientCA: filepath.Join(dir, "missing.pem")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.spec.Build(); err == nil {
+				t.Error("Build should fail")
+			}
+		})
+	}
+}
+
+func TestTLSSpecReportsReloadErrors(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "gateway.crt"), filepath.Join(dir, "gateway.key")
+	writePair(t, ca, certFile, keyFile, "gateway", "gateway.example.com")
+
+	specs := map[string]*TLSSpec{
+		"cert":     {Cert: certFile, Key: keyFile},
+		"cert_dir": {CertDir: dir},
+	}
+	configs := map[string]*tls.Config{}
+	errs := map[string]chan error{}
+	for name, spec := range specs {
+		reported := make(chan error, 1)
+		cfg, err := spec.build(func(err error) { reported <- err })
+		if err != nil {
+			t.Fatalf("Failed to build TLS config: %v", err)
+		}
+		configs[name], errs[name] = cfg, reported
+	}
+
+	// A broken renewal keeps the previous certificate, and is reported
+	writeFile(t, certFile, []byte("not a certificate"), time.Now().Add(time.Minute))
+	time.Sleep(reload.DefaultInterval)
+	for name, cfg := range configs {
+		cert, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "gateway.example.com"})
+		if err != nil || cert.Leaf.Subject.CommonName != "gateway" {
+			t.Errorf("%s: The previous certificate should be kept, but got %v", name, err)
+		}
+		select {
+		case <-errs[name]:
+		case <-time.After(time.Second):
+			t.Errorf("%s: The failed reload should be reported", name)
+		}
+	}
+}
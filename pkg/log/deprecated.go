@@ -0,0 +1,132 @@
+package log
+
+import (
+	"log"
+	"sync"
+)
+
+// The package-level logger below only backs the deprecated functions, kept
+// for one release for code written before loggers were instance-scoped.
+var (
+	sharedMu     sync.Mutex
+	sharedLevels        = NewLevels(InfoLevel)
+	sharedLogger Logger = &StandardLogger{logger: log.Default(), levels: sharedLevels}
+)
+
+// SetLogLevel sets the level of the logger returned by GetLogger.
+//
+// Deprecated: create a Logger with New and WithLevels, and change the Levels.
+func SetLogLevel(level LogLevel) {
+	sharedLevels.Set(level)
+}
+
+// GetLogLevel returns the level of the logger returned by GetLogger.
+//
+// Deprecated: use Levels.Level.
+func GetLogLevel() LogLevel {
+	return sharedLevels.Level("")
+}
+
+// IsDebugEnabled checks if debug logging is enabled for the logger returned
+// by GetLogger.
+//
+// Deprecated: use Logger.Enabled.
+func IsDebugEnabled() bool {
+	return GetLogLevel() <= DebugLevel
+}
+
+// GetLogger returns the package-level logger, configured by ConfigureLogger.
+//
+// Deprecated: create a Logger with New and pass it where it is needed.
+func GetLogger() Logger {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	return sharedLogger
+}
+
+// ConfigureLogger configures the format and output of the logger returned by
+// GetLogger. With JSONFormat or LogfmtFormat it writes through a SlogLogger
+// to the log package's output; only the Date and Time flags apply to it, and
+// prefix is ignored.
+//
+// Deprecated: use New with WithFlags.
+func ConfigureLogger(flags LogFlags, prefix string) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if flags.Format == JSONFormat || flags.Format == LogfmtFormat {
+		sharedLogger = newHandlerLogger(flags.Format, stdWriter{}, sharedLevels, flags.Date || flags.Time)
+		return
+	}
+	log.SetFlags(stdFlags(flags))
+	log.SetPrefix(prefix)
+	sharedLogger = &StandardLogger{logger: log.Default(), levels: sharedLevels}
+}
+
+// ConfigureDefaultLogger configures the logger returned by GetLogger with
+// common log format settings.
+//
+// Deprecated: use New, whose defaults are the same but for the file name.
+func ConfigureDefaultLogger() {
+	ConfigureLogger(LogFlags{
+		Date: true,
+		Time: true,
+		File: true,
+	}, "[FLOO] ")
+}
+
+// CaptureLogsToBuffer redirects the output of the log package, and so of the
+// logger returned by GetLogger, to a buffer. The returned function restores
+// the original output when called.
+//
+// Deprecated: create a Logger with New and WithOutput.
+func CaptureLogsToBuffer(buffer *Buffer) func() {
+	original := log.Writer()
+	log.SetOutput(buffer)
+	return func() {
+		log.SetOutput(original)
+	}
+}
+
+// stdWriter writes to the current output of the log package, so that
+// CaptureLogsToBuffer also applies to structured loggers.
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	return log.Writer().Write(p)
+}
+
+// sharedLoggerRef logs through the logger returned by GetLogger at the time
+// of each call, so that it follows ConfigureLogger.
+type sharedLoggerRef struct{}
+
+func (sharedLoggerRef) Debug(component ComponentType, format string, v ...interface{}) {
+	GetLogger().Debug(component, format, v...)
+}
+
+func (sharedLoggerRef) Info(component ComponentType, format string, v ...interface{}) {
+	GetLogger().Info(component, format, v...)
+}
+
+func (sharedLoggerRef) Warn(component ComponentType, format string, v ...interface{}) {
+	GetLogger().Warn(component, format, v...)
+}
+
+func (sharedLoggerRef) Error(component ComponentType, format string, v ...interface{}) {
+	GetLogger().Error(component, format, v...)
+}
+
+func (sharedLoggerRef) Timed(component ComponentType, format string, v ...interface{}) func(result string) {
+	return GetLogger().Timed(component, format, v...)
+}
+
+func (sharedLoggerRef) TimedWith(component ComponentType, format string, v ...interface{}) func(result string, args ...interface{}) {
+	return GetLogger().TimedWith(component, format, v...)
+}
+
+func (sharedLoggerRef) Enabled(component ComponentType, level LogLevel) bool {
+	return GetLogger().Enabled(component, level)
+}
+
+func (sharedLoggerRef) With(args ...interface{}) Logger {
+	return GetLogger().With(args...)
+}
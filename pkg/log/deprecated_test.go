@@ -0,0 +1,75 @@
+package log
+
+import (
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/reverseproxy"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDeprecatedSharedLogger(t *testing.T) {
+	buffer := NewBuffer()
+	restore := CaptureLogsToBuffer(buffer)
+	defer restore()
+	defer SetLogLevel(GetLogLevel())
+	defer stdlog.SetFlags(stdlog.Flags())
+	defer stdlog.SetPrefix(stdlog.Prefix())
+	defer ConfigureLogger(LogFlags{}, "")
+
+	ConfigureLogger(LogFlags{}, "[TEST] ")
+	SetLogLevel(DebugLevel)
+	if !IsDebugEnabled() {
+		t.Error("Debug logging should be enabled")
+	}
+	GetLogger().Debug(ProxyComponent, "text line")
+
+	ConfigureLogger(LogFlags{Format: JSONFormat}, "")
+	SetLogLevel(WarnLevel)
+	GetLogger().Info(ProxyComponent, "filtered line")
+	GetLogger().Warn(ProxyComponent, "json line")
+
+	// The original signature of Timed still compiles
+	var done func(string) = GetLogger().Timed(ProxyComponent, "task")
+	done("ok")
+
+	output := buffer.String()
+	if !strings.Contains(output, "[TEST] [Proxy][DEBUG] text line") {
+		t.Errorf("Text line not found in %q", output)
+	}
+	if !strings.Contains(output, `"msg":"json line"`) {
+		t.Errorf("JSON line not found in %q", output)
+	}
+	if strings.Contains(output, "filtered line") {
+		t.Errorf("Info line should be filtered at warn level: %q", output)
+	}
+}
+
+func TestWrappersFollowSharedLogger(t *testing.T) {
+	buffer := NewBuffer()
+	restore := CaptureLogsToBuffer(buffer)
+	defer restore()
+	defer SetLogLevel(GetLogLevel())
+	defer stdlog.SetFlags(stdlog.Flags())
+	defer stdlog.SetPrefix(stdlog.Prefix())
+	defer ConfigureLogger(LogFlags{}, "")
+
+	// Configured after the wrapper is created, as older code may do
+	proxy := NewProxyLogger(&reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{StatusCode: 200}})
+	ConfigureLogger(LogFlags{}, "[TEST] ")
+	SetLogLevel(DebugLevel)
+
+	app := fiber.New()
+	app.Get("/test", func(c *fiber.Ctx) error {
+		return proxy.Proxy(c, "https://example.com")
+	})
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/test", nil)); err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if output := buffer.String(); !strings.Contains(output, "[TEST] [Proxy][DEBUG] Target URL: https://example.com/test") {
+		t.Errorf("Debug line of the shared logger not found in %q", output)
+	}
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,115 +16,146 @@ type GatewayLogger struct {
 }
 
 // NewGatewayLogger creates a logging gateway that wraps an existing Gateway.
-func NewGatewayLogger(gw gateway.Gateway) *GatewayLogger {
+// Without options choosing the Logger (see New), it logs through the
+// package-level logger, configured by the deprecated SetLogLevel and
+// ConfigureLogger while they exist.
+func NewGatewayLogger(gw gateway.Gateway, opts ...Option) *GatewayLogger {
 	return &GatewayLogger{
 		Gateway: gw,
-		Logger:  GetLogger(),
+		Logger:  newWrapperLogger(opts),
 	}
 }
 
-// Handle wraps Gateway.Handle to add logging.
+// Handle wraps Gateway.Handle to add logging. Matched routes are served by
+// gateway.Route.Serve, whose steps are logged through a gateway.Hook.
 func (lg *GatewayLogger) Handle(c *fiber.Ctx) error {
 	start := time.Now()
 	logger := lg.Logger
+	exchange := gateway.ExchangeOf(c)
+	if exchange.RequestID != "" {
+		logger = logger.With("request_id", exchange.RequestID)
+	}
 
-	path := c.Path()
-	method := c.Method()
-
-	logger.Info(GatewayComponent, "Request received: path=%s, method=%s", path, method)
-
-	// Try to match from defined Routes
-	matchFound := false
+	if lg.Gateway.WantsExplain(c) {
+		logger.Info(GatewayComponent, "Explain requested: path=%s, method=%s", c.Path(), c.Method())
+		return lg.Gateway.Handle(c)
+	}
 
-	// Iterate through each route to check for a match
-	for i, route := range lg.Gateway.Routes {
-		routeStart := time.Now()
+	path := c.Path()
+	logger.Info(GatewayComponent, "Request received: path=%s, method=%s", path, c.Method())
 
-		// Log predicate matching
-		logger.Debug(GatewayComponent, "Route[%d] matching started: %d predicates", i, len(route.Predicates))
+	// Hold on to the same snapshot for the whole request, as Gateway.Handle does
+	routes := lg.Gateway.Snapshot()
+	for i := range routes {
+		route := &routes[i]
+		if !lg.match(logger, c, i, route) {
+			continue
+		}
 
-		// Check each predicate individually
-		allPredicatesMatched := true
-		for j, pred := range route.Predicates {
-			predMatch := pred.Match(c)
-			logger.Debug(GatewayComponent, "  Predicate[%d]: %T matching result=%v", j, pred, predMatch)
+		// Later lines of this request carry the route ID and upstream
+		hook := &logHook{logger: logger.With("route_id", route.ID, "upstream", route.Upstream), requestID: exchange.RequestID}
+		hook.logger.Info(GatewayComponent, "Route[%d] matching successful", i)
+		gateway.AddHook(c, hook)
 
-			if !predMatch {
-				allPredicatesMatched = false
-				break
-			}
+		err := route.Serve(c, lg.Gateway.ReverseProxy)
+		logger = hook.logger
+		if err != nil {
+			logger.Error(GatewayComponent, "Request processing failed: elapsed time=%s", time.Since(start))
+			return err
 		}
+		logger.With("status", c.Response().StatusCode(), "latency", time.Since(start)).
+			Info(GatewayComponent, "Request processing completed: path=%s", path)
+		return nil
+	}
+
+	logger.Warn(GatewayComponent, "No matching route: returning 404")
+	return gateway.ErrNoRoute
+}
 
-		// Check if all predicates matched
-		if !allPredicatesMatched {
+// match reports whether route matches the request, logging the result of
+// each predicate at debug level.
+func (lg *GatewayLogger) match(logger Logger, c *fiber.Ctx, i int, route *gateway.Route) bool {
+	if !logger.Enabled(GatewayComponent, DebugLevel) {
+		return route.Match(c)
+	}
+	if route.Disabled {
+		logger.Debug(GatewayComponent, "Route[%d] skipped: disabled", i)
+		return false
+	}
+	logger.Debug(GatewayComponent, "Route[%d] matching started: %d predicates", i, len(route.Predicates))
+	for j, pred := range route.Predicates {
+		matched := pred.Match(c)
+		logger.Debug(GatewayComponent, "  Predicate[%d]: %T matching result=%v", j, pred, matched)
+		if !matched {
 			logger.Debug(GatewayComponent, "Route[%d] matching failed: Predicate mismatch", i)
-			continue
+			return false
 		}
+	}
+	return true
+}
 
-		// Log matched route
-		logger.Info(GatewayComponent, "Route[%d] matching successful: upstream=%s", i, route.Upstream)
-
-		// Apply request filters
-		if len(route.RequestFilters) > 0 {
-			logger.Debug(GatewayComponent, "Applying request filters: %d filters", len(route.RequestFilters))
-
-			for j, rf := range route.RequestFilters {
-				filterDone := logger.Timed(FilterComponent, "Request filter[%d]: %T applying", j, rf)
-
-				if err := rf.OnRequest(c); err != nil {
-					logger.Error(FilterComponent, "Request filter[%d] application failed: %v", j, err)
-					logger.Error(GatewayComponent, "Request processing failed: elapsed time=%s", time.Since(start))
-					return err
-				}
+// logHook logs the filters and proxy call of a request served by
+// gateway.Route.Serve.
+type logHook struct {
+	logger    Logger
+	requestID string
+	// requestFilters and responseFilters count the filters begun so far
+	requestFilters  int
+	responseFilters int
+}
 
-				filterDone("success")
+// Begin implements gateway.Hook.
+func (h *logHook) Begin(c *fiber.Ctx, stage gateway.Stage, name string) func(err error) {
+	switch stage {
+	case gateway.StageProxy:
+		done := h.logger.TimedWith(ProxyComponent, "Proxy call: path=%s", c.Path())
+		return func(err error) {
+			if err != nil {
+				h.logger.Error(ProxyComponent, "Proxy call failed: %s", errorDetail(err))
+				return
 			}
+			status := c.Response().StatusCode()
+			done(fmt.Sprintf("success (status code=%d)", status), "status", status)
 		}
 
-		// Call the proxy if Upstream is set
-		if route.Upstream != "" && lg.Gateway.ReverseProxy != nil {
-			proxyDone := logger.Timed(ProxyComponent, "Proxy call: upstream=%s, path=%s", route.Upstream, c.Path())
-			err := lg.Gateway.ReverseProxy.Proxy(c, route.Upstream)
-
+	case gateway.StageRequestFilter:
+		j := h.requestFilters
+		h.requestFilters++
+		done := h.logger.Timed(FilterComponent, "Request filter[%d]: %s applying", j, name)
+		return func(err error) {
 			if err != nil {
-				logger.Error(ProxyComponent, "Proxy call failed: %v", err)
-				return err
+				h.logger.Error(FilterComponent, "Request filter[%d] application failed: %s", j, errorDetail(err))
+				return
 			}
+			done("success")
 
-			proxyDone(fmt.Sprintf("success (status code=%d)", c.Response().StatusCode()))
-
-			// Apply response filters
-			if len(route.ResponseFilters) > 0 {
-				logger.Debug(GatewayComponent, "Applying response filters: %d filters", len(route.ResponseFilters))
-
-				for j, rf := range route.ResponseFilters {
-					respFilterDone := logger.Timed(FilterComponent, "Response filter[%d]: %T applying", j, rf)
-
-					if err := rf.OnResponse(c); err != nil {
-						logger.Error(FilterComponent, "Response filter[%d] application failed: %v", j, err)
-						return err
-					}
-
-					respFilterDone("success")
-				}
+			// A RequestIDFilter may have assigned the ID
+			if id := gateway.ExchangeOf(c).RequestID; h.requestID == "" && id != "" {
+				h.requestID = id
+				h.logger = h.logger.With("request_id", id)
 			}
+		}
 
-			matchFound = true
-			routeElapsed := time.Since(routeStart)
-			logger.Debug(GatewayComponent, "Route[%d] processing completed: elapsed time=%s", i, routeElapsed)
-			break
+	default:
+		j := h.responseFilters
+		h.responseFilters++
+		done := h.logger.Timed(FilterComponent, "Response filter[%d]: %s applying", j, name)
+		return func(err error) {
+			if err != nil {
+				h.logger.Error(FilterComponent, "Response filter[%d] application failed: %s", j, errorDetail(err))
+				return
+			}
+			done("success")
 		}
 	}
+}
 
-	// Return 404 if no route matched
-	if !matchFound {
-		logger.Warn(GatewayComponent, "No matching route: returning 404")
-		return fiber.NewError(fiber.StatusNotFound, "No matching route found")
+// errorDetail describes err for logs, including the cause of a gateway.Error,
+// which clients do not see.
+func errorDetail(err error) string {
+	var e *gateway.Error
+	if errors.As(err, &e) && e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
 	}
-
-	elapsed := time.Since(start)
-	logger.Info(GatewayComponent, "Request processing completed: path=%s, status=%d, elapsed time=%s",
-		path, c.Response().StatusCode(), elapsed)
-
-	return nil
+	return err.Error()
 }
@@ -1,11 +1,13 @@
 package log
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/d0lim/floo/pkg/filter"
 	"github.com/d0lim/floo/pkg/gateway"
 	"github.com/d0lim/floo/pkg/predicate"
 	"github.com/d0lim/floo/pkg/reverseproxy"
@@ -33,16 +35,9 @@ func (f MockRequestFilter) OnRequest(c *fiber.Ctx) error {
 }
 
 func TestGatewayLogger(t *testing.T) {
-	// Setup log capture
+	// Setup log capture without timestamps, at debug level
 	logBuf := NewBuffer()
-	restore := CaptureLogsToBuffer(logBuf)
-	defer restore()
-
-	// Initialize basic log configuration
-	ConfigureLogger(LogFlags{}, "") // Remove timestamp
-
-	// Enable debug level for testing
-	SetLogLevel(DebugLevel)
+	logOpts := []Option{WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel)}
 
 	// Create fiber app
 	app := fiber.New()
@@ -83,7 +78,7 @@ func TestGatewayLogger(t *testing.T) {
 	}
 
 	// Wrap with logging gateway
-	loggingGateway := NewGatewayLogger(baseGateway)
+	loggingGateway := NewGatewayLogger(baseGateway, logOpts...)
 
 	// Add test route
 	app.All("/*", loggingGateway.Handle)
@@ -132,3 +127,144 @@ func TestGatewayLogger(t *testing.T) {
 		t.Errorf("Status code should be 404 for non-existent path, but got %d", resp.StatusCode)
 	}
 }
+
+func TestGatewayLoggerRequestID(t *testing.T) {
+	logBuf := NewBuffer()
+
+	// Create fiber app
+	app := fiber.New()
+
+	requestID := filter.RequestIDFilter{Generate: func() string { return "req-1" }}
+	baseGateway := gateway.Gateway{
+		ReverseProxy: NewProxyLogger(&reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{StatusCode: 200}},
+			WithOutput(logBuf), WithFlags(LogFlags{}, "")),
+		Routes: []gateway.Route{
+			{
+				Predicates:     []gateway.Predicate{MockPredicate{Result: true}},
+				RequestFilters: []gateway.RequestFilter{requestID},
+				Upstream:       "https://example.com",
+			},
+		},
+	}
+	loggingGateway := NewGatewayLogger(baseGateway, WithOutput(logBuf), WithFlags(LogFlags{}, ""))
+	app.All("/*", loggingGateway.Handle)
+
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/test", nil)); err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+
+	// Lines after the filter carry the ID, including those of the proxy
+	logs := logBuf.String()
+	requiredLogItems := []string{
+		"[Proxy][INFO] Request: path=/api/test, method=GET request_id=req-1",
+		"upstream=https://example.com request_id=req-1 status=200 latency=",
+	}
+	for _, item := range requiredLogItems {
+		if !strings.Contains(logs, item) {
+			t.Errorf("Log does not contain '%s' item:\n%s", item, logs)
+		}
+	}
+
+	// With the middleware every line carries it
+	logBuf = NewBuffer()
+	loggingGateway.Logger = New(WithOutput(logBuf), WithFlags(LogFlags{}, ""))
+	app = fiber.New()
+	app.Use(requestID.Middleware())
+	app.All("/*", loggingGateway.Handle)
+	app.Test(httptest.NewRequest(http.MethodGet, "/api/test", nil))
+
+	for _, line := range strings.Split(strings.TrimSpace(logBuf.String()), "\n") {
+		if !strings.Contains(line, "request_id=req-1") {
+			t.Errorf("Line does not carry the request ID: %s", line)
+		}
+	}
+}
+
+func TestGatewayLoggerHandledRequest(t *testing.T) {
+	logBuf := NewBuffer()
+	baseGateway := gateway.Gateway{
+		// Proxying would answer 200
+		ReverseProxy: &reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{StatusCode: 200}},
+		Routes: []gateway.Route{{
+			RequestFilters: []gateway.RequestFilter{redirectFilter{}},
+			Upstream:       "https://example.com",
+		}},
+	}
+	loggingGateway := NewGatewayLogger(baseGateway, WithOutput(logBuf), WithFlags(LogFlags{}, ""))
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.All("/*", loggingGateway.Handle)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/login", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 302 {
+		t.Errorf("Status code should be 302, but got %d", resp.StatusCode)
+	}
+	if logs := logBuf.String(); strings.Contains(logs, "failed") {
+		t.Errorf("Handled request should not be logged as a failure:\n%s", logs)
+	}
+}
+
+// redirectFilter sends a redirect itself, as login filters do.
+type redirectFilter struct{}
+
+func (redirectFilter) OnRequest(c *fiber.Ctx) error {
+	if err := c.Redirect("/elsewhere"); err != nil {
+		return err
+	}
+	return gateway.ErrHandled
+}
+
+func TestGatewayLoggerFilterErrorCause(t *testing.T) {
+	logBuf := NewBuffer()
+	baseGateway := gateway.Gateway{
+		Routes: []gateway.Route{{
+			RequestFilters: []gateway.RequestFilter{
+				MockRequestFilter{Error: gateway.ErrForbidden.Wrap(errors.New("client 192.0.2.1 denied: in deny list"))},
+			},
+			Upstream: "https://example.com",
+		}},
+	}
+	loggingGateway := NewGatewayLogger(baseGateway, WithOutput(logBuf), WithFlags(LogFlags{}, ""))
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.All("/*", loggingGateway.Handle)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 403 {
+		t.Errorf("Status code should be 403, but got %d", resp.StatusCode)
+	}
+	// The cause is logged, though clients only see the message
+	want := "Request filter[0] application failed: Forbidden: client 192.0.2.1 denied: in deny list"
+	if logs := logBuf.String(); !strings.Contains(logs, want) {
+		t.Errorf("Log does not contain '%s' item:\n%s", want, logs)
+	}
+}
+
+func TestGatewayLoggerServesLikeGateway(t *testing.T) {
+	// The first matching route has no upstream; Gateway answers 404 rather
+	// than trying the next route
+	baseGateway := gateway.Gateway{
+		ReverseProxy: &reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{StatusCode: 200}},
+		Routes: []gateway.Route{
+			{Predicates: []gateway.Predicate{MockPredicate{Result: true}}},
+			{Predicates: []gateway.Predicate{MockPredicate{Result: true}}, Upstream: "https://example.com"},
+		},
+	}
+	loggingGateway := NewGatewayLogger(baseGateway, WithOutput(NewBuffer()), WithFlags(LogFlags{}, ""))
+
+	for name, handler := range map[string]fiber.Handler{"gateway": baseGateway.Handle, "logger": loggingGateway.Handle} {
+		app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+		app.All("/*", handler)
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatalf("Request test failed: %v", err)
+		}
+		if resp.StatusCode != 404 {
+			t.Errorf("%s: status code should be 404, but got %d", name, resp.StatusCode)
+		}
+	}
+}
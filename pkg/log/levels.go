@@ -0,0 +1,96 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Levels holds the log level of each component.
+// It is safe for concurrent use, so levels can be changed while requests are being logged.
+type Levels struct {
+	mu         sync.RWMutex
+	base       LogLevel
+	components map[ComponentType]LogLevel
+}
+
+// NewLevels creates Levels where every component logs at base.
+func NewLevels(base LogLevel) *Levels {
+	return &Levels{base: base, components: map[ComponentType]LogLevel{}}
+}
+
+// ParseLevels parses a base level optionally followed by component levels,
+// e.g. "info" or "info,Proxy=debug,Filter=warn".
+func ParseLevels(s string) (*Levels, error) {
+	levels := NewLevels(InfoLevel)
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			if i > 0 {
+				return nil, fmt.Errorf("expected Component=level, got %q", part)
+			}
+			level, err := ParseLevel(part)
+			if err != nil {
+				return nil, err
+			}
+			levels.Set(level)
+			continue
+		}
+		level, err := ParseLevel(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		levels.SetComponent(ComponentType(strings.TrimSpace(name)), level)
+	}
+	return levels, nil
+}
+
+// Set changes the level of every component without an explicit level.
+func (l *Levels) Set(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base = level
+}
+
+// SetComponent changes the level of a single component.
+func (l *Levels) SetComponent(component ComponentType, level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.components[component] = level
+}
+
+// ResetComponent makes the component log at the base level again.
+func (l *Levels) ResetComponent(component ComponentType) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.components, component)
+}
+
+// Level returns the level of the component.
+func (l *Levels) Level(component ComponentType) LogLevel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+	return l.base
+}
+
+// Enabled reports whether lines of the component at level are written.
+func (l *Levels) Enabled(component ComponentType, level LogLevel) bool {
+	return l.Level(component) <= level
+}
+
+// String formats the levels in the form accepted by ParseLevels.
+func (l *Levels) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	parts := []string{strings.ToLower(l.base.String())}
+	for component, level := range l.components {
+		parts = append(parts, fmt.Sprintf("%s=%s", component, strings.ToLower(level.String())))
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,84 @@
+package log
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestComponentLevels(t *testing.T) {
+	levels, err := ParseLevels("warn,Proxy=debug")
+	if err != nil {
+		t.Fatalf("Failed to parse levels: %v", err)
+	}
+	if levels.String() != "warn,Proxy=debug" {
+		t.Errorf("Unexpected levels %s", levels)
+	}
+
+	logBuf := NewBuffer()
+	logger := New(WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevels(levels))
+
+	logger.Debug(ProxyComponent, "proxy debug")
+	logger.Info(GatewayComponent, "gateway info")
+	logger.Warn(GatewayComponent, "gateway warn")
+
+	logs := logBuf.String()
+	if !strings.Contains(logs, "[Proxy][DEBUG] proxy debug") || !strings.Contains(logs, "[Gateway][WARN] gateway warn") {
+		t.Errorf("Expected proxy debug and gateway warn lines: %s", logs)
+	}
+	if strings.Contains(logs, "gateway info") {
+		t.Errorf("Gateway info should be filtered at warn level: %s", logs)
+	}
+
+	// Levels apply to loggers derived with With and change immediately
+	routeLogger := logger.With("route_id", "api")
+	levels.Set(InfoLevel)
+	routeLogger.Info(GatewayComponent, "gateway info after change")
+	if !strings.Contains(logBuf.String(), "[Gateway][INFO] gateway info after change route_id=api") {
+		t.Errorf("Expected the new level to apply: %s", logBuf.String())
+	}
+
+	if _, err := ParseLevels("info,Proxy"); err == nil {
+		t.Error("Expected an error for a component without level")
+	}
+}
+
+func TestLevelsConcurrentChange(t *testing.T) {
+	levels := NewLevels(InfoLevel)
+	logger := New(WithOutput(NewBuffer()), WithLevels(levels))
+
+	// Run with -race to detect unsynchronized access
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				levels.SetComponent(GatewayComponent, LogLevel(j%4))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Debug(GatewayComponent, "line %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInstanceLoggersAreIndependent(t *testing.T) {
+	debugBuf, infoBuf := NewBuffer(), NewBuffer()
+	debugLogger := New(WithOutput(debugBuf), WithLevel(DebugLevel))
+	infoLogger := New(WithOutput(infoBuf), WithLevel(InfoLevel))
+
+	debugLogger.Debug(GatewayComponent, "visible")
+	infoLogger.Debug(GatewayComponent, "hidden")
+
+	if !strings.Contains(debugBuf.String(), "visible") {
+		t.Error("Expected the debug logger to write debug lines")
+	}
+	if infoBuf.String() != "" {
+		t.Errorf("Expected the info logger to skip debug lines: %s", infoBuf.String())
+	}
+}
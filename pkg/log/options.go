@@ -0,0 +1,139 @@
+package log
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// Option configures a Logger created by New, NewGatewayLogger or NewProxyLogger.
+type Option func(*options)
+
+type options struct {
+	// configured is set by the options choosing the Logger
+	configured bool
+	logger     Logger
+	output     io.Writer
+	flags      LogFlags
+	prefix     string
+	levels     *Levels
+	// redactor is only used by NewProxyLogger
+	redactor *Redactor
+}
+
+// WithLogger uses an existing Logger; the output, flag and level options are then ignored.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.configured = true
+		o.logger = logger
+	}
+}
+
+// WithOutput sets where lines are written, os.Stderr by default.
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.configured = true
+		o.output = w
+	}
+}
+
+// WithFlags sets the line format and the prefix of text lines.
+// By default lines carry the date and time.
+func WithFlags(flags LogFlags, prefix string) Option {
+	return func(o *options) {
+		o.configured = true
+		o.flags = flags
+		o.prefix = prefix
+	}
+}
+
+// WithLevel sets the level of every component.
+func WithLevel(level LogLevel) Option {
+	return func(o *options) {
+		o.configured = true
+		o.levels = NewLevels(level)
+	}
+}
+
+// WithLevels shares levels with the Logger, so that changing them
+// later takes effect immediately.
+func WithLevels(levels *Levels) Option {
+	return func(o *options) {
+		o.configured = true
+		o.levels = levels
+	}
+}
+
+// WithRedactor sets how NewProxyLogger masks headers and bodies.
+func WithRedactor(r *Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// New creates a Logger. Without options it writes text lines with the date
+// and time to os.Stderr at InfoLevel.
+func New(opts ...Option) Logger {
+	o := options{
+		output: os.Stderr,
+		flags:  LogFlags{Date: true, Time: true},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.logger != nil {
+		return o.logger
+	}
+	if o.levels == nil {
+		o.levels = NewLevels(InfoLevel)
+	}
+
+	if o.flags.Format == JSONFormat || o.flags.Format == LogfmtFormat {
+		return newHandlerLogger(o.flags.Format, o.output, o.levels, o.flags.Date || o.flags.Time)
+	}
+	return &StandardLogger{
+		logger: log.New(o.output, o.prefix, stdFlags(o.flags)),
+		levels: o.levels,
+	}
+}
+
+// newWrapperLogger returns the Logger of NewGatewayLogger and NewProxyLogger:
+// that of New, or the package-level logger when no option chooses one, so
+// that the deprecated SetLogLevel and ConfigureLogger keep applying to them.
+func newWrapperLogger(opts []Option) Logger {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.configured {
+		return sharedLoggerRef{}
+	}
+	return New(opts...)
+}
+
+// stdFlags converts LogFlags to the flags of the log package.
+func stdFlags(flags LogFlags) int {
+	var logFlags int
+
+	if flags.Date {
+		logFlags |= log.Ldate
+	}
+	if flags.Time {
+		logFlags |= log.Ltime
+	}
+	if flags.Microseconds {
+		logFlags |= log.Lmicroseconds
+	}
+	if flags.UTC {
+		logFlags |= log.LUTC
+	}
+	if flags.File {
+		if flags.LongFile {
+			logFlags |= log.Llongfile
+		} else {
+			logFlags |= log.Lshortfile
+		}
+	}
+
+	return logFlags
+}
@@ -2,7 +2,9 @@ package log
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/d0lim/floo/pkg/gateway"
 	"github.com/d0lim/floo/pkg/reverseproxy"
 	"github.com/gofiber/fiber/v2"
 )
@@ -11,19 +13,35 @@ import (
 type ProxyLogger struct {
 	Wrapped reverseproxy.HTTPProxy
 	Logger  Logger
+	// Redactor masks the query of the target URL, and headers and bodies in
+	// debug lines.
+	Redactor *Redactor
 }
 
 // NewProxyLogger creates a logging proxy that wraps an existing proxy.
-func NewProxyLogger(wrapped reverseproxy.HTTPProxy) *ProxyLogger {
+// Without options choosing the Logger (see New), it logs through the
+// package-level logger, configured by the deprecated SetLogLevel and
+// ConfigureLogger while they exist.
+// Debug lines are masked by DefaultRedactor unless WithRedactor is given.
+func NewProxyLogger(wrapped reverseproxy.HTTPProxy, opts ...Option) *ProxyLogger {
+	o := options{redactor: DefaultRedactor()}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	return &ProxyLogger{
-		Wrapped: wrapped,
-		Logger:  GetLogger(),
+		Wrapped:  wrapped,
+		Logger:   newWrapperLogger(opts),
+		Redactor: o.redactor,
 	}
 }
 
 // Proxy implements the HTTPProxy interface and adds logging.
 func (p *ProxyLogger) Proxy(c *fiber.Ctx, upstream string) error {
 	logger := p.Logger
+	redactor := p.Redactor
+	if redactor == nil {
+		redactor = DefaultRedactor()
+	}
 
 	// Log request information
 	path := c.Path()
@@ -34,45 +52,47 @@ func (p *ProxyLogger) Proxy(c *fiber.Ctx, upstream string) error {
 		headers[string(key)] = string(value)
 	})
 
-	logger.Info(ProxyComponent, "Request: path=%s, method=%s, target=%s", path, method, upstream)
+	if requestID := gateway.ExchangeOf(c).RequestID; requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	logger = logger.With("upstream", upstream)
+	logger.Info(ProxyComponent, "Request: path=%s, method=%s", path, method)
 
-	if IsDebugEnabled() {
-		logger.Debug(ProxyComponent, "Request headers: %v", headers)
-		logger.Debug(ProxyComponent, "Request body: %s", string(c.Body()))
+	if logger.Enabled(ProxyComponent, DebugLevel) {
+		logger.Debug(ProxyComponent, "Request headers: %v", redactor.Headers(headers))
+		logger.Debug(ProxyComponent, "Request body: %s", redactor.Body(string(c.Request().Header.ContentType()), c.Body()))
 	}
 
-	// Calculate target URL
-	targetURL := fmt.Sprintf("%s%s", upstream, c.Request().URI().Path())
+	// Calculate target URL, masking credentials in its query
+	rawURL := gateway.TargetURL(c, upstream)
+	targetURL := redactor.URL(rawURL)
 	logger.Debug(ProxyComponent, "Target URL: %s", targetURL)
 
 	// Call the original proxy
-	proxyDone := logger.Timed(ProxyComponent, "Sending proxy request: %s %s", method, targetURL)
+	proxyDone := logger.TimedWith(ProxyComponent, "Sending proxy request: %s %s", method, targetURL)
 	err := p.Wrapped.Proxy(c, upstream)
 
 	if err != nil {
-		logger.Error(ProxyComponent, "Error occurred: %v", err)
+		// Client errors, such as *url.Error, quote the URL
+		logger.Error(ProxyComponent, "Error occurred: %s", strings.ReplaceAll(err.Error(), rawURL, targetURL))
 		return err
 	}
 
 	statusCode := c.Response().StatusCode()
-	proxyDone(fmt.Sprintf("Response received: status=%d", statusCode))
+	proxyDone(fmt.Sprintf("Response received: status=%d", statusCode), "status", statusCode)
 
 	// Detailed logging only in debug mode
-	if IsDebugEnabled() {
+	if logger.Enabled(ProxyComponent, DebugLevel) {
 		// Log response headers
 		respHeaders := map[string]string{}
 		c.Response().Header.VisitAll(func(key, value []byte) {
 			respHeaders[string(key)] = string(value)
 		})
-		logger.Debug(ProxyComponent, "Response headers: %v", respHeaders)
+		logger.Debug(ProxyComponent, "Response headers: %v", redactor.Headers(respHeaders))
 
-		// Log response body (only partial if too long)
+		// Log response body, masked and cut to the limit of its content type
 		respBody := c.Response().Body()
-		if len(respBody) > 1024 {
-			logger.Debug(ProxyComponent, "Response body (first 1KB): %s...", string(respBody[:1024]))
-		} else {
-			logger.Debug(ProxyComponent, "Response body: %s", string(respBody))
-		}
+		logger.Debug(ProxyComponent, "Response body: %s", redactor.Body(string(c.Response().Header.ContentType()), respBody))
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package log
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -20,16 +21,9 @@ type TodoResponse struct {
 }
 
 func TestProxyLogger(t *testing.T) {
-	// Setup log capture
+	// Setup log capture without timestamps, at debug level
 	logBuf := NewBuffer()
-	restore := CaptureLogsToBuffer(logBuf)
-	defer restore()
-
-	// Initialize basic log configuration
-	ConfigureLogger(LogFlags{}, "") // Remove timestamp
-
-	// Enable debug level for testing
-	SetLogLevel(DebugLevel)
+	logOpts := []Option{WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel)}
 
 	// Create fiber app
 	app := fiber.New()
@@ -47,7 +41,7 @@ func TestProxyLogger(t *testing.T) {
 	}
 
 	// Wrap with logging proxy
-	loggingProxy := NewProxyLogger(baseProxy)
+	loggingProxy := NewProxyLogger(baseProxy, logOpts...)
 
 	// Add test route
 	app.Get("/test", func(c *fiber.Ctx) error {
@@ -115,16 +109,9 @@ func TestProxyLogger(t *testing.T) {
 
 func TestProxyLoggerWithJSONPlaceholder(t *testing.T) {
 	// Use Mock instead of calling actual API
-	// Setup log capture
+	// Setup log capture without timestamps, at debug level
 	logBuf := NewBuffer()
-	restore := CaptureLogsToBuffer(logBuf)
-	defer restore()
-
-	// Initialize basic log configuration
-	ConfigureLogger(LogFlags{}, "") // Remove timestamp
-
-	// Enable debug level for testing
-	SetLogLevel(DebugLevel)
+	logOpts := []Option{WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel)}
 
 	// Create fiber app
 	app := fiber.New()
@@ -144,7 +131,7 @@ func TestProxyLoggerWithJSONPlaceholder(t *testing.T) {
 	}
 
 	// Wrap with logging proxy
-	loggingProxy := NewProxyLogger(baseProxy)
+	loggingProxy := NewProxyLogger(baseProxy, logOpts...)
 
 	// Add test route
 	app.Get("/todos/:id", func(c *fiber.Ctx) error {
@@ -206,3 +193,41 @@ func TestProxyLoggerWithJSONPlaceholder(t *testing.T) {
 		}
 	}
 }
+
+func TestProxyLoggerRedactsQuery(t *testing.T) {
+	logBuf := NewBuffer()
+	loggingProxy := NewProxyLogger(&reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{StatusCode: 200}},
+		WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel))
+
+	app := fiber.New()
+	app.Get("/callback", func(c *fiber.Ctx) error {
+		return loggingProxy.Proxy(c, "https://example.com")
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/callback?code=s3cr3t-code&access_token=s3cr3t-token&page=2", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+
+	// Errors quoting the URL are masked too
+	failing := NewProxyLogger(&reverseproxy.NetHTTPProxy{Client: &MockHTTPClient{Error: fmt.Errorf("Get %q: connection refused", "https://example.com/failing?access_token=s3cr3t-token")}},
+		WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel))
+	app.Get("/failing", func(c *fiber.Ctx) error {
+		return failing.Proxy(c, "https://example.com")
+	})
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/failing?access_token=s3cr3t-token", nil)); err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+
+	logs := logBuf.String()
+	for _, secret := range []string{"s3cr3t-code", "s3cr3t-token"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("Log should not contain %q, but got %s", secret, logs)
+		}
+	}
+	if !strings.Contains(logs, "[Proxy][INFO] Sending proxy request: GET https://example.com/callback?") || !strings.Contains(logs, "page=2") {
+		t.Errorf("Log should contain the target URL with unmasked parameters, but got %s", logs)
+	}
+}
@@ -0,0 +1,249 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mask replaces redacted values in logs.
+const Mask = "[REDACTED]"
+
+// CardNumberPattern matches payment card numbers of 13 to 19 digits,
+// optionally separated by spaces or dashes.
+var CardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// Redactor masks sensitive data in headers and bodies before they are logged.
+type Redactor struct {
+	// DenyHeaders lists headers whose values are masked.
+	// It is ignored when AllowHeaders is set.
+	DenyHeaders []string
+	// AllowHeaders, if set, lists the only headers whose values are logged;
+	// every other header is masked.
+	AllowHeaders []string
+	// JSONPaths lists fields of JSON bodies to mask, as dot-separated keys,
+	// e.g. "password" or "user.email". A "*" segment matches any key, and
+	// arrays are searched element by element. JSON bodies that do not parse
+	// as a single document, such as NDJSON or truncated bodies, are replaced
+	// by their size rather than logged unmasked.
+	JSONPaths []string
+	// QueryParams lists query parameters whose values are masked in URLs.
+	QueryParams []string
+	// Patterns are masked in header values, query values and text bodies.
+	Patterns []*regexp.Regexp
+	// BodyLimits maps media types to the number of body bytes logged.
+	// Keys are exact types such as "application/json", wildcards such as
+	// "text/*", or "*" for any other type; 0 omits the body.
+	// Bodies of types without a limit are logged up to 1KB.
+	BodyLimits map[string]int
+}
+
+// DefaultRedactor masks credentials and cookies and logs up to 1KB of text bodies.
+func DefaultRedactor() *Redactor {
+	return &Redactor{
+		DenyHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		QueryParams: []string{"access_token", "id_token", "refresh_token", "token", "code", "api_key", "apikey", "password", "client_secret", "signature"},
+	}
+}
+
+// Headers returns a copy of headers with the values of sensitive headers masked.
+func (r *Redactor) Headers(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if r.hidesHeader(name) {
+			redacted[name] = Mask
+		} else {
+			redacted[name] = r.maskPatterns(value)
+		}
+	}
+	return redacted
+}
+
+// URL returns rawURL with the values of sensitive query parameters masked.
+func (r *Redactor) URL(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok || query == "" {
+		return rawURL
+	}
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if containsFold(r.QueryParams, name) {
+			pairs[i] = key + "=" + Mask
+			continue
+		}
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			decoded = value
+		}
+		if masked := r.maskPatterns(decoded); masked != decoded {
+			pairs[i] = key + "=" + url.QueryEscape(masked)
+		}
+	}
+	return base + "?" + strings.Join(pairs, "&")
+}
+
+// Body returns the loggable form of a body of the given Content-Type:
+// binary bodies are replaced by their size, JSON fields and patterns are
+// masked, and the result is cut to the limit of the content type.
+func (r *Redactor) Body(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isText(mediaType, body) {
+		return fmt.Sprintf("[binary body: %d bytes]", len(body))
+	}
+
+	limit := r.bodyLimit(mediaType)
+	if limit == 0 {
+		return fmt.Sprintf("[body omitted: %d bytes]", len(body))
+	}
+
+	text := string(r.MaskBody(contentType, body))
+
+	if len(text) > limit {
+		// Cut on a rune boundary
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s... (%d bytes)", text[:cut], len(text))
+	}
+	return text
+}
+
+// MaskBody masks the JSON fields and patterns of a text body without cutting
+// it. Binary bodies are returned unchanged, and JSON bodies that cannot be
+// parsed are replaced by their size.
+func (r *Redactor) MaskBody(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if len(body) == 0 || !isText(mediaType, body) {
+		return body
+	}
+	if len(r.JSONPaths) > 0 && isJSON(mediaType) {
+		masked, ok := r.maskJSON(body)
+		if !ok {
+			return []byte(fmt.Sprintf("[unparsable JSON body: %d bytes]", len(body)))
+		}
+		body = masked
+	}
+	if len(r.Patterns) == 0 {
+		return body
+	}
+	return []byte(r.maskPatterns(string(body)))
+}
+
+func (r *Redactor) hidesHeader(name string) bool {
+	if len(r.AllowHeaders) > 0 {
+		return !containsFold(r.AllowHeaders, name)
+	}
+	return containsFold(r.DenyHeaders, name)
+}
+
+func (r *Redactor) maskPatterns(s string) string {
+	for _, pattern := range r.Patterns {
+		s = pattern.ReplaceAllString(s, Mask)
+	}
+	return s
+}
+
+func (r *Redactor) bodyLimit(mediaType string) int {
+	if limit, ok := r.BodyLimits[mediaType]; ok {
+		return limit
+	}
+	if major, _, ok := strings.Cut(mediaType, "/"); ok {
+		if limit, ok := r.BodyLimits[major+"/*"]; ok {
+			return limit
+		}
+	}
+	if limit, ok := r.BodyLimits["*"]; ok {
+		return limit
+	}
+	return 1024
+}
+
+// maskJSON masks the JSONPaths of body. It reports false if body is not a
+// single valid JSON document, so that nothing is logged unmasked.
+func (r *Redactor) maskJSON(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+	// Reject trailing data such as further NDJSON lines
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+	for _, path := range r.JSONPaths {
+		doc = maskPath(doc, strings.Split(path, "."))
+	}
+	masked, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return masked, true
+}
+
+// maskPath replaces the values at path below v with Mask.
+func maskPath(v interface{}, path []string) interface{} {
+	switch node := v.(type) {
+	case []interface{}:
+		for i := range node {
+			node[i] = maskPath(node[i], path)
+		}
+	case map[string]interface{}:
+		for key, child := range node {
+			if path[0] != "*" && path[0] != key {
+				continue
+			}
+			if len(path) == 1 {
+				node[key] = Mask
+			} else {
+				node[key] = maskPath(child, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+// isText reports whether a body can be printed. Without a media type the
+// body itself is inspected.
+func isText(mediaType string, body []byte) bool {
+	switch {
+	case mediaType == "":
+		return utf8.Valid(body) && bytes.IndexByte(body, 0) < 0
+	case strings.HasPrefix(mediaType, "text/"),
+		isJSON(mediaType),
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/javascript", mediaType == "application/graphql":
+		return true
+	default:
+		return false
+	}
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/reverseproxy"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRedactorHeaders(t *testing.T) {
+	headers := map[string]string{
+		"Authorization": "Bearer secret",
+		"Content-Type":  "application/json",
+		"X-Card":        "4111 1111 1111 1111",
+	}
+
+	r := DefaultRedactor()
+	r.Patterns = []*regexp.Regexp{CardNumberPattern}
+	redacted := r.Headers(headers)
+	if redacted["Authorization"] != Mask || redacted["Content-Type"] != "application/json" || redacted["X-Card"] != Mask {
+		t.Errorf("Unexpected denylist result %v", redacted)
+	}
+	if headers["Authorization"] != "Bearer secret" {
+		t.Error("Headers should not be modified in place")
+	}
+
+	r = &Redactor{AllowHeaders: []string{"content-type"}}
+	redacted = r.Headers(headers)
+	if redacted["Content-Type"] != "application/json" || redacted["X-Card"] != Mask {
+		t.Errorf("Unexpected allowlist result %v", redacted)
+	}
+}
+
+func TestRedactorURL(t *testing.T) {
+	r := DefaultRedactor()
+	r.Patterns = []*regexp.Regexp{CardNumberPattern}
+
+	tests := []struct {
+		url, want string
+	}{
+		{"http://gw/login", "http://gw/login"},
+		{"http://gw/cb?code=abc&state=s", "http://gw/cb?code=[REDACTED]&state=s"},
+		{"/a?Access_Token=t&page=2&access%5Ftoken=u", "/a?Access_Token=[REDACTED]&page=2&access%5Ftoken=[REDACTED]"},
+		{"/pay?card=4111+1111+1111+1111&flag", "/pay?card=%5BREDACTED%5D&flag"},
+	}
+	for _, tt := range tests {
+		if got := r.URL(tt.url); got != tt.want {
+			t.Errorf("URL(%q) should be %q, but got %q", tt.url, tt.want, got)
+		}
+	}
+}
+
+func TestRedactorBody(t *testing.T) {
+	r := &Redactor{
+		JSONPaths:  []string{"password", "user.email", "cards.*"},
+		Patterns:   []*regexp.Regexp{CardNumberPattern},
+		BodyLimits: map[string]int{"text/*": 8, "application/x-www-form-urlencoded": 0},
+	}
+
+	body := r.Body("application/json; charset=utf-8",
+		[]byte(`{"password":"p","user":{"email":"a@b.c","name":"n"},"cards":{"visa":"x"},"note":"card 4111-1111-1111-1111"}`))
+	expected := `{"cards":{"visa":"[REDACTED]"},"note":"card [REDACTED]","password":"[REDACTED]","user":{"email":"[REDACTED]","name":"n"}}`
+	if body != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+
+	// Paths are searched inside arrays
+	if body := r.Body("application/json", []byte(`[{"password":"p"},{"password":"q"}]`)); body != `[{"password":"[REDACTED]"},{"password":"[REDACTED]"}]` {
+		t.Errorf("Unexpected array masking %s", body)
+	}
+
+	// Bodies that do not parse are never logged unmasked
+	for _, invalid := range []string{
+		`{"password":"p"}` + "\n" + `{"password":"q"}`,
+		`{"password":"p","note":`,
+		`{"password":"p"} trailing`,
+	} {
+		expected := fmt.Sprintf("[unparsable JSON body: %d bytes]", len(invalid))
+		if body := r.Body("application/json", []byte(invalid)); body != expected {
+			t.Errorf("Expected %s for %q, got %s", expected, invalid, body)
+		}
+	}
+
+	// Limits differ by content type
+	if body := r.Body("text/plain", []byte("0123456789")); body != "01234567... (10 bytes)" {
+		t.Errorf("Unexpected text sample %q", body)
+	}
+	if body := r.Body("application/x-www-form-urlencoded", []byte("a=b")); body != "[body omitted: 3 bytes]" {
+		t.Errorf("Unexpected omitted body %q", body)
+	}
+
+	// Binary bodies are never printed
+	if body := r.Body("image/png", []byte("\x89PNG")); body != "[binary body: 4 bytes]" {
+		t.Errorf("Unexpected binary body %q", body)
+	}
+	if body := r.Body("", []byte{'a', 0, 'b'}); body != "[binary body: 3 bytes]" {
+		t.Errorf("Unexpected untyped binary body %q", body)
+	}
+}
+
+func TestProxyLoggerRedaction(t *testing.T) {
+	logBuf := NewBuffer()
+
+	// Create fiber app
+	app := fiber.New()
+
+	baseProxy := &reverseproxy.NetHTTPProxy{
+		Client: &MockHTTPClient{
+			StatusCode:  200,
+			RespHeaders: map[string][]string{"Content-Type": {"application/octet-stream"}, "Set-Cookie": {"session=abc"}},
+			RespBody:    []byte("secret binary"),
+		},
+	}
+	loggingProxy := NewProxyLogger(baseProxy, WithOutput(logBuf), WithFlags(LogFlags{}, ""), WithLevel(DebugLevel))
+	loggingProxy.Redactor.JSONPaths = []string{"password"}
+
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return loggingProxy.Proxy(c, "https://example.com")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"u","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+
+	logs := logBuf.String()
+	for _, secret := range []string{"Bearer token", "hunter2", "session=abc", "secret binary"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("Log should not contain %q: %s", secret, logs)
+		}
+	}
+	if !strings.Contains(logs, "Response body: [binary body: 13 bytes]") {
+		t.Errorf("Expected the binary response body to be summarized: %s", logs)
+	}
+}
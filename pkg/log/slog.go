@@ -0,0 +1,135 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// SlogLogger is a Logger backed by log/slog.
+// The component of every line and the key-value pairs given to With and Timed
+// are written as structured attributes.
+type SlogLogger struct {
+	logger *slog.Logger
+	levels *Levels
+}
+
+// NewSlogLogger creates a Logger writing to the slog.Logger l.
+// Lines are filtered by levels first and then by the handler of l.
+func NewSlogLogger(l *slog.Logger, levels *Levels) *SlogLogger {
+	return &SlogLogger{logger: l, levels: levels}
+}
+
+// NewJSONLogger creates a SlogLogger writing JSON lines to w.
+func NewJSONLogger(w io.Writer, levels *Levels) *SlogLogger {
+	return newHandlerLogger(JSONFormat, w, levels, true)
+}
+
+// NewLogfmtLogger creates a SlogLogger writing logfmt (key=value) lines to w.
+func NewLogfmtLogger(w io.Writer, levels *Levels) *SlogLogger {
+	return newHandlerLogger(LogfmtFormat, w, levels, true)
+}
+
+// newHandlerLogger creates a SlogLogger with a JSON or logfmt handler.
+// The handler accepts every level; filtering is left to levels.
+func newHandlerLogger(format LogFormat, w io.Writer, levels *Levels, withTime bool) *SlogLogger {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if !withTime {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	var handler slog.Handler
+	if format == JSONFormat {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return &SlogLogger{logger: slog.New(handler), levels: levels}
+}
+
+// Levels returns the levels of the logger, which may be changed at runtime.
+func (l *SlogLogger) Levels() *Levels {
+	return l.levels
+}
+
+// Enabled reports whether lines of the component at level are written.
+func (l *SlogLogger) Enabled(component ComponentType, level LogLevel) bool {
+	return l.levels.Enabled(component, level) && l.logger.Enabled(context.Background(), slogLevel(level))
+}
+
+// Debug outputs a debug level log.
+func (l *SlogLogger) Debug(component ComponentType, format string, v ...interface{}) {
+	l.log(DebugLevel, component, format, v)
+}
+
+// Info outputs an info level log.
+func (l *SlogLogger) Info(component ComponentType, format string, v ...interface{}) {
+	l.log(InfoLevel, component, format, v)
+}
+
+// Warn outputs a warning level log.
+func (l *SlogLogger) Warn(component ComponentType, format string, v ...interface{}) {
+	l.log(WarnLevel, component, format, v)
+}
+
+// Error outputs an error level log.
+func (l *SlogLogger) Error(component ComponentType, format string, v ...interface{}) {
+	l.log(ErrorLevel, component, format, v)
+}
+
+// Timed returns a logger function that measures the time taken for a task.
+// The elapsed time is recorded in the "latency" attribute.
+func (l *SlogLogger) Timed(component ComponentType, format string, v ...interface{}) func(result string) {
+	done := l.TimedWith(component, format, v...)
+	return func(result string) { done(result) }
+}
+
+// TimedWith is like Timed, attaching the key-value pairs passed to the
+// returned function to the result line.
+func (l *SlogLogger) TimedWith(component ComponentType, format string, v ...interface{}) func(result string, args ...interface{}) {
+	if !l.Enabled(component, InfoLevel) {
+		return func(string, ...interface{}) {}
+	}
+
+	start := time.Now()
+	msg := fmt.Sprintf(format, v...)
+	l.Info(component, "%s", msg)
+
+	return func(result string, args ...interface{}) {
+		args = append(args, "component", string(component), "latency", time.Since(start))
+		l.logger.Info(msg+": "+result, args...)
+	}
+}
+
+// With returns a logger that attaches the key-value pairs to every line.
+func (l *SlogLogger) With(args ...interface{}) Logger {
+	return &SlogLogger{logger: l.logger.With(args...), levels: l.levels}
+}
+
+func (l *SlogLogger) log(level LogLevel, component ComponentType, format string, v []interface{}) {
+	if !l.Enabled(component, level) {
+		return
+	}
+	l.logger.Log(context.Background(), slogLevel(level), fmt.Sprintf(format, v...), "component", string(component))
+}
+
+// slogLevel converts a LogLevel to the matching slog.Level.
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
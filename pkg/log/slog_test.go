@@ -0,0 +1,95 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/d0lim/floo/pkg/reverseproxy"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	// Create fiber app
+	app := fiber.New()
+
+	baseGateway := gateway.Gateway{
+		ReverseProxy: &reverseproxy.NetHTTPProxy{
+			Client: &MockHTTPClient{StatusCode: 201},
+		},
+		Routes: []gateway.Route{
+			{
+				ID:         "api",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/api"}},
+				Upstream:   "https://example.com",
+			},
+		},
+	}
+
+	loggingGateway := NewGatewayLogger(baseGateway, WithOutput(buf), WithFlags(LogFlags{Format: JSONFormat}, ""))
+	app.All("/*", loggingGateway.Handle)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/test", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("Status code should be 201, but got %d", resp.StatusCode)
+	}
+
+	// Every line is a JSON object; the completion line carries the structured fields
+	var completed map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Log line is not JSON: %s", line)
+		}
+		if strings.HasPrefix(entry["msg"].(string), "Request processing completed") {
+			completed = entry
+		}
+	}
+	if completed == nil {
+		t.Fatalf("Completion line not found in:\n%s", buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"level":     "INFO",
+		"component": "Gateway",
+		"route_id":  "api",
+		"upstream":  "https://example.com",
+		"status":    float64(201),
+	}
+	for key, value := range expected {
+		if completed[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, completed[key])
+		}
+	}
+	if _, ok := completed["latency"]; !ok {
+		t.Error("Expected a latency attribute")
+	}
+}
+
+func TestLogfmtLogger(t *testing.T) {
+	logBuf := NewBuffer()
+	logger := New(WithOutput(logBuf), WithFlags(LogFlags{Format: LogfmtFormat}, ""))
+	logger.With("route_id", "api").Info(GatewayComponent, "Route matched")
+
+	logs := logBuf.String()
+	if !strings.Contains(logs, `level=INFO msg="Route matched" route_id=api component=Gateway`) {
+		t.Errorf("Unexpected logfmt output: %s", logs)
+	}
+	if strings.Contains(logs, "time=") {
+		t.Errorf("Time should be omitted without the Date and Time flags: %s", logs)
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
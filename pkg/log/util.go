@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,6 +23,38 @@ const (
 	ErrorLevel
 )
 
+// String returns the name of the level, e.g. "DEBUG".
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN".
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return DebugLevel, nil
+	case "INFO":
+		return InfoLevel, nil
+	case "WARN", "WARNING":
+		return WarnLevel, nil
+	case "ERROR":
+		return ErrorLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 // ComponentType represents the component type used in logging.
 type ComponentType string
 
@@ -33,6 +67,12 @@ const (
 	FilterComponent ComponentType = "Filter"
 	// PredicateComponent represents the predicate component.
 	PredicateComponent ComponentType = "Predicate"
+	// ConfigComponent represents the configuration loader.
+	ConfigComponent ComponentType = "Config"
+	// AdminComponent represents the admin API.
+	AdminComponent ComponentType = "Admin"
+	// AccessLogComponent represents the access log.
+	AccessLogComponent ComponentType = "AccessLog"
 )
 
 // LogFlags is a struct that defines the log output format.
@@ -49,6 +89,34 @@ type LogFlags struct {
 	File bool
 	// Use full file path
 	LongFile bool
+	// Output format, TextFormat by default
+	Format LogFormat
+}
+
+// LogFormat selects how log lines are written.
+type LogFormat int
+
+const (
+	// TextFormat writes free-text "[Component][LEVEL] message" lines through the log package.
+	TextFormat LogFormat = iota
+	// JSONFormat writes one JSON object per line through log/slog.
+	JSONFormat
+	// LogfmtFormat writes key=value lines through log/slog.
+	LogfmtFormat
+)
+
+// ParseFormat parses a format name: "text", "json" or "logfmt".
+func ParseFormat(s string) (LogFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	case "logfmt":
+		return LogfmtFormat, nil
+	default:
+		return TextFormat, fmt.Errorf("unknown log format %q", s)
+	}
 }
 
 // Logger is the common interface for Floo logging.
@@ -57,92 +125,110 @@ type Logger interface {
 	Info(component ComponentType, format string, v ...interface{})
 	Warn(component ComponentType, format string, v ...interface{})
 	Error(component ComponentType, format string, v ...interface{})
+	// Timed logs the start of a task and returns a function logging its result
+	// and elapsed time.
 	Timed(component ComponentType, format string, v ...interface{}) func(result string)
+	// TimedWith is like Timed, and key-value pairs passed to the returned
+	// function are attached to the result line as attributes.
+	TimedWith(component ComponentType, format string, v ...interface{}) func(result string, args ...interface{})
+	// Enabled reports whether lines of the component at level are written,
+	// so that callers can skip building expensive messages.
+	Enabled(component ComponentType, level LogLevel) bool
+	// With returns a Logger that attaches the key-value pairs to every line,
+	// e.g. With("route_id", id, "upstream", upstream).
+	With(args ...interface{}) Logger
 }
 
 // StandardLogger is the standard logging implementation.
+// It writes free-text "[Component][LEVEL] message key=value" lines.
 type StandardLogger struct {
 	logger *log.Logger
-	level  LogLevel
-}
-
-var (
-	// Current log level, default is InfoLevel
-	currentLevel = InfoLevel
-	// Default logger
-	defaultLogger = log.Default()
-	// Shared logger instance
-	sharedLogger Logger = &StandardLogger{logger: defaultLogger, level: currentLevel}
-)
-
-// SetLogLevel sets the current log level.
-func SetLogLevel(level LogLevel) {
-	currentLevel = level
-	if stdLogger, ok := sharedLogger.(*StandardLogger); ok {
-		stdLogger.level = level
-	}
+	levels *Levels
+	// attrs is the rendered " key=value" suffix of lines
+	attrs string
 }
 
-// GetLogLevel returns the current log level.
-func GetLogLevel() LogLevel {
-	return currentLevel
+// Levels returns the levels of the logger, which may be changed at runtime.
+func (l *StandardLogger) Levels() *Levels {
+	return l.levels
 }
 
-// IsDebugEnabled checks if debug logging is enabled.
-func IsDebugEnabled() bool {
-	return currentLevel <= DebugLevel
-}
-
-// GetLogger returns the shared logger.
-func GetLogger() Logger {
-	return sharedLogger
+// Enabled reports whether lines of the component at level are written.
+func (l *StandardLogger) Enabled(component ComponentType, level LogLevel) bool {
+	return l.levels.Enabled(component, level)
 }
 
 // Debug outputs a debug level log.
 func (l *StandardLogger) Debug(component ComponentType, format string, v ...interface{}) {
-	if l.level <= DebugLevel {
-		l.logger.Printf("[%s][DEBUG] %s", component, fmt.Sprintf(format, v...))
+	if l.levels.Enabled(component, DebugLevel) {
+		l.logger.Printf("[%s][DEBUG] %s%s", component, fmt.Sprintf(format, v...), l.attrs)
 	}
 }
 
 // Info outputs an info level log.
 func (l *StandardLogger) Info(component ComponentType, format string, v ...interface{}) {
-	if l.level <= InfoLevel {
-		l.logger.Printf("[%s][INFO] %s", component, fmt.Sprintf(format, v...))
+	if l.levels.Enabled(component, InfoLevel) {
+		l.logger.Printf("[%s][INFO] %s%s", component, fmt.Sprintf(format, v...), l.attrs)
 	}
 }
 
 // Warn outputs a warning level log.
 func (l *StandardLogger) Warn(component ComponentType, format string, v ...interface{}) {
-	if l.level <= WarnLevel {
-		l.logger.Printf("[%s][WARN] %s", component, fmt.Sprintf(format, v...))
+	if l.levels.Enabled(component, WarnLevel) {
+		l.logger.Printf("[%s][WARN] %s%s", component, fmt.Sprintf(format, v...), l.attrs)
 	}
 }
 
 // Error outputs an error level log.
 func (l *StandardLogger) Error(component ComponentType, format string, v ...interface{}) {
-	if l.level <= ErrorLevel {
-		l.logger.Printf("[%s][ERROR] %s", component, fmt.Sprintf(format, v...))
+	if l.levels.Enabled(component, ErrorLevel) {
+		l.logger.Printf("[%s][ERROR] %s%s", component, fmt.Sprintf(format, v...), l.attrs)
 	}
 }
 
 // Timed returns a logger function that measures the time taken for a task.
 func (l *StandardLogger) Timed(component ComponentType, format string, v ...interface{}) func(result string) {
-	if l.level > InfoLevel {
-		return func(string) {}
+	done := l.TimedWith(component, format, v...)
+	return func(result string) { done(result) }
+}
+
+// TimedWith is like Timed, attaching the key-value pairs passed to the
+// returned function to the result line.
+func (l *StandardLogger) TimedWith(component ComponentType, format string, v ...interface{}) func(result string, args ...interface{}) {
+	if !l.levels.Enabled(component, InfoLevel) {
+		return func(string, ...interface{}) {}
 	}
 
 	start := time.Now()
 	l.Info(component, format, v...)
 
-	return func(result string) {
+	return func(result string, args ...interface{}) {
 		elapsed := time.Since(start)
-		l.Info(component, "%s: %s (elapsed time: %s)", fmt.Sprintf(format, v...), result, elapsed)
+		l.With(args...).Info(component, "%s: %s (elapsed time: %s)", fmt.Sprintf(format, v...), result, elapsed)
+	}
+}
+
+// With returns a logger that appends the key-value pairs to every line as " key=value".
+func (l *StandardLogger) With(args ...interface{}) Logger {
+	if len(args) == 0 {
+		return l
+	}
+	var b strings.Builder
+	b.WriteString(l.attrs)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
 	}
+	return &StandardLogger{logger: l.logger, levels: l.levels, attrs: b.String()}
 }
 
 // Buffer is a buffer struct for capturing logs.
+// It is safe for concurrent use.
 type Buffer struct {
+	mu  sync.Mutex
 	buf bytes.Buffer
 }
 
@@ -153,65 +239,14 @@ func NewBuffer() *Buffer {
 
 // Write implements the bytes.Buffer Write method.
 func (lb *Buffer) Write(p []byte) (n int, err error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
 	return lb.buf.Write(p)
 }
 
 // String returns the log buffer content as a string.
 func (lb *Buffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
 	return lb.buf.String()
 }
-
-// CaptureLogsToBuffer redirects log output to a buffer.
-// The returned function restores the original output when called.
-func CaptureLogsToBuffer(buffer *Buffer) func() {
-	original := log.Writer()
-	log.SetOutput(buffer)
-	return func() {
-		log.SetOutput(original)
-	}
-}
-
-// ConfigureLogger configures the log format and output.
-func ConfigureLogger(flags LogFlags, prefix string) {
-	var logFlags int
-
-	if flags.Date {
-		logFlags |= log.Ldate
-	}
-	if flags.Time {
-		logFlags |= log.Ltime
-	}
-	if flags.Microseconds {
-		logFlags |= log.Lmicroseconds
-	}
-	if flags.UTC {
-		logFlags |= log.LUTC
-	}
-	if flags.File {
-		if flags.LongFile {
-			logFlags |= log.Llongfile
-		} else {
-			logFlags |= log.Lshortfile
-		}
-	}
-
-	log.SetFlags(logFlags)
-	log.SetPrefix(prefix)
-
-	// Update default logger
-	defaultLogger = log.Default()
-	if stdLogger, ok := sharedLogger.(*StandardLogger); ok {
-		stdLogger.logger = defaultLogger
-	} else {
-		sharedLogger = &StandardLogger{logger: defaultLogger, level: currentLevel}
-	}
-}
-
-// ConfigureDefaultLogger configures the logger with common log format settings.
-func ConfigureDefaultLogger() {
-	ConfigureLogger(LogFlags{
-		Date: true,
-		Time: true,
-		File: true,
-	}, "[FLOO] ")
-}
@@ -0,0 +1,188 @@
+// Package metrics records gateway metrics and exposes them in the Prometheus
+// text format. It wraps the gateway handler and observes routes through
+// gateway hooks, so it works with Gateway and GatewayLogger alike.
+package metrics
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CircuitState is the state of a circuit breaker in floo_circuit_breaker_state.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets trial requests through.
+	CircuitHalfOpen
+	// CircuitOpen rejects requests.
+	CircuitOpen
+)
+
+// Metrics holds the gateway series. It is safe for concurrent use.
+type Metrics struct {
+	requests         *family
+	requestDuration  *family
+	inFlight         *family
+	upstreamDuration *family
+	upstreamErrors   *family
+	upstreamInFlight *family
+	filterDuration   *family
+	filterRejections *family
+	circuitState     *family
+	upstreamHealthy  *family
+	families         []*family
+}
+
+// New creates Metrics with no recorded series.
+func New() *Metrics {
+	m := &Metrics{
+		requests: newFamily("floo_requests_total", "Requests handled by the gateway.",
+			counterKind, nil, "route", "method", "status"),
+		requestDuration: newFamily("floo_request_duration_seconds", "Time to handle a request, including filters and upstream.",
+			histogramKind, DefaultBuckets, "route", "method", "status"),
+		inFlight: newFamily("floo_requests_in_flight", "Requests being handled by the gateway.",
+			gaugeKind, nil),
+		upstreamDuration: newFamily("floo_upstream_duration_seconds", "Time spent waiting for upstream responses.",
+			histogramKind, DefaultBuckets, "upstream"),
+		upstreamErrors: newFamily("floo_upstream_errors_total", "Upstream calls that failed without a response.",
+			counterKind, nil, "upstream"),
+		upstreamInFlight: newFamily("floo_upstream_requests_in_flight", "Upstream calls waiting for a response.",
+			gaugeKind, nil, "upstream"),
+		filterDuration: newFamily("floo_filter_duration_seconds", "Time to run a filter.",
+			histogramKind, FilterBuckets, "route", "phase", "filter"),
+		filterRejections: newFamily("floo_filter_rejections_total", "Requests a request filter rejected, e.g. failed authentication or denied clients.",
+			counterKind, nil, "route", "filter", "status"),
+		circuitState: newFamily("floo_circuit_breaker_state", "Circuit breaker state: 0 closed, 1 half-open, 2 open.",
+			gaugeKind, nil, "upstream"),
+		upstreamHealthy: newFamily("floo_upstream_healthy", "Health check result: 1 healthy, 0 unhealthy.",
+			gaugeKind, nil, "upstream"),
+	}
+	m.families = []*family{
+		m.requests, m.requestDuration, m.inFlight,
+		m.upstreamDuration, m.upstreamErrors, m.upstreamInFlight,
+		m.filterDuration, m.filterRejections, m.circuitState, m.upstreamHealthy,
+	}
+	return m
+}
+
+// Wrap returns a handler that records the requests handled by next,
+// usually Gateway.Handle or GatewayLogger.Handle.
+func (m *Metrics) Wrap(next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		gateway.AddHook(c, m)
+		err := next(c)
+
+		route := gateway.ExchangeOf(c).RouteID
+		if route == "" {
+			route = "none"
+		}
+		labels := []string{route, methodLabel(c.Method()), statusClass(statusOf(c, err))}
+		m.requests.Add(1, labels...)
+		m.requestDuration.Observe(time.Since(start).Seconds(), labels...)
+		return err
+	}
+}
+
+// Middleware returns a handler for app.Use that records the requests
+// handled by the rest of the chain.
+func (m *Metrics) Middleware() fiber.Handler {
+	return m.Wrap(func(c *fiber.Ctx) error {
+		return c.Next()
+	})
+}
+
+// Begin implements gateway.Hook, timing upstream calls and filters.
+func (m *Metrics) Begin(c *fiber.Ctx, stage gateway.Stage, name string) func(err error) {
+	start := time.Now()
+	if stage == gateway.StageProxy {
+		m.upstreamInFlight.Add(1, name)
+		return func(err error) {
+			m.upstreamInFlight.Add(-1, name)
+			m.upstreamDuration.Observe(time.Since(start).Seconds(), name)
+			if err != nil {
+				m.upstreamErrors.Add(1, name)
+			}
+		}
+	}
+
+	route := gateway.ExchangeOf(c).RouteID
+	return func(err error) {
+		m.filterDuration.Observe(time.Since(start).Seconds(), route, string(stage), name)
+		if err != nil && stage == gateway.StageRequestFilter {
+			m.filterRejections.Add(1, route, name, strconv.Itoa(gateway.AsError(err).Status))
+		}
+	}
+}
+
+// SetCircuitState records the circuit breaker state of an upstream. Floo has
+// no circuit breaker yet; call it from one that wraps the ReverseProxy.
+func (m *Metrics) SetCircuitState(upstream string, state CircuitState) {
+	m.circuitState.Set(float64(state), upstream)
+}
+
+// SetHealthy records the health check result of an upstream. Floo has no
+// health checker yet; call it from one of your own.
+func (m *Metrics) SetHealthy(upstream string, healthy bool) {
+	v := 0.0
+	if healthy {
+		v = 1
+	}
+	m.upstreamHealthy.Set(v, upstream)
+}
+
+// WriteText writes every series in the Prometheus text exposition format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	return writeFamilies(w, m.families)
+}
+
+// Handler serves the series in the Prometheus text exposition format.
+func (m *Metrics) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return m.WriteText(c)
+	}
+}
+
+// statusOf returns the status the client receives: that of the error
+// returned by the handler, or else that of the response.
+func statusOf(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// methodLabel returns method if it is a standard HTTP method, or else
+// "OTHER", so that clients cannot create series at will.
+func methodLabel(method string) string {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch,
+		fiber.MethodDelete, fiber.MethodConnect, fiber.MethodOptions, fiber.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// statusClass returns e.g. "2xx" for 200.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
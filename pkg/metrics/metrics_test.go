@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// stubProxy responds with 200, or fails for the "down" upstream.
+type stubProxy struct{}
+
+func (stubProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	if upstream == "http://down" {
+		return errors.New("connection refused")
+	}
+	return c.SendString("ok")
+}
+
+func setupMetrics(t *testing.T) (*fiber.App, *Metrics) {
+	t.Helper()
+	allowed, err := filter.NewIPList([]string{"10.0.0.0/8"}, "")
+	if err != nil {
+		t.Fatalf("Failed to parse IP list: %v", err)
+	}
+	gw := &gateway.Gateway{
+		ReverseProxy: stubProxy{},
+		Routes: []gateway.Route{
+			{
+				ID:         "todos",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/todos"}},
+				RequestFilters: []gateway.RequestFilter{
+					filter.AddHeaderRequestFilter{Key: "X-Proxy", Value: "Floo"},
+				},
+				Upstream: "http://todos",
+			},
+			{
+				ID:         "down",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/down"}},
+				Upstream:   "http://down",
+			},
+			{
+				ID:         "admin",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/admin"}},
+				RequestFilters: []gateway.RequestFilter{
+					filter.IPAccessRequestFilter{Allow: allowed},
+				},
+				Upstream: "http://admin",
+			},
+		},
+	}
+
+	m := New()
+	app := fiber.New()
+	app.Get("/metrics", m.Handler())
+	app.All("/*", m.Wrap(gw.Handle))
+	return app, m
+}
+
+func TestMetricsRecordRequests(t *testing.T) {
+	app, m := setupMetrics(t)
+
+	for _, path := range []string{"/todos/1", "/todos/2", "/down", "/missing", "/admin"} {
+		if _, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+			t.Fatalf("Request test failed: %v", err)
+		}
+	}
+
+	got := map[string]float64{
+		"todos 2xx": m.requests.Value("todos", "GET", "2xx"),
+		"down 5xx":  m.requests.Value("down", "GET", "5xx"),
+		"none 4xx":  m.requests.Value("none", "GET", "4xx"),
+	}
+	for name, count := range map[string]float64{"todos 2xx": 2, "down 5xx": 1, "none 4xx": 1} {
+		if got[name] != count {
+			t.Errorf("Expected %v requests for %s, got %v", count, name, got[name])
+		}
+	}
+
+	if got := m.upstreamErrors.Value("http://down"); got != 1 {
+		t.Errorf("Expected 1 upstream error, got %v", got)
+	}
+	if got := m.upstreamDuration.Value("http://todos"); got != 2 {
+		t.Errorf("Expected 2 upstream observations, got %v", got)
+	}
+	if got := m.filterDuration.Value("todos", "request", "filter.AddHeaderRequestFilter"); got != 2 {
+		t.Errorf("Expected 2 filter observations, got %v", got)
+	}
+	if got := m.filterRejections.Value("admin", "filter.IPAccessRequestFilter", "403"); got != 1 {
+		t.Errorf("Expected 1 filter rejection, got %v", got)
+	}
+	if got := m.inFlight.Value(); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	app, m := setupMetrics(t)
+	m.SetCircuitState("http://down", CircuitOpen)
+	m.SetHealthy("http://todos", true)
+	app.Test(httptest.NewRequest(http.MethodGet, "/todos/1", nil))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+	data, _ := io.ReadAll(resp.Body)
+	body := string(data)
+
+	requiredLines := []string{
+		"# TYPE floo_requests_total counter",
+		`floo_requests_total{route="todos",method="GET",status="2xx"} 1`,
+		`floo_request_duration_seconds_bucket{route="todos",method="GET",status="2xx",le="+Inf"} 1`,
+		`floo_request_duration_seconds_count{route="todos",method="GET",status="2xx"} 1`,
+		"# TYPE floo_requests_in_flight gauge",
+		`floo_upstream_duration_seconds_count{upstream="http://todos"} 1`,
+		`floo_circuit_breaker_state{upstream="http://down"} 2`,
+		`floo_upstream_healthy{upstream="http://todos"} 1`,
+	}
+	for _, line := range requiredLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Metrics do not contain %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	// Apps may accept extra methods through fiber.Config.RequestMethods
+	for method, want := range map[string]string{
+		"GET":        "GET",
+		"OPTIONS":    "OPTIONS",
+		"PROPFIND":   "OTHER",
+		"X-RANDOM-1": "OTHER",
+		"get":        "OTHER",
+	} {
+		if got := methodLabel(method); got != want {
+			t.Errorf("Method %q should be labelled %q, but got %q", method, want, got)
+		}
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	f := newFamily("test_total", "Test.", counterKind, nil, "label")
+	f.Add(1, "a\"b\\c\nd")
+
+	out := &strings.Builder{}
+	writeFamilies(out, []*family{f})
+	if !strings.Contains(out.String(), `test_total{label="a\"b\\c\nd"} 1`) {
+		t.Errorf("Unexpected escaping:\n%s", out.String())
+	}
+}
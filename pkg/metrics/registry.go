@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// DefaultBuckets are the upper bounds in seconds of latency histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// FilterBuckets are the upper bounds in seconds of filter duration histograms.
+var FilterBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .1}
+
+// family is a metric with a fixed set of labels, e.g. floo_requests_total{route,method,status}.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series holds the value of a family for one combination of label values.
+type series struct {
+	values []string
+	// value of counters and gauges
+	value float64
+	// cumulative bucket counts, sum and count of histograms
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newFamily(name, help string, k kind, buckets []float64, labels ...string) *family {
+	return &family{name: name, help: help, kind: k, labels: labels, buckets: buckets, series: map[string]*series{}}
+}
+
+// get returns the series of the label values; f.mu must be held.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == histogramKind {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Add adds v to a counter or gauge.
+func (f *family) Add(v float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(values).value += v
+}
+
+// Set sets a gauge to v.
+func (f *family) Set(v float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(values).value = v
+}
+
+// Observe records v in a histogram.
+func (f *family) Observe(v float64, values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.get(values)
+	for i, bound := range f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Value returns the value of a counter or gauge, or the count of a histogram.
+func (f *family) Value(values ...string) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[strings.Join(values, "\xff")]
+	if !ok {
+		return 0
+	}
+	if f.kind == histogramKind {
+		return float64(s.count)
+	}
+	return s.value
+}
+
+// write writes the family in the Prometheus text exposition format.
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != histogramKind {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(s.values, "", 0), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.values, "le", bound), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.values, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelPairs(s.values, "", 0), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelPairs(s.values, "", 0), s.count)
+	}
+}
+
+// labelPairs formats {name="value",...}, with an optional extra label such as le.
+func (f *family) labelPairs(values []string, extra string, extraValue float64) string {
+	if len(values) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range f.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, escapeLabel(values[i]))
+	}
+	if extra != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", extra, formatFloat(extraValue))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabel prepares a label value for %q, which escapes backslashes,
+// quotes and newlines the way the exposition format expects; other control
+// characters are replaced so that %q leaves them alone.
+func escapeLabel(v string) string {
+	return strings.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\n') || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(v, "�"))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// writeFamilies writes families in the Prometheus text exposition format.
+func writeFamilies(out io.Writer, families []*family) error {
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		f.write(w)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,280 @@
+// Package mirror copies a share of a route's traffic to a shadow upstream,
+// discarding the shadow's responses and optionally comparing them with the
+// primary ones.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Header marks mirrored requests, so that shadows can tell them apart.
+const Header = "X-Floo-Mirror"
+
+// mirrorKey is the Locals key of the request waiting for the primary response.
+const mirrorKey = "floo.mirror"
+
+// hopHeaders are not copied to mirrored requests.
+var hopHeaders = []string{"Host", "Content-Length", "Connection", "Transfer-Encoding", "Keep-Alive", "Upgrade", "Te", "Trailer", "Proxy-Connection"}
+
+// DefaultIgnoreHeaders lists response headers that differ between any two
+// responses and are not compared.
+var DefaultIgnoreHeaders = []string{"Date", "Server", "Content-Length", "Connection", "Keep-Alive", "Transfer-Encoding", "X-Request-ID", "Set-Cookie"}
+
+// Filter mirrors requests to Shadow. Mirrored requests are queued and sent by
+// background goroutines, so the primary request never waits for the shadow;
+// when the queue is full, requests are dropped instead.
+//
+// Filter is a request filter, and also a response filter when Compare is set.
+// Register it after the filters that rewrite the request, so that the shadow
+// receives what the primary upstream receives. Create it with New.
+type Filter struct {
+	// Shadow is the base URL of the shadow upstream. The path and query of
+	// the request are appended to it.
+	Shadow string
+	// Percent is the share of requests mirrored, from 0 to 100.
+	Percent float64
+	// Compare waits for the primary response and logs the differences with
+	// the shadow's status, headers and body hash. Requests whose primary
+	// call fails are not mirrored then.
+	Compare bool
+	// IgnoreHeaders lists response headers that are not compared.
+	IgnoreHeaders []string
+	// Timeout bounds each shadow request.
+	Timeout time.Duration
+	// Client sends the shadow requests.
+	Client *http.Client
+	// Logger receives mismatches and failed shadow requests.
+	Logger log.Logger
+
+	queue   chan struct{}
+	workers chan struct{}
+	stats   *Stats
+}
+
+// Stats counts mirrored requests.
+type Stats struct {
+	Sent       atomic.Int64
+	Dropped    atomic.Int64
+	Failed     atomic.Int64
+	Mismatched atomic.Int64
+}
+
+// Defaults of New.
+const (
+	DefaultQueueSize = 1000
+	DefaultWorkers   = 16
+	DefaultTimeout   = 10 * time.Second
+)
+
+// New creates a Filter mirroring percent of the requests to shadow.
+// At most queueSize requests wait or run at a time, workers of them
+// concurrently; defaults are used when either is 0.
+func New(shadow string, percent float64, queueSize, workers int) *Filter {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Filter{
+		Shadow:        strings.TrimSuffix(shadow, "/"),
+		Percent:       percent,
+		IgnoreHeaders: DefaultIgnoreHeaders,
+		Timeout:       DefaultTimeout,
+		Client:        &http.Client{},
+		Logger:        log.New(),
+		queue:         make(chan struct{}, queueSize),
+		workers:       make(chan struct{}, workers),
+		stats:         &Stats{},
+	}
+}
+
+// Stats returns the counters of the Filter.
+func (f *Filter) Stats() *Stats {
+	return f.stats
+}
+
+// request is a copy of a request to mirror, taken before the primary call.
+type request struct {
+	method  string
+	uri     string
+	headers http.Header
+	body    []byte
+	routeID string
+}
+
+// primary is the part of the primary response that is compared.
+type primary struct {
+	status  int
+	headers http.Header
+	hash    string
+}
+
+// OnRequest copies sampled requests and queues them, unless Compare is set,
+// in which case they wait for OnResponse.
+func (f *Filter) OnRequest(c *fiber.Ctx) error {
+	if f.Percent < 100 && rand.Float64()*100 >= f.Percent {
+		return nil
+	}
+
+	req := &request{
+		method:  c.Method(),
+		uri:     string(c.Request().URI().RequestURI()),
+		headers: http.Header{},
+		body:    append([]byte(nil), c.Body()...),
+		routeID: gateway.ExchangeOf(c).RouteID,
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		req.headers.Add(string(key), string(value))
+	})
+
+	if f.Compare {
+		c.Locals(mirrorKey, req)
+		return nil
+	}
+	f.enqueue(req, nil)
+	return nil
+}
+
+// OnResponse queues the request copied by OnRequest with the primary
+// response to compare with.
+func (f *Filter) OnResponse(c *fiber.Ctx) error {
+	req, ok := c.Locals(mirrorKey).(*request)
+	if !ok {
+		return nil
+	}
+	c.Locals(mirrorKey, nil)
+
+	p := &primary{
+		status:  c.Response().StatusCode(),
+		headers: http.Header{},
+		hash:    hash(c.Response().Body()),
+	}
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		p.headers.Add(string(key), string(value))
+	})
+	f.enqueue(req, p)
+	return nil
+}
+
+// enqueue sends req in the background, or drops it when the queue is full.
+func (f *Filter) enqueue(req *request, p *primary) {
+	select {
+	case f.queue <- struct{}{}:
+	default:
+		f.stats.Dropped.Add(1)
+		return
+	}
+	go func() {
+		defer func() { <-f.queue }()
+		f.workers <- struct{}{}
+		defer func() { <-f.workers }()
+		f.send(req, p)
+	}()
+}
+
+func (f *Filter) send(req *request, p *primary) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.Timeout)
+	defer cancel()
+
+	shadowReq, err := http.NewRequestWithContext(ctx, req.method, f.Shadow+req.uri, bytes.NewReader(req.body))
+	if err != nil {
+		f.fail(req, err)
+		return
+	}
+	for name, values := range req.headers {
+		if !containsFold(hopHeaders, name) {
+			shadowReq.Header[name] = values
+		}
+	}
+	shadowReq.Header.Set(Header, "true")
+
+	resp, err := f.Client.Do(shadowReq)
+	if err != nil {
+		f.fail(req, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		f.fail(req, err)
+		return
+	}
+	f.stats.Sent.Add(1)
+
+	if p == nil {
+		return
+	}
+	if diffs := f.diff(p, resp.StatusCode, resp.Header, hash(body)); len(diffs) > 0 {
+		f.Logger.Warn(log.FilterComponent, "Mirror mismatch for %s %s on route %s: %s",
+			req.method, req.uri, req.routeID, strings.Join(diffs, "; "))
+		f.stats.Mismatched.Add(1)
+	}
+}
+
+func (f *Filter) fail(req *request, err error) {
+	f.stats.Failed.Add(1)
+	f.Logger.Debug(log.FilterComponent, "Mirror request %s %s failed: %v", req.method, req.uri, err)
+}
+
+// diff describes the differences between the primary and shadow responses.
+func (f *Filter) diff(p *primary, status int, headers http.Header, bodyHash string) []string {
+	var diffs []string
+	if p.status != status {
+		diffs = append(diffs, fmt.Sprintf("status %d != %d", p.status, status))
+	}
+
+	var names []string
+	for name := range p.headers {
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	for name := range headers {
+		if p.headers.Values(name) == nil {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if containsFold(f.IgnoreHeaders, name) {
+			continue
+		}
+		a, b := strings.Join(p.headers.Values(name), ", "), strings.Join(headers.Values(name), ", ")
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("header %s %q != %q", name, a, b))
+		}
+	}
+
+	if p.hash != bodyHash {
+		diffs = append(diffs, fmt.Sprintf("body sha256 %.12s != %.12s", p.hash, bodyHash))
+	}
+	return diffs
+}
+
+func hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
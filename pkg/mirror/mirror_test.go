@@ -0,0 +1,132 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// shadowRequest is a request received by the shadow upstream.
+type shadowRequest struct {
+	method, uri, body, mirror string
+}
+
+// newShadow starts a shadow upstream that reports its requests on a channel
+// and answers with body.
+func newShadow(t *testing.T, body string, block chan struct{}) (*httptest.Server, chan shadowRequest) {
+	t.Helper()
+	received := make(chan shadowRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block != nil {
+			<-block
+		}
+		data, _ := io.ReadAll(r.Body)
+		received <- shadowRequest{r.Method, r.URL.RequestURI(), string(data), r.Header.Get(Header)}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// okProxy answers every request itself.
+type okProxy struct{}
+
+func (okProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// newApp serves a gateway whose route mirrors to f and answers {"ok":true}.
+func newApp(f *Filter) *fiber.App {
+	gw := &gateway.Gateway{
+		ReverseProxy: okProxy{},
+		Routes: []gateway.Route{{
+			ID:              "orders",
+			RequestFilters:  []gateway.RequestFilter{f},
+			ResponseFilters: []gateway.ResponseFilter{f},
+			Upstream:        "http://primary",
+		}},
+	}
+	app := fiber.New()
+	app.All("/*", gw.Handle)
+	return app
+}
+
+func TestMirror(t *testing.T) {
+	shadow, received := newShadow(t, `{"ok":true}`, nil)
+	f := New(shadow.URL, 100, 0, 0)
+
+	resp, err := newApp(f).Test(httptest.NewRequest("POST", "/orders?id=1", strings.NewReader("payload")))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+
+	select {
+	case r := <-received:
+		if r.method != "POST" || r.uri != "/orders?id=1" || r.body != "payload" || r.mirror != "true" {
+			t.Errorf("Unexpected mirrored request %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shadow did not receive the request")
+	}
+}
+
+func TestMirrorDoesNotWait(t *testing.T) {
+	// The shadow blocks until the end of the test
+	block := make(chan struct{})
+	shadow, _ := newShadow(t, "", block)
+	defer close(block)
+	f := New(shadow.URL, 100, 2, 1)
+	app := newApp(f)
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Primary request took %v", elapsed)
+		}
+	}
+	if dropped := f.Stats().Dropped.Load(); dropped != 3 {
+		t.Errorf("Expected 3 dropped requests with a queue of 2, but got %d", dropped)
+	}
+}
+
+func TestMirrorCompare(t *testing.T) {
+	shadow, received := newShadow(t, `{"ok":false}`, nil)
+	out := log.NewBuffer()
+	f := New(shadow.URL, 100, 0, 0)
+	f.Compare = true
+	f.Logger = log.New(log.WithOutput(out))
+
+	if _, err := newApp(f).Test(httptest.NewRequest("GET", "/orders", nil)); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	<-received
+
+	deadline := time.Now().Add(time.Second)
+	for f.Stats().Mismatched.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.Stats().Mismatched.Load() != 1 {
+		t.Fatal("Expected a mismatch")
+	}
+	line := out.String()
+	if !strings.Contains(line, "Mirror mismatch for GET /orders on route orders") || !strings.Contains(line, "body sha256") {
+		t.Errorf("Unexpected log %q", line)
+	}
+	if strings.Contains(line, "Content-Type") || strings.Contains(line, "status") {
+		t.Errorf("Only the body should differ, but got %q", line)
+	}
+}
@@ -0,0 +1,489 @@
+// Package oidc logs browser users in with an OpenID Connect provider before
+// their requests reach the upstream, so that Floo can front applications
+// that have no login of their own.
+package oidc
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Defaults of New.
+const (
+	DefaultRedirectURL     = "/oauth2/callback"
+	DefaultLogoutPath      = "/oauth2/logout"
+	DefaultCookieName      = "floo_session"
+	DefaultSessionLifetime = 12 * time.Hour
+)
+
+// DefaultScopes are requested when Scopes is empty.
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// loginTimeout bounds the time between the redirect to the provider and the callback.
+const loginTimeout = 10 * time.Minute
+
+// Locals keys of the session and of the session cookie to set on the response.
+const (
+	sessionKey = "floo.oidc.session"
+	cookieKey  = "floo.oidc.cookie"
+)
+
+// Filter requires an OpenID Connect login. Browsers without a session are
+// redirected to the provider with an authorization code request protected by
+// PKCE; other requests are rejected with 401. After the callback, the tokens
+// are kept in an encrypted cookie, and the access token is refreshed with the
+// refresh token when it expires. LogoutPath ends the session, also at the
+// provider when it supports RP-Initiated Logout.
+//
+// Filter is a request filter and a response filter: register it as both so
+// that refreshed sessions are saved even when the upstream sets cookies.
+// Create it with New.
+type Filter struct {
+	// Issuer is the provider's issuer URL, where its configuration is discovered.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered at the provider. A path is
+	// resolved against the host of each request.
+	RedirectURL string
+	// LogoutPath ends the session.
+	LogoutPath string
+	// PostLogoutRedirectURL is where users go after logging out, "/" when empty.
+	PostLogoutRedirectURL string
+	// Scopes are requested from the provider, DefaultScopes when empty.
+	Scopes []string
+	// CookieName names the session cookie; the login cookie adds "_login".
+	CookieName string
+	// InsecureCookie drops the Secure attribute, for plain HTTP in development.
+	InsecureCookie bool
+	// SessionLifetime ends sessions, even refreshed ones, this long after login.
+	SessionLifetime time.Duration
+	// ClockSkew is the tolerance applied to ID token dates.
+	ClockSkew time.Duration
+	// IDTokenHeader, if set, forwards the ID token upstream in this header.
+	IDTokenHeader string
+	// ForwardClaims maps ID token claims to the request headers they are
+	// forwarded in. Forwarded headers are removed from requests first.
+	ForwardClaims map[string]string
+	// Client calls the provider.
+	Client *http.Client
+
+	sealer *sealer
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *Provider
+	keys     *filter.JWKS
+}
+
+// New creates a Filter for a client of the provider of issuer. Cookies are
+// encrypted with a key derived from cookieSecret, which must be at least 32
+// bytes; all instances serving the same users need the same secret.
+func New(issuer, clientID, clientSecret string, cookieSecret []byte) (*Filter, error) {
+	if len(cookieSecret) < 32 {
+		return nil, errors.New("cookie secret must be at least 32 bytes")
+	}
+	s, err := newSealer(cookieSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		Issuer:          issuer,
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		RedirectURL:     DefaultRedirectURL,
+		LogoutPath:      DefaultLogoutPath,
+		CookieName:      DefaultCookieName,
+		SessionLifetime: DefaultSessionLifetime,
+		ClockSkew:       30 * time.Second,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		sealer:          s,
+		now:             time.Now,
+	}, nil
+}
+
+// SessionOf returns the Session of a request authenticated by Filter, or nil.
+func SessionOf(c *fiber.Ctx) *Session {
+	s, _ := c.Locals(sessionKey).(*Session)
+	return s
+}
+
+// Claims returns the ID token claims of the Session.
+func (s *Session) Claims() map[string]interface{} {
+	parts := strings.Split(s.IDToken, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&claims) != nil {
+		return nil
+	}
+	return claims
+}
+
+// OnRequest serves the callback and logout paths, and lets other requests
+// through only with a valid session.
+func (f *Filter) OnRequest(c *fiber.Ctx) error {
+	for _, header := range f.ForwardClaims {
+		c.Request().Header.Del(header)
+	}
+	if f.IDTokenHeader != "" {
+		c.Request().Header.Del(f.IDTokenHeader)
+	}
+
+	switch c.Path() {
+	case f.callbackPath():
+		return f.callback(c)
+	case f.LogoutPath:
+		return f.logout(c)
+	}
+
+	session := f.session(c)
+	if session != nil && !session.Expiry.IsZero() && !f.now().Before(session.Expiry) {
+		session = f.refresh(c, session)
+	}
+	if session == nil {
+		return f.login(c)
+	}
+
+	if f.IDTokenHeader != "" {
+		c.Request().Header.Set(f.IDTokenHeader, session.IDToken)
+	}
+	claims := session.Claims()
+	for name, header := range f.ForwardClaims {
+		if v, ok := claims[name]; ok {
+			c.Request().Header.Set(header, filter.ClaimString(v))
+		}
+	}
+	// The upstream has no use for the gateway's cookies
+	c.Request().Header.DelCookie(f.CookieName)
+	c.Request().Header.DelCookie(f.loginCookie())
+	c.Locals(sessionKey, session)
+	return nil
+}
+
+// OnResponse sets the cookie of a refreshed session again, in case the
+// upstream's cookies replaced it.
+func (f *Filter) OnResponse(c *fiber.Ctx) error {
+	if cookie, ok := c.Locals(cookieKey).(*fiber.Cookie); ok {
+		c.Cookie(cookie)
+	}
+	return nil
+}
+
+// login redirects browsers to the provider and rejects other requests.
+func (f *Filter) login(c *fiber.Ctx) error {
+	if (c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead) ||
+		!strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+		return gateway.ErrUnauthorized.WithMessage("Login required")
+	}
+	p, err := f.discover()
+	if err != nil {
+		return err
+	}
+
+	state := loginState{
+		State:    randomString(24),
+		Nonce:    randomString(24),
+		Verifier: randomString(32),
+		Target:   c.OriginalURL(),
+		Expiry:   f.now().Add(loginTimeout),
+	}
+	if err := f.setCookie(c, f.loginCookie(), state, loginTimeout); err != nil {
+		return gateway.ErrInternal.Wrap(err)
+	}
+
+	u, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return gateway.ErrUpstreamUnavailable.WithMessage("Identity provider unavailable").Wrap(err)
+	}
+	scopes := f.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", f.ClientID)
+	query.Set("redirect_uri", f.redirectURL(c))
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", challenge(state.Verifier))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return f.redirect(c, u.String())
+}
+
+// callback completes the login: it checks the state, exchanges the code for
+// tokens and starts the session.
+func (f *Filter) callback(c *fiber.Ctx) error {
+	failed := gateway.ErrUnauthorized.WithMessage("Login failed")
+	if e := c.Query("error"); e != "" {
+		return failed.Wrap(fmt.Errorf("provider: %s: %s", e, c.Query("error_description")))
+	}
+	var state loginState
+	if err := f.sealer.open(f.loginCookie(), c.Cookies(f.loginCookie()), &state); err != nil {
+		return failed.Wrap(fmt.Errorf("login cookie: %w", err))
+	}
+	f.clearCookie(c, f.loginCookie())
+	if subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		return failed.Wrap(errors.New("state mismatch"))
+	}
+	if !f.now().Before(state.Expiry) {
+		return failed.Wrap(errors.New("login expired"))
+	}
+
+	p, err := f.discover()
+	if err != nil {
+		return err
+	}
+	t, err := f.token(p, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {c.Query("code")},
+		"redirect_uri":  {f.redirectURL(c)},
+		"code_verifier": {state.Verifier},
+	})
+	if err != nil {
+		return failed.Wrap(err)
+	}
+	claims, err := f.verify(p, t.IDToken)
+	if errors.Is(err, filter.ErrJWKSUnavailable) {
+		return gateway.ErrUpstreamUnavailable.WithMessage("Identity provider unavailable").Wrap(err)
+	}
+	if err != nil {
+		return failed.Wrap(err)
+	}
+	if nonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(state.Nonce)) != 1 {
+		return failed.Wrap(errors.New("nonce mismatch"))
+	}
+
+	now := f.now()
+	session := &Session{
+		IDToken:      t.IDToken,
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.expiry(now),
+		Created:      now,
+	}
+	if err := f.saveSession(c, session); err != nil {
+		return gateway.ErrInternal.Wrap(err)
+	}
+	return f.redirect(c, localTarget(state.Target))
+}
+
+// logout ends the session and redirects to the provider's end session
+// endpoint if it has one, or to PostLogoutRedirectURL.
+func (f *Filter) logout(c *fiber.Ctx) error {
+	session := f.session(c)
+	f.clearCookie(c, f.CookieName)
+
+	target := f.PostLogoutRedirectURL
+	if target == "" {
+		target = "/"
+	}
+	p, err := f.discover()
+	if err != nil || p.EndSessionEndpoint == "" {
+		return f.redirect(c, target)
+	}
+	u, err := url.Parse(p.EndSessionEndpoint)
+	if err != nil {
+		return f.redirect(c, target)
+	}
+	query := u.Query()
+	query.Set("client_id", f.ClientID)
+	if session != nil {
+		query.Set("id_token_hint", session.IDToken)
+	}
+	if strings.HasPrefix(f.PostLogoutRedirectURL, "http://") || strings.HasPrefix(f.PostLogoutRedirectURL, "https://") {
+		query.Set("post_logout_redirect_uri", f.PostLogoutRedirectURL)
+	}
+	u.RawQuery = query.Encode()
+	return f.redirect(c, u.String())
+}
+
+// refresh renews the tokens of an expired session. It returns nil when the
+// session cannot be refreshed and the user must log in again.
+func (f *Filter) refresh(c *fiber.Ctx, s *Session) *Session {
+	if s.RefreshToken == "" {
+		return nil
+	}
+	p, err := f.discover()
+	if err != nil {
+		return nil
+	}
+	t, err := f.token(p, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+	})
+	if err != nil {
+		return nil
+	}
+
+	refreshed := *s
+	refreshed.AccessToken = t.AccessToken
+	refreshed.Expiry = t.expiry(f.now())
+	if t.RefreshToken != "" {
+		refreshed.RefreshToken = t.RefreshToken
+	}
+	if t.IDToken != "" {
+		if _, err := f.verify(p, t.IDToken); err != nil {
+			return nil
+		}
+		refreshed.IDToken = t.IDToken
+	}
+	if f.saveSession(c, &refreshed) != nil {
+		return nil
+	}
+	return &refreshed
+}
+
+// session returns the session in the request's cookie, or nil if there is
+// none or it has ended.
+func (f *Filter) session(c *fiber.Ctx) *Session {
+	value := c.Cookies(f.CookieName)
+	if value == "" {
+		return nil
+	}
+	var s Session
+	if f.sealer.open(f.CookieName, value, &s) != nil {
+		return nil
+	}
+	if f.SessionLifetime > 0 && !f.now().Before(s.Created.Add(f.SessionLifetime)) {
+		return nil
+	}
+	return &s
+}
+
+// saveSession sets the session cookie, and keeps it for OnResponse.
+func (f *Filter) saveSession(c *fiber.Ctx, s *Session) error {
+	lifetime := f.SessionLifetime
+	if lifetime > 0 {
+		lifetime -= f.now().Sub(s.Created)
+	}
+	return f.setCookie(c, f.CookieName, s, lifetime)
+}
+
+// verify checks the signature, issuer, audience and dates of an ID token,
+// which must have an expiry.
+func (f *Filter) verify(p *Provider, idToken string) (map[string]interface{}, error) {
+	if idToken == "" {
+		return nil, errors.New("no ID token")
+	}
+	verifier := filter.AuthJWTFilter{
+		Keys:      f.keys,
+		Issuer:    p.Issuer,
+		Audience:  []string{f.ClientID},
+		ClockSkew: f.ClockSkew,
+	}
+	claims, err := verifier.Verify(idToken, f.now())
+	if err != nil {
+		return nil, fmt.Errorf("ID token: %w", err)
+	}
+	return claims, nil
+}
+
+// discover returns the provider's configuration, discovering it on first use.
+// Failures are retried on the next request.
+func (f *Filter) discover() (*Provider, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.provider != nil {
+		return f.provider, nil
+	}
+	p, err := Discover(f.Client, f.Issuer)
+	if err != nil {
+		return nil, gateway.ErrUpstreamUnavailable.WithMessage("Identity provider unavailable").Wrap(err)
+	}
+	f.provider = p
+	f.keys = &filter.JWKS{URL: p.JWKSURI, Client: f.Client}
+	return p, nil
+}
+
+func (f *Filter) setCookie(c *fiber.Ctx, name string, v interface{}, maxAge time.Duration) error {
+	value, err := f.sealer.seal(name, v)
+	if err != nil {
+		return err
+	}
+	cookie := f.cookie(name, value, maxAge)
+	c.Cookie(cookie)
+	if name == f.CookieName {
+		c.Locals(cookieKey, cookie)
+	}
+	return nil
+}
+
+func (f *Filter) clearCookie(c *fiber.Ctx, name string) {
+	cookie := f.cookie(name, "", 0)
+	cookie.Expires = time.Unix(0, 0)
+	cookie.MaxAge = -1
+	c.Cookie(cookie)
+}
+
+func (f *Filter) cookie(name, value string, maxAge time.Duration) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   !f.InsecureCookie,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+}
+
+func (f *Filter) loginCookie() string {
+	return f.CookieName + "_login"
+}
+
+// callbackPath returns the path of RedirectURL.
+func (f *Filter) callbackPath() string {
+	u, err := url.Parse(f.RedirectURL)
+	if err != nil {
+		return f.RedirectURL
+	}
+	return u.Path
+}
+
+// redirectURL returns RedirectURL, resolving a path against the request's host.
+func (f *Filter) redirectURL(c *fiber.Ctx) string {
+	if strings.HasPrefix(f.RedirectURL, "/") {
+		return c.BaseURL() + f.RedirectURL
+	}
+	return f.RedirectURL
+}
+
+func (f *Filter) redirect(c *fiber.Ctx, location string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if err := c.Redirect(location, fiber.StatusFound); err != nil {
+		return err
+	}
+	return gateway.ErrHandled
+}
+
+// localTarget returns target if it is a path on this host, and "/" otherwise,
+// so that the login cannot redirect users elsewhere.
+func localTarget(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
@@ -0,0 +1,356 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+)
+
+// mockProvider is an in-process OpenID provider issuing RS256 ID tokens.
+type mockProvider struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	codes     map[string]url.Values // code -> authorization request
+	refreshes int
+	// noExpiry issues ID tokens without an exp claim
+	noExpiry bool
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	p := &mockProvider{t: t, key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Provider{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+			EndSessionEndpoint:    p.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "k1", "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize plays the user logging in at the authorization URL and returns
+// the code the provider would redirect back with.
+func (p *mockProvider) authorize(location string) url.Values {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(location, p.URL+"/authorize") {
+		p.t.Fatalf("Expected a redirect to the provider, but got %q", location)
+	}
+	query := u.Query()
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.codes[code] = query
+	p.mu.Unlock()
+	return url.Values{"code": {code}, "state": {query.Get("state")}}
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if id, secret, _ := r.BasicAuth(); id != "dashboard" || secret != "client-secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	fail := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": reason})
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	response := map[string]interface{}{"token_type": "Bearer", "expires_in": 60}
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		request, ok := p.codes[r.PostFormValue("code")]
+		if !ok {
+			fail("unknown code")
+			return
+		}
+		delete(p.codes, r.PostFormValue("code"))
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if request.Get("code_challenge_method") != "S256" || base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") {
+			fail("PKCE verification failed")
+			return
+		}
+		if r.PostFormValue("redirect_uri") != request.Get("redirect_uri") {
+			fail("redirect_uri mismatch")
+			return
+		}
+		response["access_token"] = "access-1"
+		response["refresh_token"] = "refresh-1"
+		response["id_token"] = p.idToken(request.Get("nonce"))
+	case "refresh_token":
+		if r.PostFormValue("refresh_token") != "refresh-1" {
+			fail("unknown refresh token")
+			return
+		}
+		p.refreshes++
+		response["access_token"] = "access-2"
+	default:
+		fail("unsupported grant")
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (p *mockProvider) idToken(nonce string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	claims := map[string]interface{}{
+		"iss": p.URL, "aud": "dashboard", "sub": "alice", "email": "alice@example.com",
+		"groups": []string{"admins", "ops"}, "nonce": nonce, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if p.noExpiry {
+		delete(claims, "exp")
+	}
+	payload, _ := json.Marshal(claims)
+	signed := enc(header) + "." + enc(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		p.t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signed + "." + enc(sig)
+}
+
+// echoProxy answers like an upstream reporting the headers it received.
+type echoProxy struct{}
+
+func (echoProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	return c.SendString("user=" + c.Get("X-User") + " email=" + c.Get("X-Email") + " groups=" + c.Get("X-Groups") +
+		" id_token=" + c.Get("X-Id-Token") + " cookie=" + c.Get("Cookie"))
+}
+
+// browser sends requests to app, keeping cookies like a browser would.
+type browser struct {
+	t       *testing.T
+	app     *fiber.App
+	cookies map[string]string
+}
+
+func (b *browser) get(target string, accept string) *http.Response {
+	b.t.Helper()
+	req := httptest.NewRequest("GET", target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	for name, value := range b.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	resp, err := b.app.Test(req)
+	if err != nil {
+		b.t.Fatalf("Failed to send request: %v", err)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(b.cookies, cookie.Name)
+		} else {
+			b.cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return resp
+}
+
+func newTestFilter(t *testing.T, p *mockProvider) (*Filter, *browser) {
+	t.Helper()
+	f, err := New(p.URL, "dashboard", "client-secret", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+	f.IDTokenHeader = "X-Id-Token"
+	f.ForwardClaims = map[string]string{"sub": "X-User", "email": "X-Email", "groups": "X-Groups"}
+	f.PostLogoutRedirectURL = "https://dash.example.com/bye"
+
+	route := &gateway.Route{RequestFilters: []gateway.RequestFilter{f}, ResponseFilters: []gateway.ResponseFilter{f}, Upstream: "http://dashboard"}
+	app := fiber.New(fiber.Config{ErrorHandler: gateway.ErrorHandler(nil)})
+	app.Use(func(c *fiber.Ctx) error {
+		return route.Serve(c, echoProxy{})
+	})
+	return f, &browser{t: t, app: app, cookies: map[string]string{}}
+}
+
+func TestLogin(t *testing.T) {
+	p := newMockProvider(t)
+	_, b := newTestFilter(t, p)
+
+	// API clients without a session are rejected
+	if resp := b.get("/reports?week=1", "application/json"); resp.StatusCode != 401 {
+		t.Errorf("Status code should be 401, but got %d", resp.StatusCode)
+	}
+
+	// Browsers are sent to the provider
+	resp := b.get("/reports?week=1", "text/html")
+	if resp.StatusCode != 302 {
+		t.Fatalf("Status code should be 302, but got %d", resp.StatusCode)
+	}
+	callback := p.authorize(resp.Header.Get("Location"))
+
+	// A forged state is refused
+	forged := url.Values{"code": callback["code"], "state": {"forged"}}
+	saved := b.cookies[DefaultCookieName+"_login"]
+	if resp := b.get(DefaultRedirectURL+"?"+forged.Encode(), "text/html"); resp.StatusCode != 401 {
+		t.Errorf("Forged state: status code should be 401, but got %d", resp.StatusCode)
+	}
+	b.cookies[DefaultCookieName+"_login"] = saved
+
+	// The callback starts the session and returns to the original page
+	resp = b.get(DefaultRedirectURL+"?"+callback.Encode(), "text/html")
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/reports?week=1" {
+		t.Fatalf("Expected a redirect to /reports?week=1, but got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if _, ok := b.cookies[DefaultCookieName]; !ok {
+		t.Fatal("Session cookie should be set")
+	}
+	if _, ok := b.cookies[DefaultCookieName+"_login"]; ok {
+		t.Error("Login cookie should be cleared")
+	}
+
+	// The upstream receives the claims and the ID token, but not the cookie
+	resp = b.get("/reports?week=1", "application/json")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Status code should be 200, but got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.HasPrefix(string(body), "user=alice email=alice@example.com groups=admins ops id_token=ey") || !strings.HasSuffix(string(body), "cookie=") {
+		t.Errorf("Unexpected upstream request: %s", body)
+	}
+
+	// The code cannot be used twice
+	replay := &browser{t: t, app: b.app, cookies: map[string]string{}}
+	if resp := replay.get(DefaultRedirectURL+"?"+callback.Encode(), "text/html"); resp.StatusCode != 401 {
+		t.Errorf("Replayed code: status code should be 401, but got %d", resp.StatusCode)
+	}
+}
+
+func TestIDTokenWithoutExpiry(t *testing.T) {
+	p := newMockProvider(t)
+	p.noExpiry = true
+	_, b := newTestFilter(t, p)
+
+	callback := p.authorize(b.get("/reports", "text/html").Header.Get("Location"))
+	if resp := b.get(DefaultRedirectURL+"?"+callback.Encode(), "text/html"); resp.StatusCode != 401 {
+		t.Errorf("Status code should be 401, but got %d", resp.StatusCode)
+	}
+	if _, ok := b.cookies[DefaultCookieName]; ok {
+		t.Error("Session should not start with an ID token that never expires")
+	}
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	p := newMockProvider(t)
+	f, b := newTestFilter(t, p)
+
+	resp := b.get("/", "text/html")
+	b.get(DefaultRedirectURL+"?"+p.authorize(resp.Header.Get("Location")).Encode(), "text/html")
+	first := b.cookies[DefaultCookieName]
+
+	// The access token expires after 60s and is refreshed
+	now := time.Now()
+	f.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if resp := b.get("/", "text/html"); resp.StatusCode != 200 {
+		t.Fatalf("Status code should be 200 after a refresh, but got %d", resp.StatusCode)
+	}
+	if p.refreshes != 1 {
+		t.Errorf("Tokens should be refreshed once, but were refreshed %d times", p.refreshes)
+	}
+	if b.cookies[DefaultCookieName] == first {
+		t.Error("Refreshed session should be saved")
+	}
+	var s Session
+	if err := f.sealer.open(DefaultCookieName, b.cookies[DefaultCookieName], &s); err != nil || s.AccessToken != "access-2" {
+		t.Errorf("Session should hold the refreshed access token, but got %q (%v)", s.AccessToken, err)
+	}
+
+	// Sessions end after SessionLifetime, refreshed or not
+	f.now = func() time.Time { return now.Add(DefaultSessionLifetime) }
+	if resp := b.get("/", "application/json"); resp.StatusCode != 401 {
+		t.Errorf("Status code should be 401 after the session lifetime, but got %d", resp.StatusCode)
+	}
+	f.now = time.Now
+
+	// Logout clears the session and ends it at the provider
+	resp = b.get(DefaultLogoutPath, "text/html")
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != 302 || !strings.HasPrefix(location.String(), p.URL+"/logout") {
+		t.Fatalf("Expected a redirect to the end session endpoint, but got %d %q", resp.StatusCode, location)
+	}
+	if location.Query().Get("id_token_hint") == "" || location.Query().Get("post_logout_redirect_uri") != "https://dash.example.com/bye" {
+		t.Errorf("Unexpected end session request: %s", location.RawQuery)
+	}
+	if _, ok := b.cookies[DefaultCookieName]; ok {
+		t.Error("Session cookie should be cleared")
+	}
+}
+
+func TestSealedCookies(t *testing.T) {
+	s, _ := newSealer([]byte("0123456789abcdef0123456789abcdef"))
+	other, _ := newSealer([]byte("fedcba9876543210fedcba9876543210"))
+	value, err := s.seal("floo_session", Session{AccessToken: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if strings.Contains(value, "secret") {
+		t.Error("Sealed value should not contain the token")
+	}
+
+	var session Session
+	if err := s.open("floo_session", value, &session); err != nil || session.AccessToken != "secret" {
+		t.Errorf("Expected the sealed session, but got %+v (%v)", session, err)
+	}
+	if err := s.open("floo_session_login", value, &session); err == nil {
+		t.Error("Value should not open under another cookie name")
+	}
+	if err := other.open("floo_session", value, &session); err == nil {
+		t.Error("Value should not open with another secret")
+	}
+	if _, err := New("https://issuer", "client", "", []byte("short")); err == nil {
+		t.Error("Short cookie secrets should be rejected")
+	}
+}
+
+func TestLocalTarget(t *testing.T) {
+	tests := map[string]string{
+		"/reports?week=1":  "/reports?week=1",
+		"//evil.example":   "/",
+		"/\\evil.example":  "/",
+		"https://evil.com": "/",
+	}
+	for target, want := range tests {
+		if got := localTarget(target); got != want {
+			t.Errorf("localTarget(%q) should be %q, but got %q", target, want, got)
+		}
+	}
+}
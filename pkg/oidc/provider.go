@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Provider holds the endpoints of an OpenID provider.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	// EndSessionEndpoint is optional (RP-Initiated Logout).
+	EndSessionEndpoint string `json:"end_session_endpoint"`
+}
+
+// Discover reads the configuration of the provider of issuer from its
+// /.well-known/openid-configuration document.
+func Discover(client *http.Client, issuer string) (*Provider, error) {
+	resp, err := client.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: status %d", resp.StatusCode)
+	}
+	var p Provider
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&p); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery: authorization_endpoint, token_endpoint and jwks_uri are required")
+	}
+	return &p, nil
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// expiry returns when the access token expires, or zero if unknown.
+func (t *tokenResponse) expiry(now time.Time) time.Time {
+	if t.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(t.ExpiresIn) * time.Second)
+}
+
+// token calls the token endpoint with a grant, authenticating with the
+// client secret if there is one.
+func (f *Filter) token(p *Provider, form url.Values) (*tokenResponse, error) {
+	if f.ClientSecret == "" {
+		form.Set("client_id", f.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if f.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(f.ClientID), url.QueryEscape(f.ClientSecret))
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var t tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&t); err != nil {
+		return nil, fmt.Errorf("token endpoint: status %d: %w", resp.StatusCode, err)
+	}
+	if t.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s", t.Error, t.Description)
+	}
+	if resp.StatusCode != http.StatusOK || t.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint: status %d", resp.StatusCode)
+	}
+	return &t, nil
+}
@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Session is the login kept in the session cookie.
+type Session struct {
+	IDToken      string `json:"id"`
+	AccessToken  string `json:"at"`
+	RefreshToken string `json:"rt,omitempty"`
+	// Expiry is when the access token expires and must be refreshed.
+	Expiry time.Time `json:"exp"`
+	// Created is when the user logged in; sessions end SessionLifetime later.
+	Created time.Time `json:"iat"`
+}
+
+// loginState is kept in the login cookie between the redirect to the
+// provider and the callback.
+type loginState struct {
+	State    string    `json:"s"`
+	Nonce    string    `json:"n"`
+	Verifier string    `json:"v"`
+	Target   string    `json:"t"`
+	Expiry   time.Time `json:"exp"`
+}
+
+// sealer encrypts and authenticates cookie values with AES-256-GCM.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(secret []byte) (*sealer, error) {
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal encodes v as JSON and encrypts it. The cookie name is authenticated
+// too, so that a value cannot be moved to another cookie.
+func (s *sealer) seal(name string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, data, []byte(name))), nil
+}
+
+// open decrypts a value sealed for the cookie name into v.
+func (s *sealer) open(name, value string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return errors.New("malformed cookie")
+	}
+	nonce, sealed := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return errors.New("invalid cookie")
+	}
+	return json.Unmarshal(plain, v)
+}
+
+// randomString returns n random bytes, base64url-encoded.
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// challenge returns the S256 PKCE code challenge of verifier.
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -1,6 +1,11 @@
 package predicate
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 // PathPredicate checks if the request path exactly matches a specific path
 type PathPredicate struct {
@@ -19,3 +24,36 @@ type PathPrefixPredicate struct {
 func (p PathPrefixPredicate) Match(c *fiber.Ctx) bool {
 	return len(c.Path()) >= len(p.Prefix) && c.Path()[:len(p.Prefix)] == p.Prefix
 }
+
+// PathPatternPredicate checks if the request path matches a glob pattern.
+// Each path segment is matched with path.Match, and a "**" segment matches
+// zero or more whole segments (e.g. "/api/**" or "/users/*/orders").
+type PathPatternPredicate struct {
+	Pattern string
+}
+
+func (p PathPatternPredicate) Match(c *fiber.Ctx) bool {
+	return matchSegments(strings.Split(p.Pattern, "/"), strings.Split(c.Path(), "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to match the rest of the pattern at every remaining position
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
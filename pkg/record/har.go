@@ -0,0 +1,291 @@
+package record
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 documents, limited to the fields Floo reads and writes.
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Custom fields start with an underscore
+	RequestID string `json:"_requestId,omitempty"`
+	RouteID   string `json:"_routeId,omitempty"`
+	Upstream  string `json:"_upstream,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	PostData    *harContent    `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARWriter writes Records to a HAR file as they arrive, so that memory use
+// does not grow with the number of Records. The file is created on the first
+// Write and is a complete HAR document only once Close has been called.
+type HARWriter struct {
+	path    string
+	mu      sync.Mutex
+	f       *os.File
+	entries int
+}
+
+// NewHARWriter creates a HARWriter for path.
+func NewHARWriter(path string) *HARWriter {
+	return &HARWriter{path: path}
+}
+
+// Write implements Writer.
+func (w *HARWriter) Write(r *Record) error {
+	data, err := json.Marshal(toHAR(r))
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return err
+	}
+	separator := ",\n"
+	if w.entries == 0 {
+		separator = "\n"
+	}
+	if _, err := w.f.WriteString(separator); err != nil {
+		return err
+	}
+	if _, err := w.f.Write(data); err != nil {
+		return err
+	}
+	w.entries++
+	return nil
+}
+
+// Close implements Writer, completing the HAR document.
+func (w *HARWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.open(); err != nil {
+		return err
+	}
+	_, err := w.f.WriteString("\n]}}\n")
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// open creates the file and writes the start of the document, up to the
+// entries.
+func (w *HARWriter) open() error {
+	if w.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	creator, err := json.Marshal(harCreator{Name: "floo", Version: "1"})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := fmt.Fprintf(f, `{"log":{"version":"1.2","creator":%s,"entries":[`, creator); err != nil {
+		f.Close()
+		return err
+	}
+	w.f = f
+	return nil
+}
+
+func toHAR(r *Record) harEntry {
+	e := harEntry{
+		StartedDateTime: r.Time,
+		Time:            r.DurationMs,
+		RequestID:       r.RequestID,
+		RouteID:         r.RouteID,
+		Upstream:        r.Upstream,
+		Timings:         harTimings{Wait: r.DurationMs},
+		Request: harRequest{
+			Method:      r.Request.Method,
+			URL:         r.Request.URL,
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(r.Request.Headers),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(r.Request.Body),
+		},
+		Response: harResponse{
+			Status:      r.Response.Status,
+			HTTPVersion: "HTTP/1.1",
+			Headers:     harHeaders(r.Response.Headers),
+			Cookies:     []harNameValue{},
+			Content:     harBody(r.Response.Body, firstHeader(r.Response.Headers, "Content-Type")),
+			HeadersSize: -1,
+			BodySize:    len(r.Response.Body),
+		},
+	}
+	if len(r.Request.Body) > 0 {
+		content := harBody(r.Request.Body, firstHeader(r.Request.Headers, "Content-Type"))
+		e.Request.PostData = &content
+	}
+	return e
+}
+
+func fromHAR(e harEntry) (*Record, error) {
+	r := &Record{
+		Time:       e.StartedDateTime,
+		RequestID:  e.RequestID,
+		RouteID:    e.RouteID,
+		Upstream:   e.Upstream,
+		DurationMs: e.Time,
+		Request: Request{
+			Method:  e.Request.Method,
+			URL:     e.Request.URL,
+			Headers: fromHARHeaders(e.Request.Headers),
+		},
+		Response: Response{
+			Status:  e.Response.Status,
+			Headers: fromHARHeaders(e.Response.Headers),
+		},
+	}
+	var err error
+	if e.Request.PostData != nil {
+		if r.Request.Body, err = fromHARBody(*e.Request.PostData); err != nil {
+			return nil, err
+		}
+	}
+	if r.Response.Body, err = fromHARBody(e.Response.Content); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func readHAR(data []byte) ([]*Record, error) {
+	var doc harDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	records := make([]*Record, 0, len(doc.Log.Entries))
+	for _, e := range doc.Log.Entries {
+		r, err := fromHAR(e)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func harHeaders(headers map[string][]string) []harNameValue {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := []harNameValue{}
+	for _, name := range names {
+		for _, value := range headers[name] {
+			list = append(list, harNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+func fromHARHeaders(list []harNameValue) map[string][]string {
+	headers := map[string][]string{}
+	for _, h := range list {
+		headers[h.Name] = append(headers[h.Name], h.Value)
+	}
+	return headers
+}
+
+func harBody(body []byte, mimeType string) harContent {
+	content := harContent{Size: len(body), MimeType: mimeType}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return content
+}
+
+func fromHARBody(content harContent) ([]byte, error) {
+	if content.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(content.Text)
+	}
+	return []byte(content.Text), nil
+}
+
+func firstHeader(headers map[string][]string, name string) string {
+	for k, values := range headers {
+		if strings.EqualFold(k, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+// Package record captures request/response pairs handled by the gateway and
+// replays them against a gateway or upstream to compare the responses.
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Record is a captured request and the response the client received.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	RouteID   string    `json:"route_id,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"`
+	// DurationMs is the time from the request filter to the response filter.
+	DurationMs float64  `json:"duration_ms"`
+	Request    Request  `json:"request"`
+	Response   Response `json:"response"`
+}
+
+// Request is the recorded request, with the original path and query.
+type Request struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    Body                `json:"body,omitempty"`
+}
+
+// Response is the recorded response.
+type Response struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    Body                `json:"body,omitempty"`
+}
+
+// Body is a message body. It is written as a string when it is valid UTF-8,
+// and as {"base64": "..."} otherwise.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = decoded
+	return err
+}
+
+// Writer stores Records. Implementations are safe for concurrent use.
+type Writer interface {
+	Write(r *Record) error
+	// Close flushes the Records and releases the underlying file, if any.
+	Close() error
+}
+
+// JSONLWriter writes one Record per line as JSON.
+type JSONLWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLWriter creates a JSONLWriter. Close closes w if it is an io.Closer.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	return &JSONLWriter{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write implements Writer.
+func (w *JSONLWriter) Write(r *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(r)
+}
+
+// Close implements Writer.
+func (w *JSONLWriter) Close() error {
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Create opens a Writer for path: HAR for the .har extension, JSONL otherwise.
+// JSONL files are appended to; HAR files are overwritten, streamed as Records
+// arrive and completed on Close.
+func Create(path string) (Writer, error) {
+	if filepath.Ext(path) == ".har" {
+		return NewHARWriter(path), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLWriter(f), nil
+}
+
+// ReadFile reads the Records of a JSONL or HAR file.
+func ReadFile(path string) ([]*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".har" || bytes.HasPrefix(bytes.TrimSpace(data), []byte(`{"log"`)) {
+		return readHAR(data)
+	}
+	return readJSONL(data, path)
+}
+
+func readJSONL(data []byte, path string) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
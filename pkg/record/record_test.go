@@ -0,0 +1,251 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// memoryWriter keeps written Records in memory.
+type memoryWriter struct {
+	records []*Record
+}
+
+func (w *memoryWriter) Write(r *Record) error {
+	w.records = append(w.records, r)
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	return nil
+}
+
+func TestRecorderRedacts(t *testing.T) {
+	// Create fiber app recording every request
+	out := &memoryWriter{}
+	recorder := &Recorder{
+		Writer:   out,
+		Sample:   1,
+		Redactor: &log.Redactor{DenyHeaders: []string{"Authorization"}, QueryParams: []string{"access_token"}, JSONPaths: []string{"password"}},
+	}
+	app := fiber.New()
+	app.Use(recorder.Middleware())
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"token": "t"})
+	})
+
+	req := httptest.NewRequest("POST", "/login?next=home&access_token=secret", strings.NewReader(`{"user":"alice","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Errorf("Status code should be 201, but got %d", resp.StatusCode)
+	}
+
+	if len(out.records) != 1 {
+		t.Fatalf("Expected 1 record, but got %d", len(out.records))
+	}
+	rec := out.records[0]
+	if rec.Request.Method != "POST" || !strings.HasSuffix(rec.Request.URL, "/login?next=home&access_token="+log.Mask) {
+		t.Errorf("Unexpected request %s %s", rec.Request.Method, rec.Request.URL)
+	}
+	if got := rec.Request.Headers["Authorization"]; len(got) != 1 || got[0] != log.Mask {
+		t.Errorf("Authorization should be masked, but got %v", got)
+	}
+	if strings.Contains(string(rec.Request.Body), "secret") {
+		t.Errorf("Password should be masked, but got %s", rec.Request.Body)
+	}
+	if rec.Response.Status != fiber.StatusCreated || string(rec.Response.Body) != `{"token":"t"}` {
+		t.Errorf("Unexpected response %d %s", rec.Response.Status, rec.Response.Body)
+	}
+}
+
+func TestRecorderSample(t *testing.T) {
+	tests := []struct {
+		sample float64
+		want   int
+	}{
+		{0, 0},
+		{0.000001, 0},
+		{1, 10},
+	}
+	for _, tt := range tests {
+		out := &memoryWriter{}
+		recorder := &Recorder{Writer: out, Sample: tt.sample}
+		app := fiber.New()
+		app.Use(recorder.Middleware())
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString("ok")
+		})
+
+		for i := 0; i < 10; i++ {
+			if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+		}
+		if len(out.records) != tt.want {
+			t.Errorf("Sample %v: expected %d records, but got %d", tt.sample, tt.want, len(out.records))
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	records := []*Record{
+		{
+			Time:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			RequestID: "req-1",
+			RouteID:   "todos",
+			Request: Request{
+				Method:  "POST",
+				URL:     "http://gateway/todos?page=1",
+				Headers: map[string][]string{"Content-Type": {"application/json"}},
+				Body:    Body(`{"title":"a"}`),
+			},
+			Response: Response{
+				Status:  201,
+				Headers: map[string][]string{"Content-Type": {"application/octet-stream"}},
+				Body:    Body{0xff, 0x00, 0xfe},
+			},
+		},
+	}
+
+	for _, name := range []string{"traffic.jsonl", "traffic.har"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			w, err := Create(path)
+			if err != nil {
+				t.Fatalf("Failed to create writer: %v", err)
+			}
+			for _, r := range records {
+				if err := w.Write(r); err != nil {
+					t.Fatalf("Failed to write record: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Failed to close writer: %v", err)
+			}
+
+			read, err := ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read records: %v", err)
+			}
+			if len(read) != 1 {
+				t.Fatalf("Expected 1 record, but got %d", len(read))
+			}
+			r := read[0]
+			if r.RequestID != "req-1" || r.RouteID != "todos" || !r.Time.Equal(records[0].Time) {
+				t.Errorf("Unexpected record metadata %+v", r)
+			}
+			if r.Request.URL != records[0].Request.URL || string(r.Request.Body) != `{"title":"a"}` {
+				t.Errorf("Unexpected request %s %s", r.Request.URL, r.Request.Body)
+			}
+			if r.Response.Status != 201 || !bytes.Equal(r.Response.Body, records[0].Response.Body) {
+				t.Errorf("Unexpected response %d %v", r.Response.Status, r.Response.Body)
+			}
+		})
+	}
+}
+
+func TestHARWriterStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.har")
+	w := NewHARWriter(path)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(&Record{Request: Request{Method: "GET", URL: "http://gateway/" + strconv.Itoa(i)}}); err != nil {
+			t.Fatalf("Failed to write record: %v", err)
+		}
+	}
+
+	// Entries are on disk before Close
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.Contains(string(data), "http://gateway/1") {
+		t.Errorf("Expected the second entry to be written, but got %s", data)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	read, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read records: %v", err)
+	}
+	if len(read) != 2 || read[1].Request.URL != "http://gateway/1" {
+		t.Errorf("Unexpected records %+v", read)
+	}
+
+	// A writer without Records still writes a valid document
+	empty := filepath.Join(t.TempDir(), "empty.har")
+	if err := NewHARWriter(empty).Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if read, err := ReadFile(empty); err != nil || len(read) != 0 {
+		t.Errorf("Expected no records, but got %v, %v", read, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// Upstream returning the same JSON with keys in another order, except for /changed
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer replay" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/changed" {
+			w.Write([]byte(`{"id":2,"done":true}`))
+			return
+		}
+		w.Write([]byte(`{"done":true,"id":1}`))
+	}))
+	defer upstream.Close()
+
+	start := time.Now()
+	recorded := func(path string, offset time.Duration) *Record {
+		return &Record{
+			Time: start.Add(offset),
+			Request: Request{
+				Method:  "GET",
+				URL:     "http://gateway" + path,
+				Headers: map[string][]string{"Authorization": {log.Mask}, "Host": {"gateway"}},
+			},
+			Response: Response{
+				Status:  200,
+				Headers: map[string][]string{"Content-Type": {"application/json"}},
+				Body:    Body(`{"id":1,"done":true}`),
+			},
+		}
+	}
+	records := []*Record{recorded("/same", 0), recorded("/changed", 200*time.Millisecond)}
+
+	replayer := &Replayer{
+		Target:  upstream.URL,
+		Speed:   10,
+		Headers: http.Header{"Authorization": {"Bearer replay"}},
+	}
+	results := replayer.Replay(context.Background(), records)
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, but got %d", len(results))
+	}
+	if !results[0].OK() {
+		t.Errorf("First response should match, but got %v %v", results[0].Err, results[0].Diffs)
+	}
+	if results[1].OK() || len(results[1].Diffs) != 1 || !strings.Contains(results[1].Diffs[0], "body differs") {
+		t.Errorf("Second response should differ in its body, but got %v %v", results[1].Err, results[1].Diffs)
+	}
+}
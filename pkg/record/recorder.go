@@ -0,0 +1,126 @@
+package record
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordKey is the Locals key of the Record being captured.
+const recordKey = "floo.record"
+
+// Recorder is a filter that captures sampled request/response pairs.
+// As a request filter it captures the request as the client sent it, and as
+// a response filter it completes the Record and writes it. Requests that fail
+// before the response filters run are not recorded.
+// Use Middleware instead to capture every response, including errors.
+type Recorder struct {
+	Writer Writer
+	// Sample is the fraction of requests recorded, between 0 (none) and 1
+	// (every request).
+	Sample float64
+	// Redactor masks query parameters, headers and bodies before they are
+	// written, log.DefaultRedactor() when nil. Bodies are recorded in full.
+	Redactor *log.Redactor
+	// Logger receives write errors, which never fail the request.
+	Logger log.Logger
+}
+
+// OnRequest captures the request if it is sampled.
+func (r *Recorder) OnRequest(c *fiber.Ctx) error {
+	if rand.Float64() >= r.Sample {
+		return nil
+	}
+	if _, ok := c.Locals(recordKey).(*Record); ok {
+		return nil
+	}
+	redactor := r.redactor()
+	contentType := string(c.Request().Header.ContentType())
+	c.Locals(recordKey, &Record{
+		Time: time.Now(),
+		Request: Request{
+			Method:  c.Method(),
+			URL:     redactor.URL(c.BaseURL() + c.OriginalURL()),
+			Headers: redactHeaders(redactor, requestHeaders(c)),
+			Body:    redactor.MaskBody(contentType, append([]byte(nil), c.Body()...)),
+		},
+	})
+	return nil
+}
+
+// OnResponse completes and writes the Record of a sampled request.
+func (r *Recorder) OnResponse(c *fiber.Ctx) error {
+	rec, ok := c.Locals(recordKey).(*Record)
+	if !ok {
+		return nil
+	}
+	c.Locals(recordKey, nil)
+
+	exchange := gateway.ExchangeOf(c)
+	redactor := r.redactor()
+	contentType := string(c.Response().Header.ContentType())
+	rec.RequestID = exchange.RequestID
+	rec.RouteID = exchange.RouteID
+	rec.Upstream = exchange.Upstream
+	rec.DurationMs = float64(time.Since(rec.Time).Microseconds()) / 1000
+	rec.Response = Response{
+		Status:  c.Response().StatusCode(),
+		Headers: redactHeaders(redactor, responseHeaders(c)),
+		Body:    redactor.MaskBody(contentType, append([]byte(nil), c.Response().Body()...)),
+	}
+
+	if err := r.Writer.Write(rec); err != nil && r.Logger != nil {
+		r.Logger.Error(log.FilterComponent, "Recording failed: %v", err)
+	}
+	return nil
+}
+
+// Middleware returns a handler for app.Use that records the requests handled
+// by the rest of the chain, with the status sent to the client.
+func (r *Recorder) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		r.OnRequest(c)
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				c.Status(fiber.StatusInternalServerError)
+			}
+		}
+		return r.OnResponse(c)
+	}
+}
+
+func (r *Recorder) redactor() *log.Redactor {
+	if r.Redactor == nil {
+		return log.DefaultRedactor()
+	}
+	return r.Redactor
+}
+
+func requestHeaders(c *fiber.Ctx) map[string][]string {
+	headers := map[string][]string{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = append(headers[string(key)], string(value))
+	})
+	return headers
+}
+
+func responseHeaders(c *fiber.Ctx) map[string][]string {
+	headers := map[string][]string{}
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = append(headers[string(key)], string(value))
+	})
+	return headers
+}
+
+// redactHeaders masks headers through Redactor.Headers, one value at a time.
+func redactHeaders(redactor *log.Redactor, headers map[string][]string) map[string][]string {
+	for name, values := range headers {
+		for i, value := range values {
+			values[i] = redactor.Headers(map[string]string{name: value})[name]
+		}
+	}
+	return headers
+}
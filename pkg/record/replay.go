@@ -0,0 +1,197 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// skippedHeaders are recorded headers that are not replayed.
+var skippedHeaders = []string{"Host", "Content-Length", "Connection", "Transfer-Encoding", "Keep-Alive", "Upgrade"}
+
+// Replayer sends recorded requests to a target and compares the responses
+// with the recorded ones.
+type Replayer struct {
+	// Target is the base URL requests are sent to, e.g. http://localhost:8080.
+	// The recorded path and query are appended to it.
+	Target string
+	// Speed scales the recorded intervals between requests: 2 replays twice
+	// as fast. Requests are sent back to back when it is 0.
+	Speed float64
+	// Client sends the requests, http.DefaultClient when nil.
+	Client *http.Client
+	// Headers are set on every request, e.g. to replace redacted credentials.
+	Headers http.Header
+	// CompareHeaders lists response headers compared in addition to
+	// Content-Type. Other headers are not compared.
+	CompareHeaders []string
+}
+
+// Result is the outcome of replaying a Record.
+type Result struct {
+	Record *Record
+	Status int
+	Body   []byte
+	// Diffs describes the differences with the recorded response.
+	Diffs []string
+	Err   error
+}
+
+// OK reports whether the response matched the recorded one.
+func (r *Result) OK() bool {
+	return r.Err == nil && len(r.Diffs) == 0
+}
+
+// Replay sends the records at their recorded pace and returns the results in
+// the order of the records. It stops scheduling requests when ctx is done.
+func (p *Replayer) Replay(ctx context.Context, records []*Record) []*Result {
+	results := make([]*Result, len(records))
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i, rec := range records {
+		if p.Speed > 0 && i > 0 {
+			offset := time.Duration(float64(rec.Time.Sub(records[0].Time)) / p.Speed)
+			select {
+			case <-time.After(time.Until(start.Add(offset))):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			results[i] = &Result{Record: rec, Err: ctx.Err()}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, rec *Record) {
+			defer wg.Done()
+			results[i] = p.send(ctx, rec)
+		}(i, rec)
+		if p.Speed == 0 {
+			// Back to back: one request at a time
+			wg.Wait()
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+func (p *Replayer) send(ctx context.Context, rec *Record) *Result {
+	result := &Result{Record: rec}
+
+	target, err := p.url(rec.Request.URL)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req, err := http.NewRequestWithContext(ctx, rec.Request.Method, target, bytes.NewReader(rec.Request.Body))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for name, values := range rec.Request.Headers {
+		if containsFold(skippedHeaders, name) {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	for name, values := range p.Headers {
+		req.Header[name] = values
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+	if result.Body, err = io.ReadAll(resp.Body); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Status = resp.StatusCode
+	result.Diffs = p.diff(rec, resp.Header, result.Status, result.Body)
+	return result
+}
+
+// url joins the path and query of the recorded URL to Target.
+func (p *Replayer) url(recorded string) (string, error) {
+	u, err := url.Parse(recorded)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(p.Target, "/") + u.RequestURI(), nil
+}
+
+func (p *Replayer) diff(rec *Record, headers http.Header, status int, body []byte) []string {
+	var diffs []string
+	if status != rec.Response.Status {
+		diffs = append(diffs, fmt.Sprintf("status: recorded %d, got %d", rec.Response.Status, status))
+	}
+	for _, name := range append([]string{"Content-Type"}, p.CompareHeaders...) {
+		recorded, got := firstHeader(rec.Response.Headers, name), headers.Get(name)
+		if recorded != got {
+			diffs = append(diffs, fmt.Sprintf("header %s: recorded %q, got %q", name, recorded, got))
+		}
+	}
+	if d := diffBodies(rec.Response.Body, body); d != "" {
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// diffBodies compares JSON bodies semantically and other bodies byte by byte,
+// describing the first difference.
+func diffBodies(recorded, got []byte) string {
+	var a, b interface{}
+	if json.Unmarshal(recorded, &a) == nil && json.Unmarshal(got, &b) == nil {
+		ra, _ := json.Marshal(a)
+		rb, _ := json.Marshal(b)
+		recorded, got = ra, rb
+	}
+	if bytes.Equal(recorded, got) {
+		return ""
+	}
+
+	i := 0
+	for i < len(recorded) && i < len(got) && recorded[i] == got[i] {
+		i++
+	}
+	return fmt.Sprintf("body differs at byte %d: recorded %q, got %q (%d vs %d bytes)",
+		i, excerpt(recorded, i), excerpt(got, i), len(recorded), len(got))
+}
+
+// excerpt returns up to 40 bytes of b around offset i.
+func excerpt(b []byte, i int) string {
+	start := i - 10
+	if start < 0 {
+		start = 0
+	}
+	end := start + 40
+	if end > len(b) {
+		end = len(b)
+	}
+	return string(b[start:end])
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,20 @@
 package reverseproxy
 
 import (
+	"crypto/tls"
+	"time"
+
+	"github.com/d0lim/floo/pkg/gateway"
 	"github.com/gofiber/fiber/v2"
 )
 
 // FiberHTTPClient implements HTTPClient using Fiber's client package
 type FiberHTTPClient struct {
 	agent *fiber.Agent
+	// Timeout bounds each request. Zero means no timeout.
+	Timeout time.Duration
+	// TLS maps upstream origins (see Origin) to their TLS settings.
+	TLS map[string]*tls.Config
 }
 
 // NewFiberHTTPClient creates a new FiberHTTPClient
@@ -20,6 +28,9 @@ func NewFiberHTTPClient() *FiberHTTPClient {
 func (c *FiberHTTPClient) Execute(method, url string, headers map[string][]string, body []byte) (int, map[string][]string, []byte, error) {
 	// Create a reusable agent
 	agent := c.agent.Reuse()
+	if c.Timeout > 0 {
+		agent.Timeout(c.Timeout)
+	}
 
 	// Set URL and method
 	req := agent.Request()
@@ -47,6 +58,8 @@ func (c *FiberHTTPClient) Execute(method, url string, headers map[string][]strin
 	if err := agent.Parse(); err != nil {
 		return 0, nil, nil, err
 	}
+	// The host client holding the TLS settings only exists once parsed
+	agent.TLSConfig(c.TLS[Origin(url)])
 
 	statusCode, respBody, errs := agent.Bytes()
 	if len(errs) > 0 {
@@ -83,7 +96,7 @@ func NewFiberProxy() *FiberProxy {
 // Proxy implements the HTTPProxy interface
 func (p *FiberProxy) Proxy(c *fiber.Ctx, upstream string) error {
 	// Construct target URL
-	targetURL := upstream + string(c.Request().URI().Path())
+	targetURL := gateway.TargetURL(c, upstream)
 
 	// Extract headers from request
 	headers := make(map[string][]string)
@@ -111,10 +124,11 @@ func (p *FiberProxy) Proxy(c *fiber.Ctx, upstream string) error {
 	// Set response status
 	c.Status(statusCode)
 
-	// Set response headers
+	// Set response headers, replacing defaults such as Content-Type
 	for k, values := range respHeaders {
+		c.Response().Header.Del(k)
 		for _, v := range values {
-			c.Append(k, v)
+			c.Response().Header.Add(k, v)
 		}
 	}
 
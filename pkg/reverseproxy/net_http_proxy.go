@@ -2,15 +2,21 @@ package reverseproxy
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"net/http"
 
+	"github.com/d0lim/floo/pkg/gateway"
 	"github.com/gofiber/fiber/v2"
 )
 
 // NetHTTPClient implements HTTPClient using the standard net/http package
-type NetHTTPClient struct{}
+type NetHTTPClient struct {
+	// Client sends the requests. http.DefaultClient is used when nil.
+	Client *http.Client
+	// Upstreams maps upstream origins (see Origin) to the clients used for
+	// them instead of Client, e.g. with their own TLS settings.
+	Upstreams map[string]*http.Client
+}
 
 // Execute performs an HTTP request using the net/http package
 func (c *NetHTTPClient) Execute(method, url string, headers map[string][]string, body []byte) (int, map[string][]string, []byte, error) {
@@ -28,7 +34,14 @@ func (c *NetHTTPClient) Execute(method, url string, headers map[string][]string,
 	}
 
 	// Execute the request
-	resp, err := http.DefaultClient.Do(req)
+	client := c.Client
+	if upstream, ok := c.Upstreams[Origin(url)]; ok {
+		client = upstream
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, nil, nil, err
 	}
@@ -64,7 +77,7 @@ func NewNetHTTPProxy() *NetHTTPProxy {
 // Proxy implements the HTTPProxy interface
 func (p *NetHTTPProxy) Proxy(c *fiber.Ctx, upstream string) error {
 	// Construct target URL
-	targetURL := fmt.Sprintf("%s%s", upstream, c.Request().URI().Path())
+	targetURL := gateway.TargetURL(c, upstream)
 
 	// Extract headers from request
 	headers := make(map[string][]string)
@@ -92,10 +105,11 @@ func (p *NetHTTPProxy) Proxy(c *fiber.Ctx, upstream string) error {
 	// Set response status
 	c.Status(statusCode)
 
-	// Set response headers
+	// Set response headers, replacing defaults such as Content-Type
 	for k, values := range respHeaders {
+		c.Response().Header.Del(k)
 		for _, v := range values {
-			c.Append(k, v)
+			c.Response().Header.Add(k, v)
 		}
 	}
 
@@ -1,6 +1,9 @@
 package reverseproxy
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -17,3 +20,13 @@ type HTTPClient interface {
 	// Execute performs an HTTP request and returns the response
 	Execute(method, url string, headers map[string][]string, body []byte) (statusCode int, respHeaders map[string][]string, respBody []byte, err error)
 }
+
+// Origin returns the scheme and host of rawURL, e.g. "https://payments:8443",
+// which identifies the upstream of a request in per-upstream settings.
+func Origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
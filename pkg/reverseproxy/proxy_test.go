@@ -1,6 +1,7 @@
 package reverseproxy
 
 import (
+	"crypto/tls"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -166,3 +167,59 @@ func TestProxyPathHandling(t *testing.T) {
 		t.Errorf("Expected body OK, got %s", string(mockClient.RespBody))
 	}
 }
+
+func TestProxyResponseHeaders(t *testing.T) {
+	mockClient := &MockHTTPClient{
+		StatusCode: 200,
+		RespHeaders: map[string][]string{
+			"Content-Type": {"application/json"},
+			"Set-Cookie":   {"a=1", "b=2"},
+		},
+		RespBody: []byte(`{}`),
+	}
+	proxies := map[string]interface {
+		Proxy(c *fiber.Ctx, upstream string) error
+	}{
+		"net/http": &NetHTTPProxy{Client: mockClient},
+		"fiber":    &FiberProxy{Client: mockClient},
+	}
+	for name, proxy := range proxies {
+		t.Run(name, func(t *testing.T) {
+			app := setupTestApp()
+			app.Get("/*", func(c *fiber.Ctx) error {
+				return proxy.Proxy(c, "https://upstream.com")
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if got := resp.Header.Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+				t.Errorf("Upstream Content-Type should replace the default, but got %q", got)
+			}
+			if got := resp.Header.Values("Set-Cookie"); len(got) != 2 {
+				t.Errorf("Every upstream cookie should be kept on its own line, but got %q", got)
+			}
+		})
+	}
+}
+
+func TestFiberHTTPClientUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer upstream.Close()
+
+	// The upstream's self-signed certificate is only trusted through TLS
+	client := NewFiberHTTPClient()
+	client.TLS = map[string]*tls.Config{
+		Origin(upstream.URL): upstream.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+	status, _, body, err := client.Execute(http.MethodGet, upstream.URL+"/", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if status != 200 || string(body) != "secure" {
+		t.Errorf("Expected 200 secure, got %d %s", status, body)
+	}
+}
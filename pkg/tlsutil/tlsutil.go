@@ -0,0 +1,178 @@
+// Package tlsutil loads TLS certificates and settings, reloading certificates
+// when their files change so that they can be renewed without a restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/d0lim/floo/internal/reload"
+)
+
+// CertReloader holds a certificate and key pair loaded from files, and loads
+// them again in the background when either file changes. If a reload fails,
+// e.g. because only one of the files was replaced yet, the previous pair keeps
+// being used. It is safe for concurrent use.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	// CheckInterval is how often the files are checked for changes, 1s when 0.
+	CheckInterval time.Duration
+	// OnReloadError, if set, is called when the files changed but could not
+	// be loaded, e.g. to log it.
+	OnReloadError func(err error)
+
+	mu    sync.Mutex
+	cert  *tls.Certificate
+	check reload.Checker
+}
+
+// NewCertReloader creates a CertReloader and loads the pair.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{CertFile: certFile, KeyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files.
+func (r *CertReloader) Reload() error {
+	version, err := r.version()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.CertFile, err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	r.check.Loaded(version)
+	return nil
+}
+
+// Certificate returns the current pair. If the files changed, they are
+// reloaded in the background and the previous pair is returned until the
+// reload completes, so that handshakes do not wait for the files.
+func (r *CertReloader) Certificate() (*tls.Certificate, error) {
+	// Keep serving the previous pair if the new files are invalid
+	r.check.CheckInBackground(r.CheckInterval, r.version, r.Reload, r.OnReloadError)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert == nil {
+		return nil, fmt.Errorf("%s: certificate not loaded", r.CertFile)
+	}
+	return r.cert, nil
+}
+
+// GetCertificate serves the pair as a tls.Config.GetCertificate callback.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+// GetClientCertificate serves the pair as a tls.Config.GetClientCertificate callback.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+func (r *CertReloader) version() (string, error) {
+	return reload.FileVersion(r.CertFile, r.KeyFile)
+}
+
+// LoadCertPool reads the PEM certificates of file into a pool.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", file)
+	}
+	return pool, nil
+}
+
+// ParseVersion converts a TLS version such as "1.2" to its tls constant.
+// The empty string is 0, the crypto/tls default.
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+	}
+}
+
+// ClientConfig describes the TLS settings of connections to a server.
+type ClientConfig struct {
+	// CAFile holds the PEM certificates trusted to sign the server's
+	// certificate, instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile hold the client certificate sent for mutual TLS.
+	// They are reloaded when they change.
+	CertFile string
+	KeyFile  string
+	// ServerName is the name the server's certificate is checked against,
+	// and sent with SNI, instead of the host of the URL.
+	ServerName string
+	// MinVersion and MaxVersion bound the TLS version, e.g. "1.2".
+	MinVersion string
+	MaxVersion string
+	// InsecureSkipVerify accepts any server certificate. Only use it for tests.
+	InsecureSkipVerify bool
+	// OnReloadError is the OnReloadError hook of the client certificate's
+	// CertReloader.
+	OnReloadError func(err error)
+}
+
+// Build loads the files and returns the tls.Config.
+func (c ClientConfig) Build() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	var err error
+	if cfg.MinVersion, err = ParseVersion(c.MinVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MaxVersion, err = ParseVersion(c.MaxVersion); err != nil {
+		return nil, err
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return nil, errors.New("min TLS version is above the max version")
+	}
+	if c.CAFile != "" {
+		if cfg.RootCAs, err = LoadCertPool(c.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if c.CertFile != "" {
+		reloader, err := NewCertReloader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		reloader.OnReloadError = c.OnReloadError
+		cfg.GetClientCertificate = reloader.GetClientCertificate
+	}
+	return cfg, nil
+}
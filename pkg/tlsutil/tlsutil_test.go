@@ -0,0 +1,123 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/d0lim/floo/internal/testcert"
+)
+
+func writeFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	os.Chtimes(path, mtime, mtime)
+}
+
+func TestClientConfigMutualTLS(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.PEM")
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writeFile(t, caFile, ca.PEM, time.Now())
+	certPEM, keyPEM := ca.IssuePEM(t, "gateway", "gateway", "127.0.0.1")
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+
+	// The upstream requires a client certificate signed by the CA
+	serverCert, serverKey := ca.IssuePEM(t, "payments.internal", "payments.internal", "127.0.0.1")
+	pair, _ := tls.X509KeyPair(serverCert, serverKey)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(ca.Cert)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config ClientConfig
+		ok     bool
+	}{
+		{"mutual TLS", ClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "payments.internal"}, true},
+		{"no client certificate", ClientConfig{CAFile: caFile, ServerName: "payments.internal"}, false},
+		{"untrusted server", ClientConfig{CertFile: certFile, KeyFile: keyFile, ServerName: "payments.internal"}, false},
+		{"wrong server name", ClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "orders.internal"}, false},
+		{"TLS 1.3 only", ClientConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "payments.internal", MinVersion: "1.3"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.config.Build()
+			if err != nil {
+				t.Fatalf("Failed to build TLS config: %v", err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+			resp, err := client.Get(server.URL)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Expected success=%v, but got %v", tt.ok, err)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		})
+	}
+
+	if _, err := (ClientConfig{MinVersion: "1.3", MaxVersion: "1.2"}).Build(); err == nil {
+		t.Error("Min version above max version should be rejected")
+	}
+	if _, err := (ClientConfig{CertFile: certFile}).Build(); err == nil {
+		t.Error("Certificate without key should be rejected")
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := testcert.NewCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM, keyPEM := ca.IssuePEM(t, "first", "first", "127.0.0.1")
+	writeFile(t, certFile, certPEM, time.Now().Add(-time.Hour))
+	writeFile(t, keyFile, keyPEM, time.Now().Add(-time.Hour))
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+	r.CheckInterval = time.Nanosecond
+	// Changes are loaded in the background, so wait for them before checking
+	name := func() string {
+		t.Helper()
+		r.Certificate()
+		r.check.Wait()
+		cert, err := r.Certificate()
+		if err != nil {
+			t.Fatalf("Failed to get certificate: %v", err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if got := name(); got != "first" {
+		t.Errorf("Certificate should be first, but got %s", got)
+	}
+
+	// A renewed pair is picked up
+	certPEM, keyPEM = ca.IssuePEM(t, "second", "second", "127.0.0.1")
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+	if got := name(); got != "second" {
+		t.Errorf("Certificate should be reloaded, but got %s", got)
+	}
+
+	// A half-replaced pair keeps the previous one
+	certPEM, _ = ca.IssuePEM(t, "third", "third", "127.0.0.1")
+	writeFile(t, certFile, certPEM, time.Now().Add(time.Minute))
+	if got := name(); got != "second" {
+		t.Errorf("Mismatched pair should keep the previous certificate, but got %s", got)
+	}
+}
@@ -0,0 +1,181 @@
+// Package tracing creates OpenTelemetry spans for requests handled by the
+// gateway and propagates trace context to upstreams.
+package tracing
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of Floo's spans.
+const TracerName = "github.com/d0lim/floo"
+
+// Attribute keys specific to Floo.
+const (
+	RouteIDKey     = attribute.Key("floo.route.id")
+	FilterPhaseKey = attribute.Key("floo.filter.phase")
+	UpstreamKey    = attribute.Key("floo.upstream")
+)
+
+// Config configures Tracing.
+type Config struct {
+	// TracerProvider creates the spans, otel.GetTracerProvider() when nil.
+	TracerProvider trace.TracerProvider
+	// Propagator extracts context from requests and injects it into proxied
+	// requests. W3C trace context and baggage are used when nil.
+	Propagator propagation.TextMapPropagator
+	// B3 additionally accepts and sends B3 headers, in both the single and
+	// multiple header encodings. It is ignored when Propagator is set.
+	B3 bool
+}
+
+// Tracing creates a server span per request, a child span per filter and
+// upstream call, and injects the context of the upstream span into the
+// proxied request.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates Tracing.
+func New(cfg Config) *Tracing {
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.Propagator == nil {
+		propagators := []propagation.TextMapPropagator{propagation.TraceContext{}, propagation.Baggage{}}
+		if cfg.B3 {
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader|b3.B3SingleHeader)))
+		}
+		cfg.Propagator = propagation.NewCompositeTextMapPropagator(propagators...)
+	}
+	return &Tracing{
+		tracer:     cfg.TracerProvider.Tracer(TracerName),
+		propagator: cfg.Propagator,
+	}
+}
+
+// Wrap returns a handler that traces the requests handled by next,
+// usually Gateway.Handle or GatewayLogger.Handle.
+// The server span is available to next through c.UserContext().
+func (t *Tracing) Wrap(next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := t.propagator.Extract(c.UserContext(), HeaderCarrier{&c.Request().Header})
+		ctx, span := t.tracer.Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+			))
+		defer span.End()
+
+		c.SetUserContext(ctx)
+		gateway.AddHook(c, t)
+		err := next(c)
+
+		status := c.Response().StatusCode()
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		if routeID := gateway.ExchangeOf(c).RouteID; routeID != "" {
+			span.SetName(c.Method() + " " + routeID)
+			span.SetAttributes(RouteIDKey.String(routeID))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+			if err != nil {
+				span.RecordError(err)
+			}
+		}
+		return err
+	}
+}
+
+// Middleware returns a handler for app.Use that traces the requests
+// handled by the rest of the chain.
+func (t *Tracing) Middleware() fiber.Handler {
+	return t.Wrap(func(c *fiber.Ctx) error {
+		return c.Next()
+	})
+}
+
+// Begin implements gateway.Hook, starting a span for a filter or upstream call.
+func (t *Tracing) Begin(c *fiber.Ctx, stage gateway.Stage, name string) func(err error) {
+	ctx := c.UserContext()
+
+	if stage == gateway.StageProxy {
+		ctx, span := t.tracer.Start(ctx, "proxy "+name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(UpstreamKey.String(name)))
+		t.propagator.Inject(ctx, HeaderCarrier{&c.Request().Header})
+		return func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			} else {
+				status := c.Response().StatusCode()
+				span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+				if status >= 500 {
+					span.SetStatus(codes.Error, fmt.Sprintf("status %d", status))
+				}
+			}
+			span.End()
+		}
+	}
+
+	_, span := t.tracer.Start(ctx, "filter "+name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(FilterPhaseKey.String(string(stage))))
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// HeaderCarrier adapts fasthttp request headers to propagation.TextMapCarrier.
+type HeaderCarrier struct {
+	Header *fasthttp.RequestHeader
+}
+
+// Get returns the value of the header key.
+func (h HeaderCarrier) Get(key string) string {
+	return string(h.Header.Peek(key))
+}
+
+// Set sets the header key to value.
+func (h HeaderCarrier) Set(key, value string) {
+	h.Header.Set(key, value)
+}
+
+// Keys lists the header names.
+func (h HeaderCarrier) Keys() []string {
+	var keys []string
+	h.Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// SpanContext returns the span context of the request, e.g. to log trace IDs.
+func SpanContext(c *fiber.Ctx) trace.SpanContext {
+	return trace.SpanContextFromContext(c.UserContext())
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/d0lim/floo/pkg/filter"
+	"github.com/d0lim/floo/pkg/gateway"
+	"github.com/d0lim/floo/pkg/predicate"
+	"github.com/gofiber/fiber/v2"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerProxy responds with the trace headers it would send upstream.
+type headerProxy struct{}
+
+func (headerProxy) Proxy(c *fiber.Ctx, upstream string) error {
+	c.Set("X-Upstream-Traceparent", c.Get("traceparent"))
+	c.Set("X-Upstream-B3", c.Get("b3"))
+	return c.SendString("ok")
+}
+
+func setupTracing(t *testing.T, b3 bool) (*fiber.App, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	gw := &gateway.Gateway{
+		ReverseProxy: headerProxy{},
+		Routes: []gateway.Route{
+			{
+				ID:         "todos",
+				Predicates: []gateway.Predicate{predicate.PathPrefixPredicate{Prefix: "/todos"}},
+				RequestFilters: []gateway.RequestFilter{
+					filter.AddHeaderRequestFilter{Key: "X-Proxy", Value: "Floo"},
+				},
+				Upstream: "http://todos",
+			},
+		},
+	}
+
+	tracing := New(Config{TracerProvider: provider, B3: b3})
+	app := fiber.New()
+	app.All("/*", tracing.Wrap(gw.Handle))
+	return app, exporter
+}
+
+func TestTracingSpans(t *testing.T) {
+	app, exporter := setupTracing(t, false)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Status code should be 200, but got %d", resp.StatusCode)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	filterSpan, proxySpan, serverSpan := spans[0], spans[1], spans[2]
+
+	if serverSpan.Name != "GET todos" || serverSpan.SpanKind != trace.SpanKindServer {
+		t.Errorf("Unexpected server span %s (%s)", serverSpan.Name, serverSpan.SpanKind)
+	}
+	if serverSpan.Parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !serverSpan.Parent.IsRemote() {
+		t.Errorf("Server span should continue the incoming trace, got parent %v", serverSpan.Parent)
+	}
+	if filterSpan.Name != "filter filter.AddHeaderRequestFilter" || filterSpan.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+		t.Errorf("Unexpected filter span %s", filterSpan.Name)
+	}
+	if proxySpan.Name != "proxy http://todos" || proxySpan.SpanKind != trace.SpanKindClient || proxySpan.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+		t.Errorf("Unexpected proxy span %s (%s)", proxySpan.Name, proxySpan.SpanKind)
+	}
+
+	// The upstream receives the context of the proxy span
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + proxySpan.SpanContext.SpanID().String() + "-01"
+	if got := resp.Header.Get("X-Upstream-Traceparent"); got != expected {
+		t.Errorf("Expected upstream traceparent %s, got %s", expected, got)
+	}
+}
+
+func TestTracingB3(t *testing.T) {
+	app, exporter := setupTracing(t, true)
+
+	req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+	req.Header.Set("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7")
+	req.Header.Set("X-B3-SpanId", "e457b5a2e4d86bd1")
+	req.Header.Set("X-B3-Sampled", "1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Request test failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) == 0 || spans[len(spans)-1].SpanContext.TraceID().String() != "80f198ee56343ba864fe8b2a57d3eff7" {
+		t.Fatalf("Expected the B3 trace to be continued")
+	}
+	if resp.Header.Get("X-Upstream-B3") == "" {
+		t.Error("Expected a b3 header to be sent upstream")
+	}
+}
+
+func TestTracingUnmatched(t *testing.T) {
+	app, exporter := setupTracing(t, false)
+
+	app.Test(httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "GET" {
+		t.Fatalf("Expected a single server span, got %d", len(spans))
+	}
+	for _, attr := range spans[0].Attributes {
+		if attr.Key == "http.response.status_code" && attr.Value.AsInt64() != 404 {
+			t.Errorf("Expected status 404, got %d", attr.Value.AsInt64())
+		}
+	}
+}